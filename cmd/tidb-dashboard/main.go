@@ -50,6 +50,9 @@ import (
 	"github.com/pingcap/tidb-dashboard/pkg/utils/version"
 )
 
+// The password is not accepted as a flag, since flags are visible to other users of the host.
+const tidbServicePasswordEnv = "DASHBOARD_TIDB_SERVICE_PASSWORD"
+
 type DashboardCLIConfig struct {
 	ListenHost     string
 	ListenPort     int
@@ -84,6 +87,8 @@ func NewCLIConfig() *DashboardCLIConfig {
 	tidbCertPath := flag.String("tidb-cert", "", "path of file that contains X509 certificate in PEM format")
 	tidbKeyPath := flag.String("tidb-key", "", "path of file that contains X509 key in PEM format")
 
+	flag.StringVar(&cfg.CoreConfig.TiDBServiceUser, "tidb-service-user", "", "TiDB user for background tasks and the TiDB slow log in log searching, the password is read from the "+tidbServicePasswordEnv+" environment variable")
+
 	// debug for keyvisual，hide help information
 	flag.Int64Var(&cfg.KVFileStartTime, "keyviz-file-start", 0, "(debug) start time for file range in file mode")
 	flag.Int64Var(&cfg.KVFileEndTime, "keyviz-file-end", 0, "(debug) end time for file range in file mode")
@@ -97,6 +102,7 @@ func NewCLIConfig() *DashboardCLIConfig {
 		os.Exit(0)
 	}
 
+	cfg.CoreConfig.TiDBServicePassword = os.Getenv(tidbServicePasswordEnv)
 	cfg.CoreConfig.NormalizePublicPathPrefix()
 	if err := cfg.CoreConfig.NormalizePDEndPoint(); err != nil {
 		log.Fatal("Invalid PD Endpoint", zap.Error(err))
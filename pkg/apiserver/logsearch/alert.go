@@ -0,0 +1,380 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logsearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joomcode/errorx"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/utils"
+)
+
+const (
+	alertCheckInterval     = 10 * time.Second
+	minAlertRuleDuration   = 60
+	webhookTimeout         = 10 * time.Second
+	maxAlertPayloadSamples = 10
+)
+
+type SaveAlertRuleRequest struct {
+	Name       string     `json:"name" binding:"required"`
+	Query      SavedQuery `json:"query"` // the rule is run every `duration_secs` over the last duration
+	Threshold  int64      `json:"threshold"`
+	WebhookURL string     `json:"webhook_url" binding:"required"`
+	Enabled    bool       `json:"enabled"`
+}
+
+func (r *SaveAlertRuleRequest) validate() error {
+	if err := r.Query.validate(); err != nil {
+		return err
+	}
+	if r.Query.DurationSecs < minAlertRuleDuration {
+		return fmt.Errorf("duration of an alert rule cannot be less than %d seconds", minAlertRuleDuration)
+	}
+	if r.Threshold <= 0 {
+		return fmt.Errorf("expect a positive threshold")
+	}
+	u, err := url.Parse(r.WebhookURL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("webhook url must be http or https")
+	}
+	return nil
+}
+
+// AlertPayload is the JSON body posted to the webhook when a rule fires.
+type AlertPayload struct {
+	RuleID      uint     `json:"rule_id"`
+	RuleName    string   `json:"rule_name"`
+	Matches     int64    `json:"matches"`
+	Threshold   int64    `json:"threshold"`
+	Truncated   bool     `json:"truncated"` // the matches are more than the counted ones
+	StartTime   int64    `json:"start_time"`
+	EndTime     int64    `json:"end_time"`
+	TaskGroupID uint     `json:"task_group_id"`
+	Samples     []string `json:"samples"`
+	FiredAt     int64    `json:"fired_at"`
+}
+
+func postWebhook(ctx context.Context, client *http.Client, webhookURL string, payload *AlertPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return ErrWebhookFailed.Wrap(err, "Failed to build webhook request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return ErrWebhookFailed.Wrap(err, "Failed to send webhook request")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		data, _ := ioutil.ReadAll(resp.Body)
+		return ErrWebhookFailed.New("Webhook failed with status code %d: %s", resp.StatusCode, string(data))
+	}
+	return nil
+}
+
+func (s *Service) alertLoop(ctx context.Context) {
+	ticker := time.NewTicker(alertCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		now := time.Now()
+		var rules []*AlertRuleModel
+		if err := s.db.Where("enabled = ?", true).Find(&rules).Error; err != nil {
+			log.Warn("Failed to load log search alert rules", zap.Error(err))
+			continue
+		}
+		// Each due rule runs in its own goroutine, so that a slow rule does not delay the others. A rule still
+		// running since the last check is skipped.
+		for _, rule := range rules {
+			if rule.LastRunAt+rule.Query.DurationSecs > now.Unix() {
+				continue
+			}
+			s.wg.Add(1)
+			go func(id uint) {
+				defer s.wg.Done()
+				if _, err := s.runAlertRule(ctx, id, now); err != nil && !errorx.IsOfType(err, ErrAlertRuleRunning) {
+					log.Warn("Failed to run log search alert rule", zap.Uint("rule_id", id), zap.Error(err))
+				}
+			}(rule.ID)
+		}
+	}
+}
+
+// runAlertQuery searches the logs of the rule through the scheduler, and returns the task group and the number
+// of matched lines.
+func (s *Service) runAlertQuery(ctx context.Context, rule *AlertRuleModel, now time.Time) (*TaskGroupModel, int64, error) {
+	resp, err := s.createTaskGroup(rule.Query.toCreateTaskGroupRequest(now))
+	if err != nil {
+		return nil, 0, err
+	}
+	taskGroup := &resp.TaskGroup
+	if err := s.scheduler.Wait(ctx, taskGroup.ID); err != nil {
+		// The aborted task group is left to the retention, since it may be still writing.
+		s.scheduler.AsyncAbort(taskGroup.ID)
+		return nil, 0, err
+	}
+	if err := s.db.First(taskGroup, "id = ?", taskGroup.ID).Error; err != nil {
+		return taskGroup, 0, err
+	}
+
+	var tasks []*TaskModel
+	if err := s.db.Where("task_group_id = ?", taskGroup.ID).Find(&tasks).Error; err != nil {
+		return taskGroup, 0, err
+	}
+	var taskErr *string
+	failed := 0
+	for _, task := range tasks {
+		if task.State == TaskStateError {
+			taskErr = task.Error
+			failed++
+		}
+	}
+	if failed > 0 && failed == len(tasks) && taskErr != nil {
+		return taskGroup, 0, fmt.Errorf("all targets failed, last error: %s", *taskErr)
+	}
+
+	var matches int64
+	if err := s.db.Model(&LineModel{}).Where("task_group_id = ?", taskGroup.ID).Count(&matches).Error; err != nil {
+		return taskGroup, 0, err
+	}
+	return taskGroup, matches, nil
+}
+
+// startAlertRule loads the rule and marks it as running. It fails with ErrAlertRuleRunning if the rule is already
+// running.
+func (s *Service) startAlertRule(id uint) (*AlertRuleModel, error) {
+	s.alertMu.Lock()
+	defer s.alertMu.Unlock()
+
+	if _, ok := s.alertRunning[id]; ok {
+		return nil, ErrAlertRuleRunning.New("alert rule %d is running", id)
+	}
+	rule := &AlertRuleModel{}
+	if err := s.db.First(rule, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	s.alertRunning[id] = struct{}{}
+	return rule, nil
+}
+
+// finishAlertRule saves the result of the run. Only the state is saved, since the rule may be changed or deleted
+// during the run.
+func (s *Service) finishAlertRule(rule *AlertRuleModel) {
+	s.alertMu.Lock()
+	defer s.alertMu.Unlock()
+
+	delete(s.alertRunning, rule.ID)
+	err := s.db.Model(&AlertRuleModel{ID: rule.ID}).
+		Select("state", "last_run_at", "last_fired_at", "last_matches", "last_error", "last_task_group_id").
+		Updates(rule).Error
+	if err != nil {
+		log.Warn("Failed to save log search alert rule", zap.Uint("rule_id", rule.ID), zap.Error(err))
+	}
+}
+
+// runAlertRule runs the rule once and notifies the webhook if it fires. The task group is kept only when the
+// rule fires, otherwise it is removed to avoid flooding the task group list. The lock is not held during the
+// search and the webhook, so that other rules and the API are not blocked.
+func (s *Service) runAlertRule(ctx context.Context, id uint, now time.Time) (*AlertRuleModel, error) {
+	rule, err := s.startAlertRule(id)
+	if err != nil {
+		return nil, err
+	}
+	defer s.finishAlertRule(rule)
+
+	rule.LastRunAt = now.Unix()
+	setError := func(err error) {
+		errStr := err.Error()
+		rule.State = AlertRuleStateError
+		rule.LastError = &errStr
+		log.Warn("Log search alert rule failed", zap.Uint("rule_id", rule.ID), zap.Error(err))
+	}
+
+	taskGroup, matches, err := s.runAlertQuery(ctx, rule, now)
+	if err != nil {
+		if taskGroup != nil {
+			taskGroup.Delete(s.db)
+		}
+		setError(err)
+		return rule, nil
+	}
+	rule.LastMatches = matches
+	rule.LastError = nil
+	if matches < rule.Threshold {
+		taskGroup.Delete(s.db)
+		rule.State = AlertRuleStateOK
+		return rule, nil
+	}
+
+	var samples []string
+	err = s.db.Model(&LineModel{}).
+		Where("task_group_id = ?", taskGroup.ID).
+		Order("time").
+		Limit(maxAlertPayloadSamples).
+		Pluck("message", &samples).Error
+	if err != nil {
+		log.Warn("Failed to load samples for log search alert", zap.Uint("rule_id", rule.ID), zap.Error(err))
+	}
+	payload := &AlertPayload{
+		RuleID:      rule.ID,
+		RuleName:    rule.Name,
+		Matches:     matches,
+		Threshold:   rule.Threshold,
+		Truncated:   taskGroup.Truncated,
+		StartTime:   taskGroup.SearchRequest.StartTime,
+		EndTime:     taskGroup.SearchRequest.EndTime,
+		TaskGroupID: taskGroup.ID,
+		Samples:     samples,
+		FiredAt:     now.Unix(),
+	}
+	rule.LastTaskGroupID = taskGroup.ID
+	if err := postWebhook(ctx, s.webhookClient, rule.WebhookURL, payload); err != nil {
+		setError(err)
+		return rule, nil
+	}
+	rule.State = AlertRuleStateFiring
+	rule.LastFiredAt = now.Unix()
+	return rule, nil
+}
+
+// @Summary List log search alert rules
+// @Security JwtAuth
+// @Success 200 {array} AlertRuleModel
+// @Failure 401 {object} utils.APIError "Unauthorized failure"
+// @Failure 500 {object} utils.APIError
+// @Router /logs/alert_rules [get]
+func (s *Service) GetAlertRules(c *gin.Context) {
+	var rules []*AlertRuleModel
+	if err := s.db.Order("name").Find(&rules).Error; err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, rules)
+}
+
+// @Summary Save a log search alert rule, the one with the same name is replaced
+// @Param request body SaveAlertRuleRequest true "Request body"
+// @Security JwtAuth
+// @Success 200 {object} AlertRuleModel
+// @Failure 400 {object} utils.APIError "Bad request"
+// @Failure 401 {object} utils.APIError "Unauthorized failure"
+// @Failure 500 {object} utils.APIError
+// @Router /logs/alert_rules [put]
+func (s *Service) SaveAlertRule(c *gin.Context) {
+	var req SaveAlertRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.MakeInvalidRequestErrorFromError(c, err)
+		return
+	}
+	if err := req.validate(); err != nil {
+		utils.MakeInvalidRequestErrorFromError(c, err)
+		return
+	}
+
+	s.alertMu.Lock()
+	defer s.alertMu.Unlock()
+
+	rule := AlertRuleModel{}
+	err := s.db.Where("name = ?", req.Name).First(&rule).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		_ = c.Error(err)
+		return
+	}
+	rule.Name = req.Name
+	rule.Query = &req.Query
+	rule.Threshold = req.Threshold
+	rule.WebhookURL = req.WebhookURL
+	rule.Enabled = req.Enabled
+	if rule.State == "" {
+		rule.State = AlertRuleStateOK
+	}
+	if err := s.db.Save(&rule).Error; err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, rule)
+}
+
+// @Summary Delete a log search alert rule
+// @Param id path string true "alert rule id"
+// @Security JwtAuth
+// @Success 200 {object} utils.APIEmptyResponse
+// @Failure 401 {object} utils.APIError "Unauthorized failure"
+// @Failure 500 {object} utils.APIError
+// @Router /logs/alert_rules/{id} [delete]
+func (s *Service) DeleteAlertRule(c *gin.Context) {
+	s.alertMu.Lock()
+	defer s.alertMu.Unlock()
+
+	if err := s.db.Where("id = ?", c.Param("id")).Delete(&AlertRuleModel{}).Error; err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, utils.APIEmptyResponse{})
+}
+
+// @Summary Run a log search alert rule immediately, which notifies the webhook if it fires
+// @Param id path string true "alert rule id"
+// @Security JwtAuth
+// @Success 200 {object} AlertRuleModel
+// @Failure 401 {object} utils.APIError "Unauthorized failure"
+// @Failure 400 {object} utils.APIError "Bad request"
+// @Failure 404 {object} utils.APIError "Not found"
+// @Failure 409 {object} utils.APIError "The rule is running"
+// @Failure 500 {object} utils.APIError
+// @Router /logs/alert_rules/{id}/run [post]
+func (s *Service) RunAlertRule(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.MakeInvalidRequestErrorFromError(c, err)
+		return
+	}
+	rule, err := s.runAlertRule(c.Request.Context(), uint(id), time.Now())
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.Status(http.StatusNotFound)
+			err = ErrNotFound.New("alert rule %s does not exist", c.Param("id"))
+		} else if errorx.IsOfType(err, ErrAlertRuleRunning) {
+			c.Status(http.StatusConflict)
+		}
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, rule)
+}
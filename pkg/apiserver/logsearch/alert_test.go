@@ -0,0 +1,107 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logsearch
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/joomcode/errorx"
+	. "github.com/pingcap/check"
+	"gorm.io/gorm"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/model"
+)
+
+var _ = Suite(&testAlertSuite{})
+
+type testAlertSuite struct{}
+
+func (t *testAlertSuite) Test_postWebhook(c *C) {
+	var received AlertPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_ = json.NewDecoder(r.Body).Decode(&received)
+	}))
+	defer server.Close()
+
+	payload := &AlertPayload{RuleID: 1, RuleName: "region unavailable", Matches: 3, Threshold: 2, Samples: []string{"a"}}
+	err := postWebhook(context.Background(), server.Client(), server.URL+"/ok", payload)
+	c.Assert(err, IsNil)
+	c.Assert(received, DeepEquals, *payload)
+
+	err = postWebhook(context.Background(), server.Client(), server.URL+"/fail", payload)
+	c.Assert(errorx.IsOfType(err, ErrWebhookFailed), IsTrue)
+}
+
+func (t *testAlertSuite) Test_validate(c *C) {
+	req := SaveAlertRuleRequest{
+		Name: "test",
+		Query: SavedQuery{
+			Targets:      []model.RequestTargetNode{{Kind: model.NodeKindTiKV, IP: "127.0.0.1", Port: 20160}},
+			Patterns:     []string{"region unavailable"},
+			DurationSecs: 300,
+		},
+		Threshold:  1,
+		WebhookURL: "http://127.0.0.1:9000/alert",
+	}
+	c.Assert(req.validate(), IsNil)
+
+	req.WebhookURL = "ftp://127.0.0.1/alert"
+	c.Assert(req.validate(), NotNil)
+	req.WebhookURL = "http://127.0.0.1:9000/alert"
+	req.Query.DurationSecs = 10
+	c.Assert(req.validate(), NotNil)
+	req.Query.DurationSecs = 300
+	req.Threshold = 0
+	c.Assert(req.validate(), NotNil)
+}
+
+func (t *testAlertSuite) Test_startAlertRule(c *C) {
+	db := newTestDB(c)
+	s := &Service{db: db, alertRunning: make(map[uint]struct{})}
+
+	c.Assert(db.Create(&AlertRuleModel{Name: "test", Threshold: 1, State: AlertRuleStateOK}).Error, IsNil)
+	rule, err := s.startAlertRule(1)
+	c.Assert(err, IsNil)
+	_, err = s.startAlertRule(1)
+	c.Assert(errorx.IsOfType(err, ErrAlertRuleRunning), IsTrue)
+	_, err = s.startAlertRule(2)
+	c.Assert(err, Equals, gorm.ErrRecordNotFound)
+
+	// The rule changed during the run keeps the change, and only the state is saved.
+	c.Assert(db.Model(&AlertRuleModel{}).Where("id = ?", 1).Update("threshold", 5).Error, IsNil)
+	rule.State = AlertRuleStateFiring
+	rule.LastMatches = 3
+	s.finishAlertRule(rule)
+	saved := &AlertRuleModel{}
+	c.Assert(db.First(saved, "id = ?", 1).Error, IsNil)
+	c.Assert(saved.Threshold, Equals, int64(5))
+	c.Assert(saved.State, Equals, AlertRuleStateFiring)
+	c.Assert(saved.LastMatches, Equals, int64(3))
+
+	// The rule deleted during the run is not saved again.
+	rule, err = s.startAlertRule(1)
+	c.Assert(err, IsNil)
+	c.Assert(db.Delete(&AlertRuleModel{}, 1).Error, IsNil)
+	s.finishAlertRule(rule)
+	var count int64
+	c.Assert(db.Model(&AlertRuleModel{}).Count(&count).Error, IsNil)
+	c.Assert(count, Equals, int64(0))
+}
@@ -0,0 +1,236 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logsearch
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/joomcode/errorx"
+	"github.com/pingcap/kvproto/pkg/diagnosticspb"
+	"gorm.io/gorm"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/utils"
+)
+
+const (
+	defaultContextLines = 20
+	maxContextLines     = 200
+	// The lines are searched in the time window around the matched line.
+	contextWindow = time.Minute
+)
+
+type GetContextRequest struct {
+	Lines int `json:"lines" form:"lines"` // number of lines before and after the matched line
+}
+
+type ContextLine struct {
+	Time    int64                  `json:"time"`
+	Level   diagnosticspb.LogLevel `json:"level"`
+	Message string                 `json:"message"`
+}
+
+type ContextResponse struct {
+	Instance string         `json:"instance"`
+	LogType  LogType        `json:"log_type"`
+	Before   []*ContextLine `json:"before"`
+	Line     *ContextLine   `json:"line"`
+	After    []*ContextLine `json:"after"`
+	// Found is false when the matched line is no longer in the log, e.g. the log file is rotated. In this case
+	// the lines are split by the time of the matched line.
+	Found bool `json:"found"`
+}
+
+// contextCollector keeps the last n lines before the matched line and the first n lines after it, so that the
+// memory is bounded no matter how many lines are in the time window.
+type contextCollector struct {
+	n      int
+	anchor *ContextLine
+	resp   *ContextResponse
+}
+
+func newContextCollector(anchor *ContextLine, n int) *contextCollector {
+	return &contextCollector{
+		n:      n,
+		anchor: anchor,
+		resp: &ContextResponse{
+			Before: make([]*ContextLine, 0, n),
+			After:  make([]*ContextLine, 0, n),
+		},
+	}
+}
+
+// add collects the line in time order, and returns true when enough lines are collected.
+func (cc *contextCollector) add(line *ContextLine) bool {
+	if cc.resp.Line == nil {
+		if line.Time == cc.anchor.Time && line.Message == cc.anchor.Message {
+			cc.resp.Line = line
+			cc.resp.Found = true
+			return cc.n == 0
+		}
+		if line.Time <= cc.anchor.Time {
+			if len(cc.resp.Before) == cc.n {
+				if cc.n == 0 {
+					return false
+				}
+				cc.resp.Before = append(cc.resp.Before[1:], line)
+			} else {
+				cc.resp.Before = append(cc.resp.Before, line)
+			}
+			return false
+		}
+		// The matched line is passed without being seen.
+		cc.resp.Line = cc.anchor
+	}
+	if len(cc.resp.After) >= cc.n {
+		return true
+	}
+	cc.resp.After = append(cc.resp.After, line)
+	return len(cc.resp.After) >= cc.n
+}
+
+func (cc *contextCollector) result() *ContextResponse {
+	if cc.resp.Line == nil {
+		cc.resp.Line = cc.anchor
+	}
+	return cc.resp
+}
+
+func pbTargetOf(logType LogType) diagnosticspb.SearchLogRequest_Target {
+	if logType == LogTypeSlow {
+		return diagnosticspb.SearchLogRequest_Slow
+	}
+	return diagnosticspb.SearchLogRequest_Normal
+}
+
+// searchContext searches the lines around the preview line from its instance, without patterns or levels.
+// The TiDB slow log is read from `CLUSTER_SLOW_QUERY` of the instance like when it is collected.
+func (s *Service) searchContext(ctx context.Context, task *TaskModel, preview *PreviewModel, n int) (*ContextResponse, error) {
+	var client diagnosticspb.DiagnosticsClient
+	if isFromSlowQuery(task.Target.Kind, preview.LogType) {
+		db, err := s.openSlowQueryDB()
+		if err != nil {
+			return nil, err
+		}
+		defer utils.CloseTiDBConnection(db) //nolint:errcheck
+		client = &slowQueryLogClient{db: db, instance: instanceKey(task.Target.IP, uint(task.Target.Port))}
+	} else {
+		conn, err := s.dialTarget(task.Target)
+		if err != nil {
+			return nil, err
+		}
+		defer conn.Close()
+		client = diagnosticspb.NewDiagnosticsClient(conn)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	req := &SearchLogRequest{
+		StartTime: preview.Time - contextWindow.Milliseconds(),
+		EndTime:   preview.Time + contextWindow.Milliseconds(),
+	}
+	stream, err := client.SearchLog(ctx, req.ConvertToPB(pbTargetOf(preview.LogType)))
+	if err != nil {
+		return nil, err
+	}
+
+	collector := newContextCollector(&ContextLine{
+		Time:    preview.Time,
+		Level:   preview.Level,
+		Message: preview.Message,
+	}, n)
+	for {
+		res, err := stream.Recv()
+		if err != nil {
+			if err != io.EOF {
+				return nil, err
+			}
+			break
+		}
+		done := false
+		for _, msg := range res.Messages {
+			if collector.add(&ContextLine{Time: msg.Time, Level: msg.Level, Message: msg.Message}) {
+				done = true
+				break
+			}
+		}
+		if done {
+			break
+		}
+	}
+
+	resp := collector.result()
+	resp.Instance = task.Target.DisplayName
+	resp.LogType = preview.LogType
+	return resp, nil
+}
+
+// @Summary Get the lines around a preview line from the same instance
+// @Param id path string true "preview id"
+// @Param q query GetContextRequest true "Query"
+// @Security JwtAuth
+// @Success 200 {object} ContextResponse
+// @Failure 400 {object} utils.APIError "Bad request"
+// @Failure 401 {object} utils.APIError "Unauthorized failure"
+// @Failure 404 {object} utils.APIError "Not found"
+// @Failure 500 {object} utils.APIError
+// @Router /logs/previews/{id}/context [get]
+func (s *Service) GetPreviewContext(c *gin.Context) {
+	var req GetContextRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		utils.MakeInvalidRequestErrorFromError(c, err)
+		return
+	}
+	n := req.Lines
+	if n <= 0 {
+		n = defaultContextLines
+	}
+	if n > maxContextLines {
+		n = maxContextLines
+	}
+
+	var preview PreviewModel
+	if err := s.db.Model(&LineModel{}).First(&preview, "id = ?", c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.Status(http.StatusNotFound)
+			err = ErrNotFound.New("preview %s does not exist", c.Param("id"))
+		}
+		_ = c.Error(err)
+		return
+	}
+	var task TaskModel
+	if err := s.db.First(&task, "id = ?", preview.TaskID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.Status(http.StatusNotFound)
+			err = ErrNotFound.New("task of preview %s does not exist", c.Param("id"))
+		}
+		_ = c.Error(err)
+		return
+	}
+
+	resp, err := s.searchContext(c.Request.Context(), &task, &preview, n)
+	if err != nil {
+		if errorx.IsOfType(err, ErrSlowLogNoAccess) {
+			utils.MakeInvalidRequestErrorFromError(c, err)
+			return
+		}
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
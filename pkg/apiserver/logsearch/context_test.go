@@ -0,0 +1,82 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logsearch
+
+import (
+	"context"
+
+	"github.com/joomcode/errorx"
+	. "github.com/pingcap/check"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/model"
+	"github.com/pingcap/tidb-dashboard/pkg/config"
+)
+
+var _ = Suite(&testContextSuite{})
+
+type testContextSuite struct{}
+
+func collectMessages(cc *contextCollector, lines []*ContextLine) int {
+	for i, line := range lines {
+		if cc.add(line) {
+			return i + 1
+		}
+	}
+	return len(lines)
+}
+
+func messagesOf(lines []*ContextLine) []string {
+	result := make([]string, 0, len(lines))
+	for _, l := range lines {
+		result = append(result, l.Message)
+	}
+	return result
+}
+
+func (t *testContextSuite) Test_contextCollector(c *C) {
+	lines := []*ContextLine{
+		{Time: 1, Message: "a"},
+		{Time: 2, Message: "b"},
+		{Time: 3, Message: "c"},
+		{Time: 3, Message: "match"},
+		{Time: 4, Message: "d"},
+		{Time: 5, Message: "e"},
+		{Time: 6, Message: "f"},
+	}
+
+	cc := newContextCollector(&ContextLine{Time: 3, Message: "match"}, 2)
+	c.Assert(collectMessages(cc, lines), Equals, 6)
+	resp := cc.result()
+	c.Assert(resp.Found, IsTrue)
+	c.Assert(messagesOf(resp.Before), DeepEquals, []string{"b", "c"})
+	c.Assert(resp.Line.Message, Equals, "match")
+	c.Assert(messagesOf(resp.After), DeepEquals, []string{"d", "e"})
+
+	// The matched line is missing.
+	cc = newContextCollector(&ContextLine{Time: 3, Message: "rotated"}, 1)
+	c.Assert(collectMessages(cc, lines), Equals, 5)
+	resp = cc.result()
+	c.Assert(resp.Found, IsFalse)
+	c.Assert(messagesOf(resp.Before), DeepEquals, []string{"match"})
+	c.Assert(resp.Line.Message, Equals, "rotated")
+	c.Assert(messagesOf(resp.After), DeepEquals, []string{"d"})
+}
+
+func (t *testContextSuite) Test_searchContext_slowQuery(c *C) {
+	// The TiDB slow log is never searched from the diagnostics service, which returns the normal log instead.
+	s := &Service{config: &config.Config{}}
+	task := &TaskModel{Target: &model.RequestTargetNode{Kind: model.NodeKindTiDB, IP: "127.0.0.1", Port: 10080}}
+	_, err := s.searchContext(context.Background(), task, &PreviewModel{LogType: LogTypeSlow}, 1)
+	c.Assert(errorx.IsOfType(err, ErrSlowLogNoAccess), IsTrue)
+}
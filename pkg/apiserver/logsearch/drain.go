@@ -0,0 +1,145 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logsearch
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	drainWildcard = "<*>"
+	// The number of leading tokens used to route a message in the parse tree.
+	drainPrefixDepth = 2
+	// The max number of children of a tree node, messages exceeding it are routed into the wildcard child.
+	drainMaxChildren = 100
+	// The min ratio of tokens equal to the template for a message to join a cluster.
+	drainSimilarityThreshold = 0.4
+)
+
+type drainCluster struct {
+	id       int
+	template []string
+}
+
+type drainNode struct {
+	children map[string]*drainNode
+	clusters []*drainCluster
+}
+
+func newDrainNode() *drainNode {
+	return &drainNode{children: make(map[string]*drainNode)}
+}
+
+// drain mines the log templates with the Drain algorithm. Messages are routed in a fixed depth parse tree by
+// the number of tokens and the leading tokens, and then joined into the most similar cluster in the leaf. The
+// tokens of a cluster template differing from the joined message are replaced with wildcards.
+type drain struct {
+	root     *drainNode
+	clusters []*drainCluster
+}
+
+func newDrain() *drain {
+	return &drain{root: newDrainNode()}
+}
+
+func hasDigit(s string) bool {
+	return strings.IndexFunc(s, unicode.IsDigit) >= 0
+}
+
+// maskToken replaces the obvious variables with wildcards before clustering, which are the tokens with digits
+// and the values of `[key=value]` fields.
+func maskToken(token string) string {
+	if strings.HasPrefix(token, "[") && strings.HasSuffix(token, "]") {
+		if idx := strings.IndexByte(token, '='); idx > 0 {
+			return token[:idx+1] + drainWildcard + "]"
+		}
+	}
+	if hasDigit(token) {
+		return drainWildcard
+	}
+	return token
+}
+
+func tokenizeMessage(msg string) []string {
+	tokens := strings.Fields(msg)
+	for i, t := range tokens {
+		tokens[i] = maskToken(t)
+	}
+	return tokens
+}
+
+func (d *drain) childOf(node *drainNode, key string) *drainNode {
+	if child, ok := node.children[key]; ok {
+		return child
+	}
+	if len(node.children) >= drainMaxChildren {
+		key = drainWildcard
+		if child, ok := node.children[key]; ok {
+			return child
+		}
+	}
+	child := newDrainNode()
+	node.children[key] = child
+	return child
+}
+
+func similarity(template, tokens []string) float64 {
+	if len(template) == 0 {
+		return 1
+	}
+	equal := 0
+	for i, t := range template {
+		if t == tokens[i] {
+			equal++
+		}
+	}
+	return float64(equal) / float64(len(template))
+}
+
+// add clusters the message, and returns the id of the cluster it joins.
+func (d *drain) add(msg string) int {
+	tokens := tokenizeMessage(msg)
+
+	node := d.childOf(d.root, strconv.Itoa(len(tokens)))
+	for i := 0; i < drainPrefixDepth && i < len(tokens); i++ {
+		node = d.childOf(node, tokens[i])
+	}
+
+	var best *drainCluster
+	bestSim := -1.0
+	for _, c := range node.clusters {
+		if sim := similarity(c.template, tokens); sim > bestSim {
+			best, bestSim = c, sim
+		}
+	}
+	if best != nil && bestSim >= drainSimilarityThreshold {
+		for i, t := range best.template {
+			if t != tokens[i] {
+				best.template[i] = drainWildcard
+			}
+		}
+		return best.id
+	}
+
+	c := &drainCluster{id: len(d.clusters), template: tokens}
+	d.clusters = append(d.clusters, c)
+	node.clusters = append(node.clusters, c)
+	return c.id
+}
+
+func (d *drain) template(id int) string {
+	return strings.Join(d.clusters[id].template, " ")
+}
@@ -0,0 +1,74 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logsearch
+
+import (
+	. "github.com/pingcap/check"
+	"github.com/pingcap/kvproto/pkg/diagnosticspb"
+)
+
+var _ = Suite(&testDrainSuite{})
+
+type testDrainSuite struct{}
+
+func (t *testDrainSuite) Test_drain(c *C) {
+	d := newDrain()
+	a := d.add(`[peer.rs:100] ["region unavailable"] [region_id=1]`)
+	b := d.add(`[peer.rs:100] ["region unavailable"] [region_id=2]`)
+	c.Assert(a, Equals, b)
+	c.Assert(d.template(a), Equals, `<*> ["region unavailable"] [region_id=<*>]`)
+
+	e := d.add(`[server.go:20] connection from 10.0.0.1 closed`)
+	f := d.add(`[server.go:20] connection from 10.0.0.2 reset`)
+	c.Assert(e, Equals, f)
+	c.Assert(e, Not(Equals), a)
+	c.Assert(d.template(e), Equals, `<*> connection from <*> <*>`)
+
+	g := d.add(`[server.go:30] shutting down server gracefully now`)
+	c.Assert(g, Not(Equals), e)
+}
+
+func (t *testDrainSuite) Test_patternSummarizer(c *C) {
+	s := newPatternSummarizer(0, 59999, 119999)
+	info := diagnosticspb.LogLevel(LogLevelInfo)
+	warn := diagnosticspb.LogLevel(LogLevelWarn)
+	for i := 0; i < 2; i++ {
+		s.add(&patternLine{Time: int64(i), Level: info, Message: "flush memtable done", Instance: "tikv-1"})
+	}
+	for i := 0; i < 10; i++ {
+		s.add(&patternLine{Time: 60000 + int64(i), Level: info, Message: "flush memtable done", Instance: "tikv-2"})
+	}
+	s.add(&patternLine{Time: 60001, Level: warn, Message: "[ERROR] region unavailable 5", Instance: "tikv-1"})
+	s.add(&patternLine{Time: 60002, Level: info, Message: "[ERROR] region unavailable 6", Instance: "tikv-2"})
+	for i := 0; i < 5; i++ {
+		s.add(&patternLine{Time: int64(i), Level: info, Message: "heartbeat ok", Instance: "tikv-1"})
+		s.add(&patternLine{Time: 60000 + int64(i), Level: info, Message: "heartbeat ok", Instance: "tikv-1"})
+	}
+
+	resp := s.summary(2)
+	c.Assert(resp.Patterns, HasLen, 3)
+	flush, unavailable, heartbeat := resp.Patterns[0], resp.Patterns[1], resp.Patterns[2]
+
+	c.Assert(flush.Template, Equals, "flush memtable done")
+	c.Assert(flush.IsIncreased, IsTrue)
+	c.Assert(flush.Instances, DeepEquals, map[string]int{"tikv-1": 2, "tikv-2": 10})
+	c.Assert(flush.Minutes, DeepEquals, []PatternMinuteCount{{Minute: 0, Count: 2}, {Minute: 60000, Count: 10}})
+
+	c.Assert(unavailable.Template, Equals, "[ERROR] region unavailable <*>")
+	c.Assert(unavailable.IsNew, IsTrue)
+	c.Assert(unavailable.Level, Equals, warn)
+
+	c.Assert(heartbeat.IsNew || heartbeat.IsIncreased, IsFalse)
+	c.Assert(heartbeat.Count, Equals, 10)
+}
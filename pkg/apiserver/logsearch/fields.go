@@ -0,0 +1,174 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logsearch
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// LogFields are the key/value pairs in a log message of the unified log format, e.g. `[region_id=1234]`.
+type LogFields map[string]string
+
+func (f *LogFields) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*f = nil
+		return nil
+	case string:
+		return json.Unmarshal([]byte(v), f)
+	case []byte:
+		return json.Unmarshal(v, f)
+	}
+	return fmt.Errorf("unsupported log fields type %T", src)
+}
+
+func (f LogFields) Value() (driver.Value, error) {
+	if len(f) == 0 {
+		return nil, nil
+	}
+	val, err := json.Marshal(f)
+	return string(val), err
+}
+
+// findSegmentEnd returns the index of the `]` closing the segment starting at `start`, or -1 if not found.
+// Brackets inside quoted strings are ignored, and unquoted brackets can be nested.
+func findSegmentEnd(msg string, start int) int {
+	depth := 0
+	inQuote := false
+	for i := start + 1; i < len(msg); i++ {
+		c := msg[i]
+		switch {
+		case inQuote && c == '\\':
+			i++
+		case c == '"':
+			inQuote = !inQuote
+		case inQuote:
+		case c == '[':
+			depth++
+		case c == ']':
+			if depth == 0 {
+				return i
+			}
+			depth--
+		}
+	}
+	return -1
+}
+
+func unquoteField(s string) string {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		if v, err := strconv.Unquote(s); err == nil {
+			return v
+		}
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// splitField splits a segment like `key=value` or `"some key"="some value"`. Segments without a key, like the
+// source location and the quoted message, are not fields.
+func splitField(seg string) (string, string, bool) {
+	var key, rest string
+	if strings.HasPrefix(seg, `"`) {
+		end := findQuoteEnd(seg)
+		if end < 0 || end+1 >= len(seg) || seg[end+1] != '=' {
+			return "", "", false
+		}
+		key, rest = unquoteField(seg[:end+1]), seg[end+2:]
+	} else {
+		idx := strings.IndexByte(seg, '=')
+		if idx <= 0 {
+			return "", "", false
+		}
+		key, rest = seg[:idx], seg[idx+1:]
+		if strings.ContainsAny(key, " \"[]") {
+			return "", "", false
+		}
+	}
+	if key == "" {
+		return "", "", false
+	}
+	return key, unquoteField(rest), true
+}
+
+func findQuoteEnd(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+// parseLogFields extracts the fields in the message of a TiDB, TiKV or PD log line, which follows the unified
+// log format: `[source.go:123] ["message"] [key1=value1] [key2="value 2"]`.
+func parseLogFields(msg string) LogFields {
+	fields := LogFields{}
+	for i := 0; i < len(msg); i++ {
+		if msg[i] != '[' {
+			continue
+		}
+		end := findSegmentEnd(msg, i)
+		if end < 0 {
+			break
+		}
+		if key, value, ok := splitField(msg[i+1 : end]); ok {
+			fields[key] = value
+		}
+		i = end
+	}
+	return fields
+}
+
+// parseFieldFilters parses the filters in the form of `key=value`.
+func parseFieldFilters(filters []string) (LogFields, error) {
+	result := LogFields{}
+	for _, filter := range filters {
+		idx := strings.IndexByte(filter, '=')
+		if idx <= 0 {
+			return nil, fmt.Errorf("invalid field filter %s, expect key=value", filter)
+		}
+		result[filter[:idx]] = filter[idx+1:]
+	}
+	return result, nil
+}
+
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// whereFields filters the rows having all the fields. Fields are stored as JSON objects, in which a key/value pair
+// is always encoded as `"key":"value"` with the quotes inside escaped, so that it can be matched literally.
+func whereFields(query *gorm.DB, column string, fields LogFields) (*gorm.DB, error) {
+	for key, value := range fields {
+		k, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		pattern := "%" + likeEscaper.Replace(string(k)+":"+string(v)) + "%"
+		query = query.Where(column+" LIKE ? ESCAPE '!'", pattern)
+	}
+	return query, nil
+}
@@ -0,0 +1,78 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logsearch
+
+import (
+	"path"
+	"testing"
+
+	. "github.com/pingcap/check"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/pingcap/tidb-dashboard/pkg/dbstore"
+)
+
+func TestT(t *testing.T) {
+	CustomVerboseFlag = true
+	TestingT(t)
+}
+
+// newTestDB returns a migrated local store in the temporary directory of the test.
+func newTestDB(c *C) *dbstore.DB {
+	gormDB, err := gorm.Open(sqlite.Open(path.Join(c.MkDir(), "test.db")), &gorm.Config{})
+	c.Assert(err, IsNil)
+	db := &dbstore.DB{DB: gormDB}
+	c.Assert(autoMigrate(db), IsNil)
+	return db
+}
+
+var _ = Suite(&testFieldsSuite{})
+
+type testFieldsSuite struct{}
+
+func (t *testFieldsSuite) Test_parseLogFields(c *C) {
+	c.Assert(parseLogFields(`[session.go:1234] ["execute sql failed"] [conn_id=5] [txn_start_ts=421] [sql="select \"]\" from t"]`),
+		DeepEquals, LogFields{"conn_id": "5", "txn_start_ts": "421", "sql": `select "]" from t`})
+	c.Assert(parseLogFields(`[peer.rs:100] ["region unavailable"] [region_id=1234] [peers=[id: 1, id: 2]] ["store id"=3]`),
+		DeepEquals, LogFields{"region_id": "1234", "peers": "[id: 1, id: 2]", "store id": "3"})
+	c.Assert(parseLogFields(`plain message without fields`), DeepEquals, LogFields{})
+	c.Assert(parseLogFields(`[broken=1`), DeepEquals, LogFields{})
+}
+
+func (t *testFieldsSuite) Test_whereFields(c *C) {
+	db := newTestDB(c)
+
+	for _, msg := range []string{
+		`["a"] [region_id=1234] [conn_id=5]`,
+		`["b"] [region_id=12345]`,
+		`["c"] [note="region_id=1234"]`,
+		`["d"] [region_id=1234]`,
+	} {
+		c.Assert(db.Create(&LineModel{TaskGroupID: 1, Message: msg, Fields: parseLogFields(msg)}).Error, IsNil)
+	}
+
+	fields, err := parseFieldFilters([]string{"region_id=1234"})
+	c.Assert(err, IsNil)
+	query, err := whereFields(db.Where("task_group_id = ?", 1), "fields", fields)
+	c.Assert(err, IsNil)
+	var lines []LineModel
+	c.Assert(query.Order("id").Find(&lines).Error, IsNil)
+	c.Assert(lines, HasLen, 2)
+	c.Assert(lines[0].Fields, DeepEquals, LogFields{"region_id": "1234", "conn_id": "5"})
+	c.Assert(lines[1].Message, Equals, `["d"] [region_id=1234]`)
+
+	_, err = parseFieldFilters([]string{"region_id"})
+	c.Assert(err, NotNil)
+}
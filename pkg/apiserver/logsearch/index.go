@@ -0,0 +1,213 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logsearch
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pingcap/kvproto/pkg/diagnosticspb"
+
+	"github.com/pingcap/tidb-dashboard/pkg/dbstore"
+)
+
+const (
+	defaultSearchPageSize = 100
+	maxSearchPageSize     = 1000
+
+	legacyPreviewTable = "log_previews"
+)
+
+// LineModel is a collected log line. All lines collected by a task are kept, and the messages are indexed by
+// the full-text search table `log_lines_fts`. The first lines of each task are marked as the preview, instead of
+// being stored again.
+type LineModel struct {
+	ID          uint                   `json:"id" gorm:"primary_key"`
+	TaskID      uint                   `json:"task_id" gorm:"index:line_task"`
+	TaskGroupID uint                   `json:"task_group_id" gorm:"index:line_task_group"`
+	Time        int64                  `json:"time" gorm:"index:line_task_group"`
+	Level       diagnosticspb.LogLevel `json:"level" gorm:"type:integer"`
+	LogType     LogType                `json:"log_type" gorm:"size:16;not null;default:normal"`
+	Message     string                 `json:"message" gorm:"type:text"`
+	Fields      LogFields              `json:"fields" gorm:"type:text"`
+	Preview     bool                   `json:"-" gorm:"not null;default:false"`
+}
+
+func (LineModel) TableName() string {
+	return "log_lines"
+}
+
+// The full-text index is an external content FTS4 table, which does not store the messages again. It is kept in
+// sync with `log_lines` by the triggers, so that deleting the lines also removes them from the index.
+var indexSchema = []string{
+	`CREATE VIRTUAL TABLE IF NOT EXISTS log_lines_fts USING fts4(content="log_lines", message)`,
+	`CREATE TRIGGER IF NOT EXISTS log_lines_ai AFTER INSERT ON log_lines BEGIN
+		INSERT INTO log_lines_fts(docid, message) VALUES (new.id, new.message);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS log_lines_bd BEFORE DELETE ON log_lines BEGIN
+		DELETE FROM log_lines_fts WHERE docid = old.id;
+	END`,
+}
+
+func migrateIndex(db *dbstore.DB) error {
+	if err := db.AutoMigrate(&LineModel{}); err != nil {
+		return err
+	}
+	// The previews were stored in a separate table before they are marked in `log_lines`.
+	if err := db.Migrator().DropTable(legacyPreviewTable); err != nil {
+		return err
+	}
+	for _, stmt := range indexSchema {
+		if err := db.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type SearchRequest struct {
+	Text      string   `json:"text" form:"text"`
+	MinLevel  LogLevel `json:"min_level" form:"min_level"`
+	Instances []string `json:"instances" form:"instances"` // display names of the targets
+	LogTypes  []string `json:"log_types" form:"log_types"` // example: "slow"
+	Fields    []string `json:"fields" form:"fields"`       // example: "region_id=1234"
+	StartTime int64    `json:"start_time" form:"start_time"`
+	EndTime   int64    `json:"end_time" form:"end_time"`
+	Page      int      `json:"page" form:"page"` // starts from 1
+	PageSize  int      `json:"page_size" form:"page_size"`
+}
+
+// Highlight is a matched range in the message, measured in bytes.
+type Highlight struct {
+	Start  int `json:"start"`
+	Length int `json:"length"`
+}
+
+type SearchLine struct {
+	LineModel
+	Instance   string      `json:"instance"`
+	Highlights []Highlight `json:"highlights"`
+}
+
+type SearchResponse struct {
+	Total int64         `json:"total"`
+	Lines []*SearchLine `json:"lines"`
+}
+
+// buildMatchExpr quotes each word of the text as a phrase, so that all words are required and the special
+// characters in the text do not break the full-text query syntax. Double quotes are dropped, since they are not
+// indexed by the tokenizer either.
+func buildMatchExpr(text string) string {
+	words := strings.Fields(strings.ReplaceAll(text, `"`, " "))
+	phrases := make([]string, 0, len(words))
+	for _, w := range words {
+		phrases = append(phrases, `"`+w+`"`)
+	}
+	return strings.Join(phrases, " ")
+}
+
+// parseOffsets parses the result of the FTS4 `offsets()` function, which is a list of integers in the form
+// of `column term byte_offset byte_size`.
+func parseOffsets(offsets string) []Highlight {
+	fields := strings.Fields(offsets)
+	result := make([]Highlight, 0, len(fields)/4)
+	for i := 0; i+3 < len(fields); i += 4 {
+		start, err1 := strconv.Atoi(fields[i+2])
+		length, err2 := strconv.Atoi(fields[i+3])
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		result = append(result, Highlight{Start: start, Length: length})
+	}
+	return result
+}
+
+func searchLines(db *dbstore.DB, taskGroupID uint, req *SearchRequest, fields LogFields) (*SearchResponse, error) {
+	query := db.
+		Table("log_lines AS l").
+		Joins("JOIN log_search_tasks AS t ON t.id = l.task_id").
+		Where("l.task_group_id = ?", taskGroupID)
+
+	matchExpr := buildMatchExpr(req.Text)
+	if matchExpr != "" {
+		query = query.
+			Joins("JOIN log_lines_fts ON log_lines_fts.docid = l.id").
+			Where("log_lines_fts MATCH ?", matchExpr)
+	}
+	if req.MinLevel > LogLevelUnknown {
+		query = query.Where("l.level >= ?", int(req.MinLevel))
+	}
+	if len(req.Instances) > 0 {
+		query = query.Where("t.display_name IN (?)", req.Instances)
+	}
+	if len(req.LogTypes) > 0 {
+		query = query.Where("l.log_type IN (?)", req.LogTypes)
+	}
+	query, err := whereFields(query, "l.fields", fields)
+	if err != nil {
+		return nil, err
+	}
+	if req.StartTime > 0 {
+		query = query.Where("l.time >= ?", req.StartTime)
+	}
+	if req.EndTime > 0 {
+		query = query.Where("l.time <= ?", req.EndTime)
+	}
+
+	resp := &SearchResponse{}
+	if err := query.Count(&resp.Total).Error; err != nil {
+		return nil, err
+	}
+
+	pageSize := req.PageSize
+	if pageSize <= 0 {
+		pageSize = defaultSearchPageSize
+	}
+	if pageSize > maxSearchPageSize {
+		pageSize = maxSearchPageSize
+	}
+	page := req.Page
+	if page <= 0 {
+		page = 1
+	}
+
+	selectStmt := "l.*, t.display_name AS instance"
+	if matchExpr != "" {
+		selectStmt += ", offsets(log_lines_fts) AS offsets"
+	}
+	var rows []struct {
+		LineModel
+		Instance string
+		Offsets  string
+	}
+	err = query.
+		Select(selectStmt).
+		Order("l.time, l.id").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Lines = make([]*SearchLine, 0, len(rows))
+	for _, row := range rows {
+		resp.Lines = append(resp.Lines, &SearchLine{
+			LineModel:  row.LineModel,
+			Instance:   row.Instance,
+			Highlights: parseOffsets(row.Offsets),
+		})
+	}
+	return resp, nil
+}
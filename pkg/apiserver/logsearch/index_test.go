@@ -0,0 +1,124 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logsearch
+
+import (
+	"github.com/pingcap/kvproto/pkg/diagnosticspb"
+
+	. "github.com/pingcap/check"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/model"
+)
+
+var _ = Suite(&testIndexSuite{})
+
+type testIndexSuite struct{}
+
+func (t *testIndexSuite) Test_buildMatchExpr(c *C) {
+	cases := []struct {
+		text   string
+		expect string
+	}{
+		{"", ""},
+		{"   ", ""},
+		{"region", `"region"`},
+		{" region  unavailable ", `"region" "unavailable"`},
+		{`say "hello"`, `"say" "hello"`},
+		{`"`, ""},
+		{"a OR b", `"a" "OR" "b"`},
+		{"-x* NEAR(y)", `"-x*" "NEAR(y)"`},
+	}
+	for _, cs := range cases {
+		c.Assert(buildMatchExpr(cs.text), Equals, cs.expect, Commentf("text: %q", cs.text))
+	}
+}
+
+func (t *testIndexSuite) Test_parseOffsets(c *C) {
+	cases := []struct {
+		offsets string
+		expect  []Highlight
+	}{
+		{"", []Highlight{}},
+		{"0 0 5 6", []Highlight{{Start: 5, Length: 6}}},
+		{"0 0 5 6 0 1 20 3", []Highlight{{Start: 5, Length: 6}, {Start: 20, Length: 3}}},
+		{"0 0 5 6 0 1", []Highlight{{Start: 5, Length: 6}}},
+		{"0 0 x 6 0 1 20 3", []Highlight{{Start: 20, Length: 3}}},
+	}
+	for _, cs := range cases {
+		c.Assert(parseOffsets(cs.offsets), DeepEquals, cs.expect, Commentf("offsets: %q", cs.offsets))
+	}
+}
+
+func (t *testIndexSuite) Test_searchLines(c *C) {
+	db := newTestDB(c)
+
+	tasks := []*TaskModel{
+		{TaskGroupID: 1, Target: &model.RequestTargetNode{DisplayName: "tidb-1"}},
+		{TaskGroupID: 1, Target: &model.RequestTargetNode{DisplayName: "tikv-1"}},
+		{TaskGroupID: 2, Target: &model.RequestTargetNode{DisplayName: "tidb-1"}},
+	}
+	for _, task := range tasks {
+		c.Assert(db.Create(task).Error, IsNil)
+	}
+	info := diagnosticspb.LogLevel(LogLevelInfo)
+	warn := diagnosticspb.LogLevel(LogLevelWarn)
+	lines := []*LineModel{
+		{TaskID: 1, TaskGroupID: 1, Time: 1, Level: info, LogType: LogTypeNormal, Message: `["connection closed"] [conn_id=5]`},
+		{TaskID: 2, TaskGroupID: 1, Time: 2, Level: warn, LogType: LogTypeNormal, Message: `["region unavailable"] [region_id=1234]`},
+		{TaskID: 2, TaskGroupID: 1, Time: 3, Level: info, LogType: LogTypeSlow, Message: `["slow region scan"] [region_id=1234]`},
+		{TaskID: 1, TaskGroupID: 1, Time: 4, Level: warn, LogType: LogTypeNormal, Message: `["region miss"] [region_id=99]`},
+		{TaskID: 3, TaskGroupID: 2, Time: 5, Level: warn, LogType: LogTypeNormal, Message: `["region unavailable"] [region_id=1234]`},
+	}
+	for _, line := range lines {
+		line.Fields = parseLogFields(line.Message)
+		c.Assert(db.Create(line).Error, IsNil)
+	}
+
+	cases := []struct {
+		req    SearchRequest
+		fields []string
+		total  int64
+		times  []int64
+	}{
+		{req: SearchRequest{}, total: 4, times: []int64{1, 2, 3, 4}},
+		{req: SearchRequest{Text: "region"}, total: 3, times: []int64{2, 3, 4}},
+		{req: SearchRequest{Text: "region unavailable"}, total: 1, times: []int64{2}},
+		{req: SearchRequest{Text: `"region`}, total: 3, times: []int64{2, 3, 4}},
+		{req: SearchRequest{Text: "nothing"}, total: 0, times: []int64{}},
+		{req: SearchRequest{MinLevel: LogLevelWarn}, total: 2, times: []int64{2, 4}},
+		{req: SearchRequest{Instances: []string{"tidb-1"}}, total: 2, times: []int64{1, 4}},
+		{req: SearchRequest{LogTypes: []string{string(LogTypeSlow)}}, total: 1, times: []int64{3}},
+		{req: SearchRequest{StartTime: 2, EndTime: 3}, total: 2, times: []int64{2, 3}},
+		{req: SearchRequest{Text: "region"}, fields: []string{"region_id=1234"}, total: 2, times: []int64{2, 3}},
+		{req: SearchRequest{Page: 2, PageSize: 3}, total: 4, times: []int64{4}},
+	}
+	for i, cs := range cases {
+		fields, err := parseFieldFilters(cs.fields)
+		c.Assert(err, IsNil)
+		resp, err := searchLines(db, 1, &cs.req, fields)
+		c.Assert(err, IsNil)
+		c.Assert(resp.Total, Equals, cs.total, Commentf("case %d", i))
+		times := make([]int64, 0, len(resp.Lines))
+		for _, line := range resp.Lines {
+			times = append(times, line.Time)
+		}
+		c.Assert(times, DeepEquals, cs.times, Commentf("case %d", i))
+	}
+
+	resp, err := searchLines(db, 1, &SearchRequest{Text: "unavailable"}, nil)
+	c.Assert(err, IsNil)
+	c.Assert(resp.Lines, HasLen, 1)
+	c.Assert(resp.Lines[0].Instance, Equals, "tikv-1")
+	c.Assert(resp.Lines[0].Highlights, DeepEquals, []Highlight{{Start: 9, Length: 11}})
+}
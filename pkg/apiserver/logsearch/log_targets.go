@@ -0,0 +1,170 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logsearch
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pingcap/kvproto/pkg/diagnosticspb"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/model"
+	"github.com/pingcap/tidb-dashboard/pkg/utils/topology"
+)
+
+// LogType labels the kind of log a line or a file comes from.
+type LogType string
+
+const (
+	LogTypeNormal LogType = "normal"
+	LogTypeSlow   LogType = "slow"
+)
+
+type logTarget struct {
+	logType  LogType
+	pbTarget diagnosticspb.SearchLogRequest_Target
+	// The min version of the component exposing the log, empty for all versions.
+	minVersion string
+	// fromSlowQuery is true if the log is read from `CLUSTER_SLOW_QUERY` instead of the diagnostics service.
+	fromSlowQuery bool
+}
+
+// componentLogTargets are the logs each component exposes through the diagnostics service. TiDB, PD and TiFlash
+// ignore the target of the request and always search the normal log, so only the normal log is requested from
+// them, otherwise the results are duplicated. The slow log of TiDB is read from `CLUSTER_SLOW_QUERY` instead, which
+// requires the TiDB credential of Dashboard.
+var componentLogTargets = map[model.NodeKind][]logTarget{
+	model.NodeKindTiDB: {
+		{logType: LogTypeNormal, pbTarget: diagnosticspb.SearchLogRequest_Normal},
+		{logType: LogTypeSlow, fromSlowQuery: true, minVersion: "4.0.0"},
+	},
+	model.NodeKindTiKV: {
+		{logType: LogTypeNormal, pbTarget: diagnosticspb.SearchLogRequest_Normal},
+		{logType: LogTypeSlow, pbTarget: diagnosticspb.SearchLogRequest_Slow, minVersion: "4.0.0"},
+	},
+	model.NodeKindPD: {
+		{logType: LogTypeNormal, pbTarget: diagnosticspb.SearchLogRequest_Normal},
+	},
+	model.NodeKindTiFlash: {
+		{logType: LogTypeNormal, pbTarget: diagnosticspb.SearchLogRequest_Normal},
+	},
+}
+
+// parseVersion parses versions like `v4.0.10` and `5.0.0-rc-nightly` into numbers. Returns nil if it is not a
+// valid version.
+func parseVersion(version string) []int {
+	// TiDB reports the version like `5.7.25-TiDB-v4.0.0`.
+	if idx := strings.LastIndex(version, "-TiDB-"); idx >= 0 {
+		version = version[idx+len("-TiDB-"):]
+	}
+	version = strings.TrimPrefix(strings.TrimSpace(version), "v")
+	if idx := strings.IndexAny(version, "-+"); idx >= 0 {
+		version = version[:idx]
+	}
+	parts := strings.Split(version, ".")
+	result := make([]int, 0, len(parts))
+	for _, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return nil
+		}
+		result = append(result, n)
+	}
+	return result
+}
+
+// versionAtLeast returns true when the version is unknown, since newer versions are more common.
+func versionAtLeast(version, minVersion string) bool {
+	v, min := parseVersion(version), parseVersion(minVersion)
+	if v == nil || min == nil {
+		return true
+	}
+	for i := 0; i < len(min); i++ {
+		var n int
+		if i < len(v) {
+			n = v[i]
+		}
+		if n != min[i] {
+			return n > min[i]
+		}
+	}
+	return true
+}
+
+// logTargetsOf returns the logs exposed by the component of the version.
+func logTargetsOf(kind model.NodeKind, version string) []logTarget {
+	targets := make([]logTarget, 0)
+	for _, t := range componentLogTargets[kind] {
+		if t.minVersion == "" || versionAtLeast(version, t.minVersion) {
+			targets = append(targets, t)
+		}
+	}
+	if len(targets) == 0 {
+		// Unknown components are assumed to expose the normal log only.
+		targets = append(targets, logTarget{logType: LogTypeNormal, pbTarget: diagnosticspb.SearchLogRequest_Normal})
+	}
+	return targets
+}
+
+// isFromSlowQuery returns true if the log of the component is read from `CLUSTER_SLOW_QUERY`.
+func isFromSlowQuery(kind model.NodeKind, logType LogType) bool {
+	for _, t := range componentLogTargets[kind] {
+		if t.logType == logType {
+			return t.fromSlowQuery
+		}
+	}
+	return false
+}
+
+func instanceKey(ip string, port uint) string {
+	return fmt.Sprintf("%s:%d", ip, port)
+}
+
+// fetchComponentVersions returns the versions of the components, keyed by both the address and the status address.
+// Components failed to fetch are skipped, whose versions are treated as unknown.
+func (s *Service) fetchComponentVersions(ctx context.Context) map[string]string {
+	versions := make(map[string]string)
+	if s.pdClient != nil {
+		if pds, err := topology.FetchPDTopology(s.pdClient); err == nil {
+			for _, i := range pds {
+				versions[instanceKey(i.IP, i.Port)] = i.Version
+			}
+		} else {
+			log.Warn("Failed to fetch PD versions for log search", zap.Error(err))
+		}
+		if tikvs, tiflashes, err := topology.FetchStoreTopology(s.pdClient); err == nil {
+			for _, i := range append(tikvs, tiflashes...) {
+				versions[instanceKey(i.IP, i.Port)] = i.Version
+				versions[instanceKey(i.IP, i.StatusPort)] = i.Version
+			}
+		} else {
+			log.Warn("Failed to fetch store versions for log search", zap.Error(err))
+		}
+	}
+	if s.etcdClient != nil {
+		if tidbs, err := topology.FetchTiDBTopology(ctx, s.etcdClient); err == nil {
+			for _, i := range tidbs {
+				versions[instanceKey(i.IP, i.Port)] = i.Version
+				versions[instanceKey(i.IP, i.StatusPort)] = i.Version
+			}
+		} else {
+			log.Warn("Failed to fetch TiDB versions for log search", zap.Error(err))
+		}
+	}
+	return versions
+}
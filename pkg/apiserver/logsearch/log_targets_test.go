@@ -0,0 +1,55 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logsearch
+
+import (
+	. "github.com/pingcap/check"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/model"
+)
+
+var _ = Suite(&testLogTargetsSuite{})
+
+type testLogTargetsSuite struct{}
+
+func (t *testLogTargetsSuite) Test_versionAtLeast(c *C) {
+	c.Assert(versionAtLeast("v4.0.10", "4.0.0"), IsTrue)
+	c.Assert(versionAtLeast("5.7.25-TiDB-v4.0.0-beta.2", "4.0.0"), IsTrue)
+	c.Assert(versionAtLeast("v3.1.2", "4.0.0"), IsFalse)
+	c.Assert(versionAtLeast("4.0", "4.0.1"), IsFalse)
+	c.Assert(versionAtLeast("5.0.0-rc-nightly", "4.0.0"), IsTrue)
+	c.Assert(versionAtLeast("", "4.0.0"), IsTrue)
+}
+
+func logTypesOf(targets []logTarget) []LogType {
+	result := make([]LogType, 0, len(targets))
+	for _, t := range targets {
+		result = append(result, t.logType)
+	}
+	return result
+}
+
+func (t *testLogTargetsSuite) Test_logTargetsOf(c *C) {
+	c.Assert(logTypesOf(logTargetsOf(model.NodeKindTiKV, "v4.0.8")), DeepEquals, []LogType{LogTypeNormal, LogTypeSlow})
+	c.Assert(logTypesOf(logTargetsOf(model.NodeKindTiKV, "v3.0.0")), DeepEquals, []LogType{LogTypeNormal})
+	c.Assert(logTypesOf(logTargetsOf(model.NodeKindTiDB, "")), DeepEquals, []LogType{LogTypeNormal, LogTypeSlow})
+	c.Assert(logTypesOf(logTargetsOf(model.NodeKindTiDB, "5.7.25-TiDB-v3.0.0")), DeepEquals, []LogType{LogTypeNormal})
+	c.Assert(logTypesOf(logTargetsOf("unknown", "")), DeepEquals, []LogType{LogTypeNormal})
+}
+
+func (t *testLogTargetsSuite) Test_isFromSlowQuery(c *C) {
+	c.Assert(isFromSlowQuery(model.NodeKindTiDB, LogTypeSlow), IsTrue)
+	c.Assert(isFromSlowQuery(model.NodeKindTiDB, LogTypeNormal), IsFalse)
+	c.Assert(isFromSlowQuery(model.NodeKindTiKV, LogTypeSlow), IsFalse)
+}
@@ -106,13 +106,25 @@ func (TaskModel) TableName() string {
 	return "log_search_tasks"
 }
 
+// LogPaths returns the paths of the collected log files.
+func (task *TaskModel) LogPaths() []string {
+	paths := make([]string, 0, 2)
+	for _, p := range []*string{task.LogStorePath, task.SlowLogStorePath} {
+		if p != nil {
+			paths = append(paths, *p)
+		}
+	}
+	return paths
+}
+
 // Note: this function does not save model itself.
 func (task *TaskModel) RemoveDataAndPreview(db *dbstore.DB) {
-	if task.LogStorePath != nil {
-		_ = os.RemoveAll(*task.LogStorePath)
-		task.LogStorePath = nil
+	for _, p := range task.LogPaths() {
+		_ = os.RemoveAll(p)
 	}
-	db.Where("task_id = ?", task.ID).Delete(&PreviewModel{})
+	task.LogStorePath = nil
+	task.SlowLogStorePath = nil
+	db.Where("task_id = ?", task.ID).Delete(&LineModel{})
 }
 
 type TaskGroupModel struct {
@@ -121,6 +133,9 @@ type TaskGroupModel struct {
 	State         TaskGroupState                `json:"state" gorm:"index"`
 	TargetStats   model.RequestTargetStatistics `json:"target_stats" gorm:"embedded;embedded_prefix:target_stats_"`
 	LogStoreDir   *string                       `json:"log_store_dir" gorm:"type:text"`
+	CreatedAt     int64                         `json:"created_at" gorm:"autoCreateTime;not null;default:0;index"`
+	// Truncated is true when the collected logs exceed the size limit and the rest are skipped.
+	Truncated bool `json:"truncated" gorm:"not null;default:false"`
 }
 
 func (TaskGroupModel) TableName() string {
@@ -131,32 +146,105 @@ func (tg *TaskGroupModel) Delete(db *dbstore.DB) {
 	if tg.LogStoreDir != nil {
 		_ = os.RemoveAll(*tg.LogStoreDir)
 	}
-	db.Where("task_group_id = ?", tg.ID).Delete(&PreviewModel{})
+	db.Where("task_group_id = ?", tg.ID).Delete(&LineModel{})
 	db.Where("task_group_id = ?", tg.ID).Delete(&TaskModel{})
 	db.Where("id = ?", tg.ID).Delete(&TaskGroupModel{})
 }
 
+// PreviewModel is a line in the preview of a task group, which is read from the lines marked as the preview in
+// `log_lines`.
 type PreviewModel struct {
-	ID          uint                   `json:"id" grom:"primary_key"`
-	TaskID      uint                   `json:"task_id" gorm:"index:task"`
-	TaskGroupID uint                   `json:"task_group_id" gorm:"index:task_group"`
-	Time        int64                  `json:"time" gorm:"index:task,task_group"`
-	Level       diagnosticspb.LogLevel `json:"level" gorm:"type:integer"`
-	Message     string                 `json:"message" gorm:"type:text"`
+	ID          uint                   `json:"id"`
+	TaskID      uint                   `json:"task_id"`
+	TaskGroupID uint                   `json:"task_group_id"`
+	Time        int64                  `json:"time"`
+	Level       diagnosticspb.LogLevel `json:"level"`
+	LogType     LogType                `json:"log_type"`
+	Message     string                 `json:"message"`
+	Fields      LogFields              `json:"fields"`
 }
 
-func (PreviewModel) TableName() string {
-	return "log_previews"
+// SavedQuery is a reusable search, which searches the logs in the recent duration when it is run.
+type SavedQuery struct {
+	Targets      []model.RequestTargetNode `json:"targets"`
+	MinLevel     LogLevel                  `json:"min_level"`
+	Patterns     []string                  `json:"patterns"`
+	DurationSecs int64                     `json:"duration_secs"`
+}
+
+func (q *SavedQuery) Scan(src interface{}) error {
+	return json.Unmarshal([]byte(src.(string)), q)
+}
+
+func (q *SavedQuery) Value() (driver.Value, error) {
+	val, err := json.Marshal(q)
+	return string(val), err
+}
+
+type SavedQueryModel struct {
+	ID        uint        `json:"id" gorm:"primary_key"`
+	Name      string      `json:"name" gorm:"size:128;uniqueIndex"`
+	Query     *SavedQuery `json:"query" gorm:"type:text"`
+	CreatedAt int64       `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt int64       `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+func (SavedQueryModel) TableName() string {
+	return "log_search_saved_queries"
+}
+
+type AlertRuleState string
+
+const (
+	AlertRuleStateOK     AlertRuleState = "ok"
+	AlertRuleStateFiring AlertRuleState = "firing"
+	AlertRuleStateError  AlertRuleState = "error"
+)
+
+// AlertRuleModel is a query run periodically over the last duration, which notifies the webhook when the number
+// of matched lines reaches the threshold.
+type AlertRuleModel struct {
+	ID         uint        `json:"id" gorm:"primary_key"`
+	Name       string      `json:"name" gorm:"size:128;uniqueIndex"`
+	Query      *SavedQuery `json:"query" gorm:"type:text"`
+	Threshold  int64       `json:"threshold"`
+	WebhookURL string      `json:"webhook_url" gorm:"type:text"`
+	Enabled    bool        `json:"enabled"`
+
+	State       AlertRuleState `json:"state" gorm:"size:16"`
+	LastRunAt   int64          `json:"last_run_at"`
+	LastFiredAt int64          `json:"last_fired_at"`
+	LastMatches int64          `json:"last_matches"`
+	LastError   *string        `json:"last_error" gorm:"type:text"`
+	// The task group of the last firing, which is kept for investigation.
+	LastTaskGroupID uint  `json:"last_task_group_id"`
+	CreatedAt       int64 `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt       int64 `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+func (AlertRuleModel) TableName() string {
+	return "log_search_alert_rules"
 }
 
 func autoMigrate(db *dbstore.DB) error {
-	return db.AutoMigrate(&TaskModel{}, &TaskGroupModel{}, &PreviewModel{})
+	if err := db.AutoMigrate(&TaskModel{}, &TaskGroupModel{}, &SavedQueryModel{}, &AlertRuleModel{}); err != nil {
+		return err
+	}
+	return migrateIndex(db)
 }
 
-func cleanupAllTasks(db *dbstore.DB) {
-	var taskGroups []*TaskGroupModel
-	db.Find(&taskGroups)
-	for _, tg := range taskGroups {
-		tg.Delete(db)
+// cleanupInterruptedTasks marks the tasks running when the dashboard stopped as failed, and keeps the finished ones.
+func cleanupInterruptedTasks(db *dbstore.DB) {
+	var tasks []*TaskModel
+	db.Where("state = ?", TaskStateRunning).Find(&tasks)
+	errStr := "interrupted by restart"
+	for _, task := range tasks {
+		task.RemoveDataAndPreview(db)
+		task.State = TaskStateError
+		task.Error = &errStr
+		db.Save(task)
 	}
+	db.Model(&TaskGroupModel{}).
+		Where("state = ?", TaskGroupStateRunning).
+		Update("state", TaskGroupStateFinished)
 }
@@ -14,8 +14,8 @@
 package logsearch
 
 import (
-	"fmt"
 	"net/http"
+	"path"
 
 	"github.com/gin-gonic/gin"
 	"github.com/pingcap/log"
@@ -25,30 +25,29 @@ import (
 )
 
 func serveTaskForDownload(task *TaskModel, c *gin.Context) {
-	logPath := task.LogStorePath
-	if logPath == nil {
-		logPath = task.SlowLogStorePath
-	}
-	if logPath == nil {
+	logPaths := task.LogPaths()
+	switch len(logPaths) {
+	case 0:
 		utils.MakeInvalidRequestErrorWithMessage(c, "Log is not ready")
 		return
+	case 1:
+		c.FileAttachment(logPaths[0], "logs-"+path.Base(logPaths[0]))
+		return
 	}
-	c.FileAttachment(*logPath, fmt.Sprintf("logs-%s.zip", task.Target.FileName()))
+	// Each type of log is stored in a separate file, which are packed together.
+	serveMultipleTaskForDownload([]*TaskModel{task}, c)
 }
 
 func serveMultipleTaskForDownload(tasks []*TaskModel, c *gin.Context) {
 	filePaths := make([]string, 0, len(tasks))
 	for _, task := range tasks {
-		logPath := task.LogStorePath
-		if logPath == nil {
-			logPath = task.SlowLogStorePath
-		}
-		if logPath == nil {
+		logPaths := task.LogPaths()
+		if len(logPaths) == 0 {
 			c.Status(http.StatusInternalServerError)
 			_ = c.Error(utils.ErrInvalidRequest.New("Some logs are not available"))
 			return
 		}
-		filePaths = append(filePaths, *logPath)
+		filePaths = append(filePaths, logPaths...)
 	}
 
 	c.Writer.Header().Set("Content-type", "application/octet-stream")
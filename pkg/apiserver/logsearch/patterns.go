@@ -0,0 +1,231 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logsearch
+
+import (
+	"sort"
+
+	"github.com/pingcap/kvproto/pkg/diagnosticspb"
+
+	"github.com/pingcap/tidb-dashboard/pkg/dbstore"
+)
+
+const (
+	// The max number of lines to be clustered in the baseline and in the target respectively.
+	patternsMaxLinesPerRange    = 100000
+	defaultPatternIncreaseRatio = 2
+	patternMinuteMillis         = 60 * 1000
+)
+
+type GetPatternsRequest struct {
+	// The baseline time range in milliseconds, which is the first half of the searched time range if not specified.
+	// Lines after the baseline are compared with it.
+	BaselineStartTime int64 `json:"baseline_start_time" form:"baseline_start_time"`
+	BaselineEndTime   int64 `json:"baseline_end_time" form:"baseline_end_time"`
+	// The min ratio of the line rate after the baseline to the one in the baseline, for a pattern to be increased.
+	MinIncreaseRatio float64 `json:"min_increase_ratio" form:"min_increase_ratio"`
+}
+
+type PatternMinuteCount struct {
+	Minute int64 `json:"minute"` // the beginning of the minute in milliseconds
+	Count  int   `json:"count"`
+}
+
+type Pattern struct {
+	Template  string                 `json:"template"`
+	Sample    string                 `json:"sample"`
+	Level     diagnosticspb.LogLevel `json:"level"` // the most severe level of the lines
+	Count     int                    `json:"count"`
+	Instances map[string]int         `json:"instances"`
+	Minutes   []PatternMinuteCount   `json:"minutes"`
+
+	BaselineCount int     `json:"baseline_count"`
+	TargetCount   int     `json:"target_count"`
+	IncreaseRatio float64 `json:"increase_ratio"`
+	IsNew         bool    `json:"is_new"`
+	IsIncreased   bool    `json:"is_increased"`
+
+	minutes map[int64]int
+}
+
+type PatternsResponse struct {
+	BaselineStartTime int64      `json:"baseline_start_time"`
+	BaselineEndTime   int64      `json:"baseline_end_time"`
+	TargetEndTime     int64      `json:"target_end_time"`
+	Truncated         bool       `json:"truncated"` // whether lines exceeding the limit are not clustered
+	Patterns          []*Pattern `json:"patterns"`
+}
+
+type patternLine struct {
+	Time     int64
+	Level    diagnosticspb.LogLevel
+	Message  string
+	Instance string
+}
+
+// patternSummarizer clusters the lines in time order and counts each pattern.
+type patternSummarizer struct {
+	drain    *drain
+	patterns []*Pattern
+	resp     *PatternsResponse
+}
+
+func newPatternSummarizer(baselineStart, baselineEnd, targetEnd int64) *patternSummarizer {
+	return &patternSummarizer{
+		drain: newDrain(),
+		resp: &PatternsResponse{
+			BaselineStartTime: baselineStart,
+			BaselineEndTime:   baselineEnd,
+			TargetEndTime:     targetEnd,
+		},
+	}
+}
+
+func (s *patternSummarizer) add(line *patternLine) {
+	id := s.drain.add(line.Message)
+	if id == len(s.patterns) {
+		s.patterns = append(s.patterns, &Pattern{
+			Sample:    line.Message,
+			Level:     line.Level,
+			Instances: make(map[string]int),
+			minutes:   make(map[int64]int),
+		})
+	}
+	p := s.patterns[id]
+	p.Count++
+	p.Instances[line.Instance]++
+	p.minutes[line.Time-line.Time%patternMinuteMillis]++
+	if levelSeverity(line.Level) > levelSeverity(p.Level) {
+		p.Level = line.Level
+	}
+	switch {
+	case line.Time >= s.resp.BaselineStartTime && line.Time <= s.resp.BaselineEndTime:
+		p.BaselineCount++
+	case line.Time > s.resp.BaselineEndTime && line.Time <= s.resp.TargetEndTime:
+		p.TargetCount++
+	}
+}
+
+// levelSeverity orders the log levels by severity, which is different from the order of their values.
+func levelSeverity(level diagnosticspb.LogLevel) int {
+	switch LogLevel(level) {
+	case LogLevelTrace:
+		return 1
+	case LogLevelDebug:
+		return 2
+	case LogLevelInfo:
+		return 3
+	case LogLevelWarn:
+		return 4
+	case LogLevelError:
+		return 5
+	case LogLevelCritical:
+		return 6
+	}
+	return 0
+}
+
+// summary compares the line rates after the baseline with the ones in the baseline. New and increased patterns
+// come first, and then the others ordered by the number of lines.
+func (s *patternSummarizer) summary(minIncreaseRatio float64) *PatternsResponse {
+	baselineDuration := float64(s.resp.BaselineEndTime - s.resp.BaselineStartTime + 1)
+	targetDuration := float64(s.resp.TargetEndTime - s.resp.BaselineEndTime)
+	canCompare := baselineDuration > 0 && targetDuration > 0
+
+	for id, p := range s.patterns {
+		p.Template = s.drain.template(id)
+		p.Minutes = make([]PatternMinuteCount, 0, len(p.minutes))
+		for minute, count := range p.minutes {
+			p.Minutes = append(p.Minutes, PatternMinuteCount{Minute: minute, Count: count})
+		}
+		sort.Slice(p.Minutes, func(i, j int) bool {
+			return p.Minutes[i].Minute < p.Minutes[j].Minute
+		})
+		if !canCompare {
+			continue
+		}
+		// Counts are smoothed by adding one, so that a pattern rarely appears is not increased sharply.
+		p.IncreaseRatio = (float64(p.TargetCount+1) / targetDuration) / (float64(p.BaselineCount+1) / baselineDuration)
+		p.IsNew = p.BaselineCount == 0 && p.TargetCount > 0
+		p.IsIncreased = !p.IsNew && p.IncreaseRatio >= minIncreaseRatio
+	}
+
+	sort.SliceStable(s.patterns, func(i, j int) bool {
+		pi, pj := s.patterns[i], s.patterns[j]
+		if (pi.IsNew || pi.IsIncreased) != (pj.IsNew || pj.IsIncreased) {
+			return pi.IsNew || pi.IsIncreased
+		}
+		return pi.Count > pj.Count
+	})
+	s.resp.Patterns = s.patterns
+	return s.resp
+}
+
+func summarizePatterns(db *dbstore.DB, taskGroup *TaskGroupModel, req *GetPatternsRequest) (*PatternsResponse, error) {
+	baselineStart, baselineEnd := req.BaselineStartTime, req.BaselineEndTime
+	targetEnd := taskGroup.SearchRequest.EndTime
+	if baselineStart == 0 && baselineEnd == 0 {
+		baselineStart = taskGroup.SearchRequest.StartTime
+		baselineEnd = baselineStart + (targetEnd-baselineStart)/2
+	}
+	minIncreaseRatio := req.MinIncreaseRatio
+	if minIncreaseRatio <= 0 {
+		minIncreaseRatio = defaultPatternIncreaseRatio
+	}
+
+	// The baseline and the target are read separately with their own limits, so that the lines after the baseline
+	// are not truncated by the ones in it.
+	summarizer := newPatternSummarizer(baselineStart, baselineEnd, targetEnd)
+	for _, r := range [][2]int64{{baselineStart, baselineEnd}, {baselineEnd + 1, targetEnd}} {
+		truncated, err := summarizer.addRange(db, taskGroup.ID, r[0], r[1])
+		if err != nil {
+			return nil, err
+		}
+		if truncated {
+			summarizer.resp.Truncated = true
+		}
+	}
+	return summarizer.summary(minIncreaseRatio), nil
+}
+
+// addRange clusters the lines of the task group in the time range in time order. It returns true if the lines
+// exceed `patternsMaxLinesPerRange` and the rest are skipped.
+func (s *patternSummarizer) addRange(db *dbstore.DB, taskGroupID uint, startTime, endTime int64) (bool, error) {
+	rows, err := db.
+		Table("log_lines AS l").
+		Select("l.time, l.level, l.message, t.display_name AS instance").
+		Joins("JOIN log_search_tasks AS t ON t.id = l.task_id").
+		Where("l.task_group_id = ? AND l.time BETWEEN ? AND ?", taskGroupID, startTime, endTime).
+		Order("l.time, l.id").
+		Limit(patternsMaxLinesPerRange + 1).
+		Rows()
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	n := 0
+	for rows.Next() {
+		n++
+		if n > patternsMaxLinesPerRange {
+			return true, nil
+		}
+		var line patternLine
+		if err := rows.Scan(&line.Time, &line.Level, &line.Message, &line.Instance); err != nil {
+			return false, err
+		}
+		s.add(&line)
+	}
+	return false, rows.Err()
+}
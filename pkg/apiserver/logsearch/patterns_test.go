@@ -0,0 +1,57 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logsearch
+
+import (
+	. "github.com/pingcap/check"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/model"
+)
+
+var _ = Suite(&testPatternsSuite{})
+
+type testPatternsSuite struct{}
+
+func (t *testPatternsSuite) Test_summarizePatterns(c *C) {
+	db := newTestDB(c)
+
+	taskGroup := &TaskGroupModel{SearchRequest: &SearchLogRequest{StartTime: 0, EndTime: 4000}}
+	c.Assert(db.Create(taskGroup).Error, IsNil)
+	c.Assert(db.Create(&TaskModel{TaskGroupID: taskGroup.ID, Target: &model.RequestTargetNode{DisplayName: "tidb-1"}}).Error, IsNil)
+	for _, line := range []struct {
+		time    int64
+		message string
+	}{
+		{500, "before the baseline"},
+		{1000, "connection 1 closed"},
+		{1500, "connection 2 closed"},
+		{2500, "connection 3 closed"},
+		{3000, "region 1 unavailable"},
+		{3500, "region 2 unavailable"},
+	} {
+		c.Assert(db.Create(&LineModel{TaskID: 1, TaskGroupID: taskGroup.ID, Time: line.time, Message: line.message}).Error, IsNil)
+	}
+
+	resp, err := summarizePatterns(db, taskGroup, &GetPatternsRequest{BaselineStartTime: 1000, BaselineEndTime: 2000})
+	c.Assert(err, IsNil)
+	c.Assert(resp.Truncated, IsFalse)
+	c.Assert(resp.Patterns, HasLen, 2)
+	c.Assert(resp.Patterns[0].Template, Equals, "region <*> unavailable")
+	c.Assert(resp.Patterns[0].IsNew, IsTrue)
+	c.Assert(resp.Patterns[0].TargetCount, Equals, 2)
+	c.Assert(resp.Patterns[1].Template, Equals, "connection <*> closed")
+	c.Assert(resp.Patterns[1].BaselineCount, Equals, 2)
+	c.Assert(resp.Patterns[1].TargetCount, Equals, 1)
+	c.Assert(resp.Patterns[1].Instances, DeepEquals, map[string]int{"tidb-1": 3})
+}
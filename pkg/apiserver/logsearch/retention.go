@@ -0,0 +1,213 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logsearch
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/utils"
+	"github.com/pingcap/tidb-dashboard/pkg/config"
+	"github.com/pingcap/tidb-dashboard/pkg/dbstore"
+)
+
+const retentionGCInterval = time.Hour
+
+func (s *Service) retentionLoop(ctx context.Context) {
+	cfgCh := s.configManager.NewPushChannel()
+	ticker := time.NewTicker(retentionGCInterval)
+	defer ticker.Stop()
+
+	var cfg *config.LogSearchConfig
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case dc, ok := <-cfgCh:
+			if !ok {
+				return
+			}
+			cfg = &dc.LogSearch
+		case <-ticker.C:
+		}
+		if cfg == nil {
+			continue
+		}
+		if err := gcTaskGroups(s.db, cfg, time.Now()); err != nil {
+			log.Warn("Failed to clean up log search task groups", zap.Error(err))
+		}
+	}
+}
+
+// gcTaskGroups removes the finished task groups older than the retention days, and then removes the oldest ones
+// until the total size of collected logs is within the limit. The local store is vacuumed if any task group is
+// removed, so that the space of the removed lines is released.
+func gcTaskGroups(db *dbstore.DB, cfg *config.LogSearchConfig, now time.Time) error {
+	var expired []*TaskGroupModel
+	err := db.
+		Where("state = ? AND created_at < ?", TaskGroupStateFinished, now.AddDate(0, 0, -int(cfg.RetentionDays)).Unix()).
+		Find(&expired).Error
+	if err != nil {
+		return err
+	}
+	for _, tg := range expired {
+		tg.Delete(db)
+	}
+	removed := len(expired) > 0
+
+	var sizes []struct {
+		ID    uint
+		State TaskGroupState
+		Size  int64
+	}
+	err = db.
+		Table("log_search_task_groups AS g").
+		Select("g.id, g.state, COALESCE(SUM(t.size), 0) AS size").
+		Joins("LEFT JOIN log_search_tasks AS t ON t.task_group_id = g.id").
+		Group("g.id, g.state").
+		Order("g.created_at, g.id").
+		Find(&sizes).Error
+	if err != nil {
+		return err
+	}
+	storage, err := lineStorage(db)
+	if err != nil {
+		return err
+	}
+	var total int64
+	for i := range sizes {
+		sizes[i].Size += storage[sizes[i].ID]
+		total += sizes[i].Size
+	}
+	limit := int64(cfg.RetentionSizeMB) << 20
+	for _, s := range sizes {
+		if total <= limit {
+			break
+		}
+		if s.State != TaskGroupStateFinished {
+			continue
+		}
+		tg := TaskGroupModel{ID: s.ID}
+		if err := db.First(&tg).Error; err != nil {
+			return err
+		}
+		tg.Delete(db)
+		total -= s.Size
+		removed = true
+	}
+
+	if removed {
+		return db.Exec("VACUUM").Error
+	}
+	return nil
+}
+
+// lineStorage returns the bytes of the lines of each task group in the local store. The full-text index is shared
+// by the task groups in proportion to the bytes of their messages.
+func lineStorage(db *dbstore.DB) (map[uint]int64, error) {
+	var rows []struct {
+		TaskGroupID  uint
+		MessageBytes int64
+		LineBytes    int64
+	}
+	err := db.
+		Model(&LineModel{}).
+		Select(`task_group_id,
+			COALESCE(SUM(LENGTH(message)), 0) AS message_bytes,
+			COALESCE(SUM(LENGTH(message) + COALESCE(LENGTH(fields), 0)), 0) AS line_bytes`).
+		Group("task_group_id").
+		Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	var indexBytes int64
+	err = db.
+		Raw(`SELECT
+			(SELECT COALESCE(SUM(LENGTH(block)), 0) FROM log_lines_fts_segments) +
+			(SELECT COALESCE(SUM(LENGTH(root)), 0) FROM log_lines_fts_segdir)`).
+		Row().
+		Scan(&indexBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	var totalMessageBytes int64
+	for _, r := range rows {
+		totalMessageBytes += r.MessageBytes
+	}
+	result := make(map[uint]int64, len(rows))
+	for _, r := range rows {
+		size := r.LineBytes
+		if totalMessageBytes > 0 {
+			size += int64(float64(indexBytes) * float64(r.MessageBytes) / float64(totalMessageBytes))
+		}
+		result[r.TaskGroupID] = size
+	}
+	return result, nil
+}
+
+// logSearchConfig returns the current configurations, or the default ones if the dynamic config is not ready.
+func (s *Service) logSearchConfig() config.LogSearchConfig {
+	dc, err := s.configManager.Get()
+	if err != nil {
+		log.Warn("Failed to get log search config, use the default one", zap.Error(err))
+		dc = &config.DynamicConfig{}
+		dc.Adjust()
+	}
+	return dc.LogSearch
+}
+
+// @Summary Get log search configurations
+// @Success 200 {object} config.LogSearchConfig
+// @Router /logs/config [get]
+// @Security JwtAuth
+// @Failure 401 {object} utils.APIError "Unauthorized failure"
+// @Failure 500 {object} utils.APIError
+func (s *Service) GetConfig(c *gin.Context) {
+	dc, err := s.configManager.Get()
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, dc.LogSearch)
+}
+
+// @Summary Update log search configurations
+// @Param request body config.LogSearchConfig true "Request body"
+// @Success 200 {object} config.LogSearchConfig
+// @Router /logs/config [put]
+// @Security JwtAuth
+// @Failure 400 {object} utils.APIError "Bad request"
+// @Failure 401 {object} utils.APIError "Unauthorized failure"
+// @Failure 500 {object} utils.APIError
+func (s *Service) SetConfig(c *gin.Context) {
+	var req config.LogSearchConfig
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.MakeInvalidRequestErrorFromError(c, err)
+		return
+	}
+	var opt config.DynamicConfigOption = func(dc *config.DynamicConfig) {
+		dc.LogSearch = req
+	}
+	if err := s.configManager.Modify(opt); err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, req)
+}
@@ -0,0 +1,77 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logsearch
+
+import (
+	"time"
+
+	. "github.com/pingcap/check"
+
+	"github.com/pingcap/tidb-dashboard/pkg/config"
+)
+
+var _ = Suite(&testRetentionSuite{})
+
+type testRetentionSuite struct{}
+
+func (t *testRetentionSuite) Test_gcTaskGroups(c *C) {
+	db := newTestDB(c)
+
+	now := time.Now()
+	day := int64(24 * 3600)
+	groups := []struct {
+		state     TaskGroupState
+		createdAt int64
+		size      int64
+	}{
+		{TaskGroupStateFinished, now.Unix() - 10*day, 1},      // expired
+		{TaskGroupStateFinished, now.Unix() - 3*day, 3 << 20}, // the oldest one exceeding the size limit
+		{TaskGroupStateRunning, now.Unix() - 2*day, 3 << 20},  // running ones are kept
+		{TaskGroupStateFinished, now.Unix() - 1*day, 1 << 20},
+		{TaskGroupStateFinished, now.Unix(), 1 << 20},
+	}
+	for _, g := range groups {
+		tg := TaskGroupModel{State: g.state, CreatedAt: g.createdAt}
+		c.Assert(db.Create(&tg).Error, IsNil)
+		c.Assert(db.Create(&TaskModel{TaskGroupID: tg.ID, Size: g.size}).Error, IsNil)
+	}
+
+	cfg := &config.LogSearchConfig{RetentionDays: 7, RetentionSizeMB: 5}
+	c.Assert(gcTaskGroups(db, cfg, now), IsNil)
+
+	var ids []uint
+	c.Assert(db.Model(&TaskGroupModel{}).Order("id").Pluck("id", &ids).Error, IsNil)
+	c.Assert(ids, DeepEquals, []uint{3, 4, 5})
+	var taskCount int64
+	c.Assert(db.Model(&TaskModel{}).Count(&taskCount).Error, IsNil)
+	c.Assert(taskCount, Equals, int64(3))
+}
+
+func (t *testRetentionSuite) Test_lineStorage(c *C) {
+	db := newTestDB(c)
+
+	for i := 0; i < 100; i++ {
+		c.Assert(db.Create(&LineModel{TaskGroupID: 1, Message: "region unavailable"}).Error, IsNil)
+	}
+	for i := 0; i < 300; i++ {
+		c.Assert(db.Create(&LineModel{TaskGroupID: 2, Message: "region unavailable"}).Error, IsNil)
+	}
+
+	storage, err := lineStorage(db)
+	c.Assert(err, IsNil)
+	c.Assert(storage, HasLen, 2)
+	// The lines are counted with their share of the full-text index.
+	c.Assert(storage[1] > 100*int64(len("region unavailable")), IsTrue)
+	c.Assert(storage[2] > 3*storage[1]-3 && storage[2] < 3*storage[1]+3, IsTrue)
+}
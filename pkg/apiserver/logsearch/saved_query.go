@@ -0,0 +1,146 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logsearch
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/utils"
+)
+
+type SaveQueryRequest struct {
+	Name  string     `json:"name" binding:"required"`
+	Query SavedQuery `json:"query"`
+}
+
+func (q *SavedQuery) validate() error {
+	if len(q.Targets) == 0 {
+		return fmt.Errorf("expect at least 1 target")
+	}
+	if q.DurationSecs <= 0 {
+		return fmt.Errorf("expect a positive duration")
+	}
+	if q.MinLevel < LogLevelUnknown || int(q.MinLevel) >= len(PBLogLevelSlice) {
+		return fmt.Errorf("invalid min level")
+	}
+	return nil
+}
+
+func (q *SavedQuery) toCreateTaskGroupRequest(now time.Time) *CreateTaskGroupRequest {
+	endTime := now.UnixNano() / int64(time.Millisecond)
+	return &CreateTaskGroupRequest{
+		Request: SearchLogRequest{
+			StartTime: endTime - q.DurationSecs*1000,
+			EndTime:   endTime,
+			MinLevel:  q.MinLevel,
+			Patterns:  q.Patterns,
+		},
+		Targets: q.Targets,
+	}
+}
+
+// @Summary List saved log search queries
+// @Security JwtAuth
+// @Success 200 {array} SavedQueryModel
+// @Failure 401 {object} utils.APIError "Unauthorized failure"
+// @Failure 500 {object} utils.APIError
+// @Router /logs/saved_queries [get]
+func (s *Service) GetSavedQueries(c *gin.Context) {
+	var queries []*SavedQueryModel
+	if err := s.db.Order("name").Find(&queries).Error; err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, queries)
+}
+
+// @Summary Save a log search query, the one with the same name is replaced
+// @Param request body SaveQueryRequest true "Request body"
+// @Security JwtAuth
+// @Success 200 {object} SavedQueryModel
+// @Failure 400 {object} utils.APIError "Bad request"
+// @Failure 401 {object} utils.APIError "Unauthorized failure"
+// @Failure 500 {object} utils.APIError
+// @Router /logs/saved_queries [put]
+func (s *Service) SaveQuery(c *gin.Context) {
+	var req SaveQueryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.MakeInvalidRequestErrorFromError(c, err)
+		return
+	}
+	if err := req.Query.validate(); err != nil {
+		utils.MakeInvalidRequestErrorFromError(c, err)
+		return
+	}
+
+	query := SavedQueryModel{}
+	err := s.db.Where("name = ?", req.Name).First(&query).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		_ = c.Error(err)
+		return
+	}
+	query.Name = req.Name
+	query.Query = &req.Query
+	if err := s.db.Save(&query).Error; err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, query)
+}
+
+// @Summary Delete a saved log search query
+// @Param id path string true "saved query id"
+// @Security JwtAuth
+// @Success 200 {object} utils.APIEmptyResponse
+// @Failure 401 {object} utils.APIError "Unauthorized failure"
+// @Failure 500 {object} utils.APIError
+// @Router /logs/saved_queries/{id} [delete]
+func (s *Service) DeleteSavedQuery(c *gin.Context) {
+	if err := s.db.Where("id = ?", c.Param("id")).Delete(&SavedQueryModel{}).Error; err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, utils.APIEmptyResponse{})
+}
+
+// @Summary Run a saved log search query over the recent duration
+// @Param id path string true "saved query id"
+// @Security JwtAuth
+// @Success 200 {object} TaskGroupResponse
+// @Failure 401 {object} utils.APIError "Unauthorized failure"
+// @Failure 404 {object} utils.APIError "Not found"
+// @Failure 500 {object} utils.APIError
+// @Router /logs/saved_queries/{id}/run [post]
+func (s *Service) RunSavedQuery(c *gin.Context) {
+	var query SavedQueryModel
+	if err := s.db.First(&query, "id = ?", c.Param("id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.Status(http.StatusNotFound)
+			err = ErrNotFound.New("saved query %s does not exist", c.Param("id"))
+		}
+		_ = c.Error(err)
+		return
+	}
+	resp, err := s.createTaskGroup(query.Query.toCreateTaskGroupRequest(time.Now()))
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
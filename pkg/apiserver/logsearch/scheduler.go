@@ -14,6 +14,7 @@
 package logsearch
 
 import (
+	"context"
 	"sync"
 
 	"github.com/pingcap/log"
@@ -45,12 +46,16 @@ func (s *Scheduler) AsyncStart(taskGroupModel *TaskGroupModel, tasksModel []*Tas
 		previewsLinesPerTask = TaskMaxPreviewLines
 	}
 
+	cfg := s.service.logSearchConfig()
 	taskGroup := &TaskGroup{
 		service:                s.service,
 		model:                  taskGroupModel,
 		tasks:                  nil, // Tasks are created only after successfully adding to the sync map.
 		tasksMu:                sync.Mutex{},
 		maxPreviewLinesPerTask: previewsLinesPerTask,
+		budget:                 newCollectBudget(int64(cfg.TaskGroupSizeLimitMB) << 20),
+		compression:            cfg.Compression,
+		done:                   make(chan struct{}),
 	}
 	_, alreadyRunning := s.runningTaskGroups.LoadOrStore(taskGroup.model.ID, taskGroup)
 	if alreadyRunning {
@@ -63,6 +68,7 @@ func (s *Scheduler) AsyncStart(taskGroupModel *TaskGroupModel, tasksModel []*Tas
 	go func() {
 		taskGroup.SyncRun()
 		s.runningTaskGroups.Delete(taskGroup.model.ID)
+		close(taskGroup.done)
 
 		log.Debug("Scheduler task group finished", zap.Uint("task_group_id", taskGroupModel.ID))
 	}()
@@ -82,3 +88,17 @@ func (s *Scheduler) AsyncAbort(taskGroupID uint) bool {
 	taskGroup.AbortAll()
 	return true
 }
+
+// Wait blocks until the task group is finished, returns immediately if it is not running.
+func (s *Scheduler) Wait(ctx context.Context, taskGroupID uint) error {
+	v, ok := s.runningTaskGroups.Load(taskGroupID)
+	if !ok {
+		return nil
+	}
+	select {
+	case <-v.(*TaskGroup).done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
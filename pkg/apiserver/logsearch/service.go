@@ -15,13 +15,17 @@ package logsearch
 
 import (
 	"context"
-	"io/ioutil"
 	"net/http"
+	"os"
+	"path"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/gin-gonic/gin"
+	"github.com/joomcode/errorx"
 	"github.com/pingcap/log"
+	"go.etcd.io/etcd/clientv3"
 	"go.uber.org/fx"
 	"go.uber.org/zap"
 
@@ -30,6 +34,16 @@ import (
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/utils"
 	"github.com/pingcap/tidb-dashboard/pkg/config"
 	"github.com/pingcap/tidb-dashboard/pkg/dbstore"
+	"github.com/pingcap/tidb-dashboard/pkg/pd"
+	"github.com/pingcap/tidb-dashboard/pkg/tidb"
+)
+
+var (
+	ErrNS               = errorx.NewNamespace("error.api.log_search")
+	ErrWebhookFailed    = ErrNS.NewType("webhook_failed")
+	ErrNotFound         = ErrNS.NewType("not_found")
+	ErrAlertRuleRunning = ErrNS.NewType("alert_rule_running")
+	ErrSlowLogNoAccess  = ErrNS.NewType("slow_log_no_access")
 )
 
 type Service struct {
@@ -37,27 +51,49 @@ type Service struct {
 	lifecycleCtx context.Context
 
 	config            *config.Config
+	configManager     *config.DynamicConfigManager
+	pdClient          *pd.Client
+	etcdClient        *clientv3.Client
+	tidbClient        *tidb.Client
 	logStoreDirectory string
 	db                *dbstore.DB
 	scheduler         *Scheduler
+	wg                sync.WaitGroup
+	alertMu           sync.Mutex
+	alertRunning      map[uint]struct{} // the alert rules being run, guarded by alertMu
+	webhookClient     *http.Client
 }
 
-func NewService(lc fx.Lifecycle, config *config.Config, db *dbstore.DB) *Service {
-	dir, err := ioutil.TempDir("", "dashboard-logs")
-	if err != nil {
+func NewService(
+	lc fx.Lifecycle,
+	config *config.Config,
+	configManager *config.DynamicConfigManager,
+	pdClient *pd.Client,
+	etcdClient *clientv3.Client,
+	tidbClient *tidb.Client,
+	db *dbstore.DB,
+) *Service {
+	dir := path.Join(config.DataDir, "logs")
+	if err := os.MkdirAll(dir, 0777); err != nil {
 		log.Fatal("Failed to create directory for storing logs", zap.Error(err))
 	}
-	err = autoMigrate(db)
+	err := autoMigrate(db)
 	if err != nil {
 		log.Fatal("Failed to initialize database", zap.Error(err))
 	}
-	cleanupAllTasks(db)
+	cleanupInterruptedTasks(db)
 
 	service := &Service{
 		config:            config,
+		configManager:     configManager,
+		pdClient:          pdClient,
+		etcdClient:        etcdClient,
+		tidbClient:        tidbClient,
 		logStoreDirectory: dir,
 		db:                db,
 		scheduler:         nil, // will be filled after scheduler is created
+		alertRunning:      make(map[uint]struct{}),
+		webhookClient:     &http.Client{Timeout: webhookTimeout},
 	}
 	scheduler := NewScheduler(service)
 	service.scheduler = scheduler
@@ -65,6 +101,20 @@ func NewService(lc fx.Lifecycle, config *config.Config, db *dbstore.DB) *Service
 	lc.Append(fx.Hook{
 		OnStart: func(ctx context.Context) error {
 			service.lifecycleCtx = ctx
+			service.wg.Add(1)
+			go func() {
+				defer service.wg.Done()
+				service.retentionLoop(ctx)
+			}()
+			service.wg.Add(1)
+			go func() {
+				defer service.wg.Done()
+				service.alertLoop(ctx)
+			}()
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			service.wg.Wait()
 			return nil
 		},
 	})
@@ -76,16 +126,32 @@ func RegisterRouter(r *gin.RouterGroup, auth *user.AuthService, s *Service) {
 	endpoint := r.Group("/logs")
 	{
 		endpoint.GET("/download", s.DownloadLogs)
+		endpoint.GET("/tail", s.TailLogs)
 		endpoint.Use(auth.MWAuthRequired())
 		{
 			endpoint.GET("/download/acquire_token", s.GetDownloadToken)
+			endpoint.POST("/tail/acquire_token", s.GetTailToken)
 			endpoint.PUT("/taskgroup", s.CreateTaskGroup)
 			endpoint.GET("/taskgroups", s.GetAllTaskGroups)
 			endpoint.GET("/taskgroups/:id", s.GetTaskGroup)
 			endpoint.GET("/taskgroups/:id/preview", s.GetTaskGroupPreview)
+			endpoint.GET("/taskgroups/:id/search", s.SearchTaskGroup)
+			endpoint.GET("/taskgroups/:id/patterns", s.GetTaskGroupPatterns)
+			endpoint.GET("/previews/:id/context", s.GetPreviewContext)
 			endpoint.POST("/taskgroups/:id/retry", s.RetryTask)
 			endpoint.POST("/taskgroups/:id/cancel", s.CancelTask)
 			endpoint.DELETE("/taskgroups/:id", s.DeleteTaskGroup)
+			endpoint.GET("/config", s.GetConfig)
+			endpoint.PUT("/config", s.SetConfig)
+			endpoint.GET("/saved_queries", s.GetSavedQueries)
+			endpoint.PUT("/saved_queries", s.SaveQuery)
+			endpoint.DELETE("/saved_queries/:id", s.DeleteSavedQuery)
+			endpoint.POST("/saved_queries/:id/run", s.RunSavedQuery)
+			endpoint.GET("/alert_rules", s.GetAlertRules)
+			endpoint.PUT("/alert_rules", s.SaveAlertRule)
+			endpoint.DELETE("/alert_rules/:id", s.DeleteAlertRule)
+			endpoint.POST("/alert_rules/:id/run", s.RunAlertRule)
+			endpoint.POST("/trace", utils.MWConnectTiDB(s.tidbClient), s.Trace)
 		}
 	}
 }
@@ -101,6 +167,7 @@ type TaskGroupResponse struct {
 }
 
 // @Summary Create and run a new log search task group
+// @Description The slow log of TiDB is read from CLUSTER_SLOW_QUERY with the TiDB credential of Dashboard, and is skipped if the credential is not configured.
 // @Param request body CreateTaskGroupRequest true "Request body"
 // @Security JwtAuth
 // @Success 200 {object} TaskGroupResponse
@@ -118,6 +185,15 @@ func (s *Service) CreateTaskGroup(c *gin.Context) {
 		utils.MakeInvalidRequestErrorWithMessage(c, "Expect at least 1 target")
 		return
 	}
+	resp, err := s.createTaskGroup(&req)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func (s *Service) createTaskGroup(req *CreateTaskGroupRequest) (*TaskGroupResponse, error) {
 	stats := model.NewRequestTargetStatisticsFromArray(&req.Targets)
 	taskGroup := TaskGroupModel{
 		SearchRequest: &req.Request,
@@ -125,8 +201,7 @@ func (s *Service) CreateTaskGroup(c *gin.Context) {
 		TargetStats:   stats,
 	}
 	if err := s.db.Create(&taskGroup).Error; err != nil {
-		_ = c.Error(err)
-		return
+		return nil, err
 	}
 	tasks := make([]*TaskModel, 0, len(req.Targets))
 	for _, t := range req.Targets {
@@ -143,11 +218,10 @@ func (s *Service) CreateTaskGroup(c *gin.Context) {
 	if !s.scheduler.AsyncStart(&taskGroup, tasks) {
 		log.Error("Failed to start task group", zap.Uint("task_group_id", taskGroup.ID))
 	}
-	resp := TaskGroupResponse{
+	return &TaskGroupResponse{
 		TaskGroup: taskGroup,
 		Tasks:     tasks,
-	}
-	c.JSON(http.StatusOK, resp)
+	}, nil
 }
 
 // @Summary List all log search task groups
@@ -197,16 +271,27 @@ func (s *Service) GetTaskGroup(c *gin.Context) {
 
 // @Summary Preview a log search task group
 // @Param id path string true "task group id"
+// @Param fields query []string false "fields filter, e.g. region_id=1234" collectionFormat(multi)
 // @Security JwtAuth
 // @Success 200 {array} PreviewModel
+// @Failure 400 {object} utils.APIError "Bad request"
 // @Failure 401 {object} utils.APIError "Unauthorized failure"
 // @Failure 500 {object} utils.APIError
 // @Router /logs/taskgroups/{id}/preview [get]
 func (s *Service) GetTaskGroupPreview(c *gin.Context) {
 	taskGroupID := c.Param("id")
+	fields, err := parseFieldFilters(c.QueryArray("fields"))
+	if err != nil {
+		utils.MakeInvalidRequestErrorFromError(c, err)
+		return
+	}
+	query, err := whereFields(s.db.Model(&LineModel{}).Where("task_group_id = ? AND preview", taskGroupID), "fields", fields)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
 	var lines []PreviewModel
-	err := s.db.
-		Where("task_group_id = ?", taskGroupID).
+	err = query.
 		Order("time").
 		Limit(TaskMaxPreviewLines).
 		Find(&lines).Error
@@ -217,6 +302,68 @@ func (s *Service) GetTaskGroupPreview(c *gin.Context) {
 	c.JSON(http.StatusOK, lines)
 }
 
+// @Summary Search the collected lines of a log search task group
+// @Param id path string true "task group id"
+// @Param q query SearchRequest true "Query"
+// @Security JwtAuth
+// @Success 200 {object} SearchResponse
+// @Failure 400 {object} utils.APIError "Bad request"
+// @Failure 401 {object} utils.APIError "Unauthorized failure"
+// @Failure 500 {object} utils.APIError
+// @Router /logs/taskgroups/{id}/search [get]
+func (s *Service) SearchTaskGroup(c *gin.Context) {
+	taskGroupID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		utils.MakeInvalidRequestErrorFromError(c, err)
+		return
+	}
+	var req SearchRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		utils.MakeInvalidRequestErrorFromError(c, err)
+		return
+	}
+	fields, err := parseFieldFilters(req.Fields)
+	if err != nil {
+		utils.MakeInvalidRequestErrorFromError(c, err)
+		return
+	}
+	resp, err := searchLines(s.db, uint(taskGroupID), &req, fields)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// @Summary Summarize the collected lines of a log search task group into patterns
+// @Description Patterns new or sharply increased after the baseline time range are highlighted.
+// @Param id path string true "task group id"
+// @Param q query GetPatternsRequest true "Query"
+// @Security JwtAuth
+// @Success 200 {object} PatternsResponse
+// @Failure 400 {object} utils.APIError "Bad request"
+// @Failure 401 {object} utils.APIError "Unauthorized failure"
+// @Failure 500 {object} utils.APIError
+// @Router /logs/taskgroups/{id}/patterns [get]
+func (s *Service) GetTaskGroupPatterns(c *gin.Context) {
+	var req GetPatternsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		utils.MakeInvalidRequestErrorFromError(c, err)
+		return
+	}
+	var taskGroup TaskGroupModel
+	if err := s.db.First(&taskGroup, "id = ?", c.Param("id")).Error; err != nil {
+		_ = c.Error(err)
+		return
+	}
+	resp, err := summarizePatterns(s.db, &taskGroup, &req)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
 // @Summary Retry failed tasks in a log search task group
 // @Param id path string true "task group id"
 // @Security JwtAuth
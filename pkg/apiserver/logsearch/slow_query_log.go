@@ -0,0 +1,187 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logsearch
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+
+	"github.com/joomcode/errorx"
+	"github.com/pingcap/kvproto/pkg/diagnosticspb"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"gorm.io/gorm"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/utils"
+)
+
+const slowQueryLogBatchSize = 64
+
+// slowQueryLogRow is a row of `CLUSTER_SLOW_QUERY` read as a slow log line.
+type slowQueryLogRow struct {
+	Time       int64   `gorm:"column:time_ms"` // unix millisecond
+	ConnID     string  `gorm:"column:Conn_ID"`
+	TxnStartTS string  `gorm:"column:Txn_start_ts"`
+	QueryTime  float64 `gorm:"column:Query_time"`
+	DB         string  `gorm:"column:DB"`
+	Digest     string  `gorm:"column:Digest"`
+	Query      string  `gorm:"column:Query"`
+}
+
+// message formats the row in the unified log format, so that its fields can be filtered like other logs.
+func (r *slowQueryLogRow) message() string {
+	return fmt.Sprintf(`["slow query"] [conn_id=%s] [txn_start_ts=%s] [query_time=%s] [db=%s] [digest=%s] [sql=%s]`,
+		r.ConnID, r.TxnStartTS, strconv.FormatFloat(r.QueryTime, 'f', -1, 64), r.DB, r.Digest, strconv.Quote(r.Query))
+}
+
+// slowQueryLogClient serves the slow log of a TiDB instance from `CLUSTER_SLOW_QUERY`, since TiDB does not expose
+// its slow log through the diagnostics service.
+type slowQueryLogClient struct {
+	diagnosticspb.DiagnosticsClient
+	db       *gorm.DB
+	instance string // the status address, which is the `INSTANCE` column
+}
+
+func (c *slowQueryLogClient) SearchLog(ctx context.Context, in *diagnosticspb.SearchLogRequest, _ ...grpc.CallOption) (diagnosticspb.Diagnostics_SearchLogClient, error) {
+	filter, err := newSlowQueryLogFilter(in)
+	if err != nil {
+		return nil, err
+	}
+	if !filter.levelOK {
+		return &slowQueryLogStream{}, nil
+	}
+	rows, err := c.db.WithContext(ctx).
+		Table(traceSlowQueryTable).
+		Select("FLOOR(UNIX_TIMESTAMP(Time) * 1000) AS time_ms, Conn_ID, Txn_start_ts, Query_time, DB, Digest, Query").
+		Where("INSTANCE = ?", c.instance).
+		Where("Time BETWEEN FROM_UNIXTIME(?) AND FROM_UNIXTIME(?)", in.StartTime/1000, (in.EndTime+999)/1000).
+		Order("Time").
+		Rows()
+	if err != nil {
+		return nil, err
+	}
+	return &slowQueryLogStream{db: c.db, rows: rows, filter: filter}, nil
+}
+
+// slowQueryLogFilter matches the lines like the diagnostics service, that is all the patterns must match.
+type slowQueryLogFilter struct {
+	startTime int64
+	endTime   int64
+	levelOK   bool
+	patterns  []*regexp.Regexp
+}
+
+// slowQueryLogLevel is the level of the slow log lines, which have no level in TiDB.
+const slowQueryLogLevel = diagnosticspb.LogLevel_Warn
+
+func newSlowQueryLogFilter(in *diagnosticspb.SearchLogRequest) (*slowQueryLogFilter, error) {
+	f := &slowQueryLogFilter{startTime: in.StartTime, endTime: in.EndTime, levelOK: len(in.Levels) == 0}
+	for _, level := range in.Levels {
+		if level == slowQueryLogLevel {
+			f.levelOK = true
+		}
+	}
+	for _, p := range in.Patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, err
+		}
+		f.patterns = append(f.patterns, re)
+	}
+	return f, nil
+}
+
+func (f *slowQueryLogFilter) match(msg *diagnosticspb.LogMessage) bool {
+	if !f.levelOK || msg.Time < f.startTime || msg.Time > f.endTime {
+		return false
+	}
+	for _, re := range f.patterns {
+		if !re.MatchString(msg.Message) {
+			return false
+		}
+	}
+	return true
+}
+
+type slowQueryLogStream struct {
+	grpc.ClientStream
+	db     *gorm.DB
+	rows   *sql.Rows // nil if nothing to read
+	filter *slowQueryLogFilter
+}
+
+// Recv returns the matched lines in batches, and io.EOF after all the rows are read.
+func (s *slowQueryLogStream) Recv() (*diagnosticspb.SearchLogResponse, error) {
+	if s.rows == nil {
+		return nil, io.EOF
+	}
+	messages := make([]*diagnosticspb.LogMessage, 0, slowQueryLogBatchSize)
+	for len(messages) < slowQueryLogBatchSize && s.rows.Next() {
+		var row slowQueryLogRow
+		if err := s.db.ScanRows(s.rows, &row); err != nil {
+			s.close()
+			return nil, err
+		}
+		msg := &diagnosticspb.LogMessage{Time: row.Time, Level: slowQueryLogLevel, Message: row.message()}
+		if s.filter.match(msg) {
+			messages = append(messages, msg)
+		}
+	}
+	if len(messages) > 0 {
+		return &diagnosticspb.SearchLogResponse{Messages: messages}, nil
+	}
+	err := s.rows.Err()
+	s.close()
+	if err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+func (s *slowQueryLogStream) close() {
+	_ = s.rows.Close()
+	s.rows = nil
+}
+
+// openSlowQueryDB connects to TiDB with the TiDB credential of Dashboard to read the slow log.
+func (s *Service) openSlowQueryDB() (*gorm.DB, error) {
+	if s.config.TiDBServiceUser == "" || s.tidbClient == nil {
+		return nil, ErrSlowLogNoAccess.New("the TiDB credential of Dashboard is not configured")
+	}
+	return s.tidbClient.OpenSQLConn(s.config.TiDBServiceUser, s.config.TiDBServicePassword)
+}
+
+// searchSlowQueryLog collects the TiDB slow log with the TiDB credential of Dashboard. It is skipped if the
+// credential is not configured or the connection fails, so that the collected normal log is kept.
+func (t *Task) searchSlowQueryLog() {
+	if t.model.Error != nil {
+		return
+	}
+	db, err := t.taskGroup.service.openSlowQueryDB()
+	if err != nil {
+		if !errorx.IsOfType(err, ErrSlowLogNoAccess) {
+			log.Warn("Failed to connect to TiDB for the slow log", zap.Any("task", t), zap.Error(err))
+		}
+		return
+	}
+	defer utils.CloseTiDBConnection(db) //nolint:errcheck
+
+	client := &slowQueryLogClient{db: db, instance: instanceKey(t.model.Target.IP, uint(t.model.Target.Port))}
+	t.searchLog(client, LogTypeSlow, diagnosticspb.SearchLogRequest_Slow)
+}
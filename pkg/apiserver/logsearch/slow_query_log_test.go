@@ -0,0 +1,55 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logsearch
+
+import (
+	. "github.com/pingcap/check"
+	"github.com/pingcap/kvproto/pkg/diagnosticspb"
+)
+
+var _ = Suite(&testSlowQueryLogSuite{})
+
+type testSlowQueryLogSuite struct{}
+
+func (t *testSlowQueryLogSuite) Test_message(c *C) {
+	row := &slowQueryLogRow{
+		ConnID:     "5",
+		TxnStartTS: "425",
+		QueryTime:  1.5,
+		DB:         "test",
+		Digest:     "abc",
+		Query:      `select "a] [b"`,
+	}
+	fields := parseLogFields(row.message())
+	c.Assert(fields["conn_id"], Equals, "5")
+	c.Assert(fields["txn_start_ts"], Equals, "425")
+	c.Assert(fields["query_time"], Equals, "1.5")
+	c.Assert(fields["digest"], Equals, "abc")
+	c.Assert(fields["sql"], Equals, `select "a] [b"`)
+}
+
+func (t *testSlowQueryLogSuite) Test_slowQueryLogFilter(c *C) {
+	req := newPBSearchRequest(&SearchLogRequest{StartTime: 1000, EndTime: 2000, Patterns: []string{"SELECT", "conn_id=5"}}, diagnosticspb.SearchLogRequest_Slow)
+	f, err := newSlowQueryLogFilter(req)
+	c.Assert(err, IsNil)
+	c.Assert(f.levelOK, IsTrue)
+	c.Assert(f.match(&diagnosticspb.LogMessage{Time: 1500, Message: "[conn_id=5] [sql=select 1]"}), IsTrue)
+	c.Assert(f.match(&diagnosticspb.LogMessage{Time: 1500, Message: "[conn_id=6] [sql=select 1]"}), IsFalse)
+	c.Assert(f.match(&diagnosticspb.LogMessage{Time: 2001, Message: "[conn_id=5] [sql=select 1]"}), IsFalse)
+
+	req = newPBSearchRequest(&SearchLogRequest{MinLevel: LogLevelError}, diagnosticspb.SearchLogRequest_Slow)
+	f, err = newSlowQueryLogFilter(req)
+	c.Assert(err, IsNil)
+	c.Assert(f.levelOK, IsFalse)
+}
@@ -0,0 +1,349 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logsearch
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pingcap/kvproto/pkg/diagnosticspb"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/model"
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/utils"
+)
+
+const (
+	tailTokenIssuer = "logs/tail"
+	tailInterval    = 2 * time.Second
+	// Lines are flushed into the log files with a delay, so the window is moved behind the current time.
+	tailLag = time.Second
+	// Lines flushed later than the lag are caught by searching the window before the last poll again.
+	tailLateWindow = 5 * time.Second
+	// The max number of new lines returned from a target in each poll, to avoid flooding the client. The rest
+	// are returned in the next polls.
+	tailMaxLinesPerPoll = 1000
+	// The lines older than the backlog are dropped, if a target produces lines faster than they can be sent.
+	tailMaxBacklog = 30 * time.Second
+)
+
+type TailRequest struct {
+	MinLevel LogLevel                  `json:"min_level"`
+	Patterns []string                  `json:"patterns"`
+	Targets  []model.RequestTargetNode `json:"targets" binding:"required"`
+}
+
+type TailLine struct {
+	Instance string                 `json:"instance"`
+	Kind     model.NodeKind         `json:"kind"`
+	Time     int64                  `json:"time"`
+	Level    diagnosticspb.LogLevel `json:"level"`
+	Message  string                 `json:"message"`
+}
+
+// TargetError is the failure of searching the logs of an instance, which is reported in both tailing and tracing.
+type TargetError struct {
+	Instance string `json:"instance"`
+	Error    string `json:"error"`
+	// Truncated is true when the lines of the instance exceed the limit and the rest are skipped.
+	Truncated bool `json:"truncated"`
+}
+
+// TailDropped is the time range in which the lines of the instance may be dropped, since they are produced faster
+// than they can be sent.
+type TailDropped struct {
+	Instance  string `json:"instance"`
+	StartTime int64  `json:"start_time"`
+	EndTime   int64  `json:"end_time"`
+}
+
+// tailLineKey identifies the sent lines. Identical lines in the same millisecond are only sent once.
+type tailLineKey struct {
+	time    int64
+	level   diagnosticspb.LogLevel
+	message string
+}
+
+type tailTarget struct {
+	node   model.RequestTargetNode
+	client diagnosticspb.DiagnosticsClient
+
+	// The states below are only used by the polls of tailing.
+	since int64                    // the start time of the next poll
+	floor int64                    // the time the tailing starts, lines before it are never sent
+	sent  map[tailLineKey]struct{} // the lines sent in the late window, which is searched again
+}
+
+func newTailTarget(node model.RequestTargetNode, client diagnosticspb.DiagnosticsClient, since int64) *tailTarget {
+	return &tailTarget{
+		node:   node,
+		client: client,
+		since:  since,
+		floor:  since,
+		sent:   make(map[tailLineKey]struct{}),
+	}
+}
+
+// search returns the lines of the target in the time range of the request, except the sent ones. The search stops
+// when the lines reach `tailMaxLinesPerPoll`, and the second result is true if so.
+func (t *tailTarget) search(ctx context.Context, req *SearchLogRequest) ([]*TailLine, bool, *TargetError) {
+	stream, err := t.client.SearchLog(ctx, newPBSearchRequest(req, diagnosticspb.SearchLogRequest_Normal))
+	if err != nil {
+		return nil, false, &TargetError{Instance: t.node.DisplayName, Error: err.Error()}
+	}
+	lines := make([]*TailLine, 0)
+	for {
+		res, err := stream.Recv()
+		if err != nil {
+			if err != io.EOF {
+				return lines, false, &TargetError{Instance: t.node.DisplayName, Error: err.Error()}
+			}
+			return lines, false, nil
+		}
+		for _, msg := range res.Messages {
+			if _, ok := t.sent[tailLineKey{msg.Time, msg.Level, msg.Message}]; ok {
+				continue
+			}
+			if len(lines) >= tailMaxLinesPerPoll {
+				return lines, true, nil
+			}
+			lines = append(lines, &TailLine{
+				Instance: t.node.DisplayName,
+				Kind:     t.node.Kind,
+				Time:     msg.Time,
+				Level:    msg.Level,
+				Message:  msg.Message,
+			})
+		}
+	}
+}
+
+// poll returns the new lines since the last poll until the end time. If the lines are truncated, the next poll
+// continues from the last returned one. If the poll fails, the next poll searches the same range again.
+func (t *tailTarget) poll(ctx context.Context, req *SearchLogRequest, endTime int64) ([]*TailLine, *TailDropped, *TargetError) {
+	var dropped *TailDropped
+	if backlogStart := endTime - tailMaxBacklog.Milliseconds(); t.since < backlogStart {
+		dropped = &TailDropped{Instance: t.node.DisplayName, StartTime: t.since, EndTime: backlogStart - 1}
+		t.since = backlogStart
+	}
+
+	r := *req
+	r.StartTime = t.since - tailLateWindow.Milliseconds()
+	if r.StartTime < t.floor {
+		r.StartTime = t.floor
+	}
+	r.EndTime = endTime
+	lines, truncated, err := t.search(ctx, &r)
+	for _, line := range lines {
+		t.sent[tailLineKey{line.Time, line.Level, line.Message}] = struct{}{}
+	}
+	if err != nil {
+		return lines, dropped, err
+	}
+
+	if !truncated {
+		t.since = endTime + 1
+	} else if last := lines[len(lines)-1].Time; last > t.since {
+		// The lines in the same millisecond as the last one are searched again, and the sent ones are skipped.
+		t.since = last
+	}
+	lateStart := t.since - tailLateWindow.Milliseconds()
+	for key := range t.sent {
+		if key.time < lateStart {
+			delete(t.sent, key)
+		}
+	}
+	return lines, dropped, nil
+}
+
+// forEachTarget calls the function for all targets concurrently.
+func forEachTarget(targets []*tailTarget, fn func(target *tailTarget)) {
+	var wg sync.WaitGroup
+	for _, target := range targets {
+		wg.Add(1)
+		go func(target *tailTarget) {
+			defer wg.Done()
+			fn(target)
+		}(target)
+	}
+	wg.Wait()
+}
+
+func sortTailLines(lines []*TailLine) {
+	sort.SliceStable(lines, func(i, j int) bool {
+		return lines[i].Time < lines[j].Time
+	})
+}
+
+// pollTail polls the new lines until the end time from all targets, and merges the lines by time.
+func pollTail(ctx context.Context, targets []*tailTarget, req *SearchLogRequest, endTime int64) ([]*TailLine, []*TailDropped, []*TargetError) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var mu sync.Mutex
+	lines := make([]*TailLine, 0)
+	drops := make([]*TailDropped, 0)
+	errs := make([]*TargetError, 0)
+	forEachTarget(targets, func(target *tailTarget) {
+		targetLines, dropped, err := target.poll(ctx, req, endTime)
+		mu.Lock()
+		defer mu.Unlock()
+		lines = append(lines, targetLines...)
+		if dropped != nil {
+			drops = append(drops, dropped)
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	})
+	sortTailLines(lines)
+	return lines, drops, errs
+}
+
+// searchTargets searches the logs in the time range of the request from all targets, and merges the lines by time.
+func searchTargets(ctx context.Context, targets []*tailTarget, req *SearchLogRequest) ([]*TailLine, []*TargetError) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var mu sync.Mutex
+	lines := make([]*TailLine, 0)
+	errs := make([]*TargetError, 0)
+	forEachTarget(targets, func(target *tailTarget) {
+		targetLines, truncated, err := target.search(ctx, req)
+		if truncated {
+			err = &TargetError{Instance: target.node.DisplayName, Truncated: true}
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		lines = append(lines, targetLines...)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	})
+	sortTailLines(lines)
+	return lines, errs
+}
+
+func toMillis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+// @Summary Generate a token for tailing logs
+// @Produce plain
+// @Param request body TailRequest true "Request body"
+// @Security JwtAuth
+// @Success 200 {string} string "xxx"
+// @Failure 400 {object} utils.APIError "Bad request"
+// @Failure 401 {object} utils.APIError "Unauthorized failure"
+// @Router /logs/tail/acquire_token [post]
+func (s *Service) GetTailToken(c *gin.Context) {
+	var req TailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.MakeInvalidRequestErrorFromError(c, err)
+		return
+	}
+	if len(req.Targets) == 0 {
+		utils.MakeInvalidRequestErrorWithMessage(c, "Expect at least 1 target")
+		return
+	}
+	if req.MinLevel < LogLevelUnknown || int(req.MinLevel) >= len(PBLogLevelSlice) {
+		utils.MakeInvalidRequestErrorWithMessage(c, "Invalid min level")
+		return
+	}
+	data, err := json.Marshal(&req)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	token, err := utils.NewJWTString(tailTokenIssuer, string(data))
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.String(http.StatusOK, token)
+}
+
+// @Summary Tail logs of the targets as server-sent events
+// @Description Lines are sent as `log` events in time order, but late flushed lines may follow newer ones. Failures of targets are sent as `target_error` events, and time ranges of flooding targets whose lines may be dropped are sent as `lines_dropped` events.
+// @Produce text/event-stream
+// @Param token query string true "tail token"
+// @Success 200 {object} TailLine
+// @Failure 400 {object} utils.APIError "Bad request"
+// @Failure 401 {object} utils.APIError "Unauthorized failure"
+// @Router /logs/tail [get]
+func (s *Service) TailLogs(c *gin.Context) {
+	data, err := utils.ParseJWTString(tailTokenIssuer, c.Query("token"))
+	if err != nil {
+		utils.MakeInvalidRequestErrorFromError(c, err)
+		return
+	}
+	var req TailRequest
+	if err := json.Unmarshal([]byte(data), &req); err != nil {
+		utils.MakeInvalidRequestErrorFromError(c, err)
+		return
+	}
+
+	startTime := toMillis(time.Now().Add(-tailLag))
+	targets := make([]*tailTarget, 0, len(req.Targets))
+	dialErrs := make([]*TargetError, 0)
+	for i := range req.Targets {
+		node := req.Targets[i]
+		conn, err := s.dialTarget(&node)
+		if err != nil {
+			dialErrs = append(dialErrs, &TargetError{Instance: node.DisplayName, Error: err.Error()})
+			continue
+		}
+		defer conn.Close()
+		targets = append(targets, newTailTarget(node, diagnosticspb.NewDiagnosticsClient(conn), startTime))
+	}
+
+	ctx := c.Request.Context()
+	ticker := time.NewTicker(tailInterval)
+	defer ticker.Stop()
+
+	searchReq := &SearchLogRequest{
+		MinLevel: req.MinLevel,
+		Patterns: req.Patterns,
+	}
+	c.Header("Cache-Control", "no-cache")
+	c.Stream(func(w io.Writer) bool {
+		for _, e := range dialErrs {
+			c.SSEvent("target_error", e)
+		}
+		dialErrs = nil
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+		}
+
+		lines, drops, errs := pollTail(ctx, targets, searchReq, toMillis(time.Now().Add(-tailLag)))
+		for _, e := range errs {
+			c.SSEvent("target_error", e)
+		}
+		for _, d := range drops {
+			c.SSEvent("lines_dropped", d)
+		}
+		for _, line := range lines {
+			c.SSEvent("log", line)
+		}
+		return true
+	})
+}
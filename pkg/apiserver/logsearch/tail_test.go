@@ -0,0 +1,167 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logsearch
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	. "github.com/pingcap/check"
+	"github.com/pingcap/kvproto/pkg/diagnosticspb"
+	"google.golang.org/grpc"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/model"
+)
+
+var _ = Suite(&testTailSuite{})
+
+type testTailSuite struct{}
+
+// fakeDiagnosticsClient searches the lines in memory, which are ordered by time.
+type fakeDiagnosticsClient struct {
+	diagnosticspb.DiagnosticsClient
+	mu    sync.Mutex
+	lines []*diagnosticspb.LogMessage
+}
+
+func (f *fakeDiagnosticsClient) add(t int64, msg string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.lines = append(f.lines, &diagnosticspb.LogMessage{Time: t, Level: diagnosticspb.LogLevel_Info, Message: msg})
+}
+
+func (f *fakeDiagnosticsClient) SearchLog(_ context.Context, in *diagnosticspb.SearchLogRequest, _ ...grpc.CallOption) (diagnosticspb.Diagnostics_SearchLogClient, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	messages := make([]*diagnosticspb.LogMessage, 0)
+	for _, line := range f.lines {
+		if line.Time >= in.StartTime && line.Time <= in.EndTime {
+			messages = append(messages, line)
+		}
+	}
+	return &fakeSearchLogStream{messages: messages}, nil
+}
+
+type fakeSearchLogStream struct {
+	grpc.ClientStream
+	messages []*diagnosticspb.LogMessage
+}
+
+// Recv returns the messages in batches of 64.
+func (s *fakeSearchLogStream) Recv() (*diagnosticspb.SearchLogResponse, error) {
+	if len(s.messages) == 0 {
+		return nil, io.EOF
+	}
+	n := 64
+	if n > len(s.messages) {
+		n = len(s.messages)
+	}
+	res := &diagnosticspb.SearchLogResponse{Messages: s.messages[:n]}
+	s.messages = s.messages[n:]
+	return res, nil
+}
+
+func tailMessages(lines []*TailLine) []string {
+	messages := make([]string, 0, len(lines))
+	for _, line := range lines {
+		messages = append(messages, line.Instance+":"+line.Message)
+	}
+	return messages
+}
+
+func (t *testTailSuite) Test_pollTail(c *C) {
+	tidb := &fakeDiagnosticsClient{}
+	tikv := &fakeDiagnosticsClient{}
+	targets := []*tailTarget{
+		newTailTarget(model.RequestTargetNode{DisplayName: "tidb"}, tidb, 1000),
+		newTailTarget(model.RequestTargetNode{DisplayName: "tikv"}, tikv, 1000),
+	}
+	req := &SearchLogRequest{}
+
+	tidb.add(900, "before the start")
+	tidb.add(1000, "a")
+	tikv.add(1500, "b")
+	tidb.add(2000, "c")
+	tikv.add(2500, "not yet")
+	lines, drops, errs := pollTail(context.Background(), targets, req, 2000)
+	c.Assert(tailMessages(lines), DeepEquals, []string{"tidb:a", "tikv:b", "tidb:c"})
+	c.Assert(drops, HasLen, 0)
+	c.Assert(errs, HasLen, 0)
+
+	// The line flushed late is sent once, and the sent lines in the late window are skipped.
+	tikv.add(1800, "late")
+	tidb.add(3000, "d")
+	lines, _, _ = pollTail(context.Background(), targets, req, 3000)
+	c.Assert(tailMessages(lines), DeepEquals, []string{"tikv:late", "tikv:not yet", "tidb:d"})
+	lines, _, _ = pollTail(context.Background(), targets, req, 3000)
+	c.Assert(lines, HasLen, 0)
+}
+
+func (t *testTailSuite) Test_pollTailTruncated(c *C) {
+	client := &fakeDiagnosticsClient{}
+	targets := []*tailTarget{newTailTarget(model.RequestTargetNode{DisplayName: "tidb"}, client, 0)}
+	req := &SearchLogRequest{}
+
+	// More lines than the limit, and some of them are in the same millisecond as the last returned one.
+	for i := 0; i < tailMaxLinesPerPoll+500; i++ {
+		client.add(int64(i/10), fmt.Sprintf("line %d", i))
+	}
+	lines, drops, errs := pollTail(context.Background(), targets, req, 1000)
+	c.Assert(lines, HasLen, tailMaxLinesPerPoll)
+	c.Assert(drops, HasLen, 0)
+	c.Assert(errs, HasLen, 0)
+
+	lines, _, _ = pollTail(context.Background(), targets, req, 1000)
+	c.Assert(lines, HasLen, 500)
+	c.Assert(lines[0].Message, Equals, fmt.Sprintf("line %d", tailMaxLinesPerPoll))
+	lines, _, _ = pollTail(context.Background(), targets, req, 1000)
+	c.Assert(lines, HasLen, 0)
+}
+
+func (t *testTailSuite) Test_pollTailDropped(c *C) {
+	client := &fakeDiagnosticsClient{}
+	targets := []*tailTarget{newTailTarget(model.RequestTargetNode{DisplayName: "tidb"}, client, 0)}
+	req := &SearchLogRequest{}
+
+	// A line every 10ms, which is faster than they can be sent.
+	for i := 0; i < 10000; i++ {
+		client.add(int64(i*10), fmt.Sprintf("line %d", i))
+	}
+	lines, drops, _ := pollTail(context.Background(), targets, req, 5000)
+	c.Assert(lines, HasLen, 501)
+	c.Assert(drops, HasLen, 0)
+	lines, drops, _ = pollTail(context.Background(), targets, req, 30000)
+	c.Assert(lines, HasLen, tailMaxLinesPerPoll)
+	c.Assert(drops, HasLen, 0)
+	lastTime := lines[len(lines)-1].Time
+
+	// The backlog beyond the limit is dropped, and the poll continues from the late window before it.
+	lines, drops, _ = pollTail(context.Background(), targets, req, 60000)
+	backlogStart := 60000 - tailMaxBacklog.Milliseconds()
+	c.Assert(drops, DeepEquals, []*TailDropped{{Instance: "tidb", StartTime: lastTime, EndTime: backlogStart - 1}})
+	c.Assert(lines[0].Time, Equals, backlogStart-tailLateWindow.Milliseconds())
+}
+
+func (t *testTailSuite) Test_searchTargets(c *C) {
+	client := &fakeDiagnosticsClient{}
+	for i := 0; i < tailMaxLinesPerPoll+1; i++ {
+		client.add(int64(i), "line")
+	}
+	targets := []*tailTarget{{node: model.RequestTargetNode{DisplayName: "tidb"}, client: client}}
+	lines, errs := searchTargets(context.Background(), targets, &SearchLogRequest{StartTime: 0, EndTime: 5000})
+	c.Assert(lines, HasLen, tailMaxLinesPerPoll)
+	c.Assert(errs, DeepEquals, []*TargetError{{Instance: "tidb", Truncated: true}})
+}
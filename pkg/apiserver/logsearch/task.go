@@ -14,12 +14,9 @@
 package logsearch
 
 import (
-	"archive/zip"
-	"bufio"
 	"context"
 	"fmt"
 	"io"
-	"math"
 	"os"
 	"path"
 	"strconv"
@@ -38,8 +35,8 @@ import (
 )
 
 // MaxRecvMsgSize set max gRPC receive message size received from server. If any message size is larger than
-// current value, an error will be reported from gRPC.
-var MaxRecvMsgSize = math.MaxInt64
+// current value, an error will be reported from gRPC. It is bounded to avoid a single message exhausting memory.
+var MaxRecvMsgSize = 64 * 1024 * 1024
 
 type TaskGroup struct {
 	service                *Service
@@ -47,6 +44,9 @@ type TaskGroup struct {
 	tasks                  []*Task
 	tasksMu                sync.Mutex
 	maxPreviewLinesPerTask int
+	budget                 *collectBudget
+	compression            string
+	done                   chan struct{} // closed when the task group is finished
 }
 
 func (tg *TaskGroup) InitTasks(ctx context.Context, taskModels []*TaskModel) {
@@ -79,8 +79,11 @@ func (tg *TaskGroup) SyncRun() {
 		tg.service.db.Save(tg.model)
 	}
 
+	versions := tg.service.fetchComponentVersions(tg.service.lifecycleCtx)
+
 	wg := sync.WaitGroup{}
 	for _, task := range tg.tasks {
+		task.version = versions[instanceKey(task.model.Target.IP, uint(task.model.Target.Port))]
 		wg.Add(1)
 		go func(task *Task) {
 			task.SyncRun()
@@ -91,6 +94,7 @@ func (tg *TaskGroup) SyncRun() {
 
 	log.Debug("LogSearchTaskGroup finished", zap.Uint("task_group_id", tg.model.ID))
 	tg.model.State = TaskGroupStateFinished
+	tg.model.Truncated = tg.budget.isTruncated()
 	tg.service.db.Save(tg.model)
 }
 
@@ -111,6 +115,7 @@ type Task struct {
 	model     *TaskModel
 	ctx       context.Context
 	cancel    context.CancelFunc
+	version   string // empty if unknown
 }
 
 func (t *Task) String() string {
@@ -172,16 +177,7 @@ func (t *Task) SyncRun() {
 		return
 	}
 
-	secureOpt := grpc.WithInsecure()
-	if t.taskGroup.service.config.ClusterTLSConfig != nil {
-		creds := credentials.NewTLS(t.taskGroup.service.config.ClusterTLSConfig)
-		secureOpt = grpc.WithTransportCredentials(creds)
-	}
-
-	conn, err := grpc.Dial(fmt.Sprintf("%s:%d", t.model.Target.IP, t.model.Target.Port),
-		secureOpt,
-		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(MaxRecvMsgSize)),
-	)
+	conn, err := t.taskGroup.service.dialTarget(t.model.Target)
 	if err != nil {
 		t.setError(err)
 		return
@@ -189,96 +185,123 @@ func (t *Task) SyncRun() {
 	defer conn.Close()
 
 	cli := diagnosticspb.NewDiagnosticsClient(conn)
-	t.searchLog(cli, diagnosticspb.SearchLogRequest_Normal)
-	// Only TiKV support searching slow log now
-	if t.model.Target.Kind == model.NodeKindTiKV {
-		t.searchLog(cli, diagnosticspb.SearchLogRequest_Slow)
+	for _, target := range logTargetsOf(t.model.Target.Kind, t.version) {
+		if target.fromSlowQuery {
+			t.searchSlowQueryLog()
+			continue
+		}
+		t.searchLog(cli, target.logType, target.pbTarget)
 	}
 }
 
-func (t *Task) searchLog(client diagnosticspb.DiagnosticsClient, targetType diagnosticspb.SearchLogRequest_Target) {
-	if t.model.Error != nil {
+func (t *Task) searchLog(client diagnosticspb.DiagnosticsClient, logType LogType, targetType diagnosticspb.SearchLogRequest_Target) {
+	if t.model.Error != nil || t.taskGroup.budget.isTruncated() {
 		return
 	}
-	req := t.taskGroup.model.SearchRequest.ConvertToPB(targetType)
-	patterns := make([]string, len(req.Patterns))
-	for i, p := range req.Patterns {
-		patterns[i] = "(?i)" + p
-	}
-	req.Patterns = patterns
-	stream, err := client.SearchLog(t.ctx, req)
+	// The stream is canceled when the collecting stops early.
+	ctx, cancel := context.WithCancel(t.ctx)
+	defer cancel()
+
+	req := newPBSearchRequest(t.taskGroup.model.SearchRequest, targetType)
+	stream, err := client.SearchLog(ctx, req)
 	if err != nil {
 		t.setError(err)
 		return
 	}
 
-	// Create zip file for the log in the log directory
+	// Create the compressed file for the log in the log directory
 	fileName := t.model.Target.FileName()
-	if targetType == diagnosticspb.SearchLogRequest_Slow {
-		fileName = fileName + "-slow"
-	}
-	savedPath := path.Join(*t.taskGroup.model.LogStoreDir, fileName+".zip")
-	f, err := os.Create(savedPath)
-	if err != nil {
-		t.setError(err)
-		return
+	if logType != LogTypeNormal {
+		fileName = fileName + "-" + string(logType)
 	}
-	defer f.Close()
-
-	// TODO: Could we use a memory buffer for this and flush the writer regularly to avoid OOM.
-	// This might perform an faster processing. This could also avoid creating an empty .zip
-	// firstly even if the searching result is empty.
-	zw := zip.NewWriter(f)
-	defer zw.Close()
-	defer zw.Flush()
-
-	writer, err := zw.Create(fileName + ".log")
+	savedPath := path.Join(*t.taskGroup.model.LogStoreDir, fileName+logFileExt(t.taskGroup.compression))
+	fileWriter, err := createLogFile(savedPath, fileName+".log", t.taskGroup.compression)
 	if err != nil {
 		t.setError(err)
 		return
 	}
 
-	bufWriter := bufio.NewWriterSize(writer, 16*1024*1024) // 16M buffer size
-	defer bufWriter.Flush()
-
 	t.model.State = TaskStateRunning
-	previewLogLinesCount := 0
+	linesCount := 0
+	writer := newLineWriter(t.taskGroup.service.db)
+	defer func() {
+		if err := writer.flush(); err != nil && t.model.Error == nil {
+			t.setError(err)
+		}
+		if err := fileWriter.Close(); err != nil && t.model.Error == nil {
+			t.setError(err)
+		}
+		if linesCount != 0 {
+			if logType == LogTypeSlow {
+				t.model.SlowLogStorePath = &savedPath
+			} else {
+				t.model.LogStorePath = &savedPath
+			}
+		}
+	}()
+
 	for {
 		res, err := stream.Recv()
 		if err != nil {
 			if err != io.EOF {
 				t.setError(err)
 			}
-			if previewLogLinesCount != 0 {
-				if targetType == diagnosticspb.SearchLogRequest_Normal {
-					t.model.LogStorePath = &savedPath
-				} else {
-					t.model.SlowLogStorePath = &savedPath
-				}
-			}
 			return
 		}
 		for _, msg := range res.Messages {
 			line := logMessageToString(msg)
-			_, err := bufWriter.Write(*(*[]byte)(unsafe.Pointer(&line)))
+			if !t.taskGroup.budget.take(len(line)) {
+				// The lines collected so far are kept, and the task group is marked as truncated.
+				log.Debug("LogSearchTask stopped by the size limit", zap.Any("task", t))
+				return
+			}
+			_, err := fileWriter.Write(*(*[]byte)(unsafe.Pointer(&line)))
 			if err != nil {
 				t.setError(err)
 				return
 			}
-			if previewLogLinesCount < t.taskGroup.maxPreviewLinesPerTask {
-				t.taskGroup.service.db.Create(&PreviewModel{
-					TaskID:      t.model.ID,
-					TaskGroupID: t.taskGroup.model.ID,
-					Time:        msg.Time,
-					Level:       msg.Level,
-					Message:     msg.Message,
-				})
-				previewLogLinesCount++
+			err = writer.addLine(&LineModel{
+				TaskID:      t.model.ID,
+				TaskGroupID: t.taskGroup.model.ID,
+				Time:        msg.Time,
+				Level:       msg.Level,
+				LogType:     logType,
+				Message:     msg.Message,
+				Fields:      parseLogFields(msg.Message),
+				Preview:     linesCount < t.taskGroup.maxPreviewLinesPerTask,
+			})
+			linesCount++
+			if err != nil {
+				t.setError(err)
+				return
 			}
 		}
 	}
 }
 
+func (s *Service) dialTarget(target *model.RequestTargetNode) (*grpc.ClientConn, error) {
+	secureOpt := grpc.WithInsecure()
+	if s.config.ClusterTLSConfig != nil {
+		creds := credentials.NewTLS(s.config.ClusterTLSConfig)
+		secureOpt = grpc.WithTransportCredentials(creds)
+	}
+	return grpc.Dial(fmt.Sprintf("%s:%d", target.IP, target.Port),
+		secureOpt,
+		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(MaxRecvMsgSize)),
+	)
+}
+
+// newPBSearchRequest converts the request to the gRPC one, with patterns matched case-insensitively.
+func newPBSearchRequest(r *SearchLogRequest, target diagnosticspb.SearchLogRequest_Target) *diagnosticspb.SearchLogRequest {
+	req := r.ConvertToPB(target)
+	patterns := make([]string, len(req.Patterns))
+	for i, p := range req.Patterns {
+		patterns[i] = "(?i)" + p
+	}
+	req.Patterns = patterns
+	return req
+}
+
 func logMessageToString(msg *diagnosticspb.LogMessage) string {
 	timeStr := time.Unix(0, msg.Time*int64(time.Millisecond)).Format(sysutil.TimeStampLayout)
 	return fmt.Sprintf("[%s] [%s] %s\n", timeStr, msg.Level.String(), msg.Message)
@@ -0,0 +1,304 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logsearch
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pingcap/kvproto/pkg/diagnosticspb"
+	"gorm.io/gorm"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/model"
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/utils"
+	"github.com/pingcap/tidb-dashboard/pkg/utils/topology"
+)
+
+const (
+	traceSlowQueryTable    = "INFORMATION_SCHEMA.CLUSTER_SLOW_QUERY"
+	traceMaxSlowQueries    = 1000
+	traceMaxStartTSPattern = 20
+
+	TraceEventSourceSlowQuery = "slow_query"
+	TraceEventSourceLog       = "log"
+)
+
+type TraceRequest struct {
+	// Either the connection ID or the start ts of the transaction is required.
+	// TODO: Switch back to uint64 when modern browser as well as Swagger handles BigInt well.
+	ConnID     string `json:"conn_id"`
+	TxnStartTS string `json:"txn_start_ts"`
+	StartTime  int64  `json:"start_time" binding:"required"` // unix millisecond
+	EndTime    int64  `json:"end_time" binding:"required"`   // unix millisecond
+	// The TiDB and TiKV instances to search logs from, all of them are searched if empty.
+	Targets []model.RequestTargetNode `json:"targets"`
+}
+
+type TraceSlowQuery struct {
+	Instance   string  `gorm:"column:INSTANCE" json:"instance"`
+	ConnID     string  `gorm:"column:Conn_ID" json:"conn_id"`
+	TxnStartTS string  `gorm:"column:Txn_start_ts" json:"txn_start_ts"`
+	Timestamp  float64 `gorm:"column:timestamp" json:"timestamp"` // finish time
+	QueryTime  float64 `gorm:"column:Query_time" json:"query_time"`
+	DB         string  `gorm:"column:DB" json:"db"`
+	Digest     string  `gorm:"column:Digest" json:"digest"`
+	Query      string  `gorm:"column:Query" json:"query"`
+}
+
+type TraceEvent struct {
+	Time      int64                  `json:"time"`   // unix millisecond
+	Source    string                 `json:"source"` // "slow_query" or "log"
+	Instance  string                 `json:"instance"`
+	Kind      model.NodeKind         `json:"kind"`
+	Level     diagnosticspb.LogLevel `json:"level"`
+	Message   string                 `json:"message"`
+	SlowQuery *TraceSlowQuery        `json:"slow_query,omitempty"`
+}
+
+type TraceResponse struct {
+	Events []*TraceEvent `json:"events"`
+	// The start ts of the transactions found for the connection, which are used to search the TiKV logs.
+	TxnStartTSList []string       `json:"txn_start_ts_list"`
+	Errors         []*TargetError `json:"errors"`
+}
+
+func (r *TraceRequest) validate() error {
+	if (r.ConnID == "") == (r.TxnStartTS == "") {
+		return fmt.Errorf("expect either conn_id or txn_start_ts")
+	}
+	// The identifiers are used in regular expressions, so only numbers are allowed.
+	for _, id := range []string{r.ConnID, r.TxnStartTS} {
+		if id == "" {
+			continue
+		}
+		if _, err := strconv.ParseUint(id, 10, 64); err != nil {
+			return fmt.Errorf("invalid identifier %s", id)
+		}
+	}
+	if r.StartTime >= r.EndTime {
+		return fmt.Errorf("start_time must be less than end_time")
+	}
+	return nil
+}
+
+func querySlowQueriesForTrace(db *gorm.DB, req *TraceRequest) ([]*TraceSlowQuery, error) {
+	query := db.
+		Table(traceSlowQueryTable).
+		Select("INSTANCE, Conn_ID, Txn_start_ts, (UNIX_TIMESTAMP(Time) + 0E0) AS timestamp, Query_time, DB, Digest, Query").
+		Where("Time BETWEEN FROM_UNIXTIME(?) AND FROM_UNIXTIME(?)", req.StartTime/1000, (req.EndTime+999)/1000)
+	if req.ConnID != "" {
+		query = query.Where("Conn_ID = ?", req.ConnID)
+	} else {
+		query = query.Where("Txn_start_ts = ?", req.TxnStartTS)
+	}
+	var rows []*TraceSlowQuery
+	err := query.Order("Time").Limit(traceMaxSlowQueries).Find(&rows).Error
+	return rows, err
+}
+
+// traceStartTSList returns the start ts of the traced transactions, which is the requested one or the ones found
+// in the slow queries of the connection.
+func traceStartTSList(req *TraceRequest, slowQueries []*TraceSlowQuery) []string {
+	if req.TxnStartTS != "" {
+		return []string{req.TxnStartTS}
+	}
+	result := make([]string, 0)
+	seen := make(map[string]struct{})
+	for _, q := range slowQueries {
+		if q.TxnStartTS == "" || q.TxnStartTS == "0" {
+			continue
+		}
+		if _, ok := seen[q.TxnStartTS]; ok {
+			continue
+		}
+		seen[q.TxnStartTS] = struct{}{}
+		result = append(result, q.TxnStartTS)
+		if len(result) >= traceMaxStartTSPattern {
+			break
+		}
+	}
+	return result
+}
+
+// tracePatterns returns the patterns of TiDB logs and TiKV logs mentioning the identifiers. TiKV logs do not
+// contain the connection ID, so they are only searched by the start ts. Empty patterns mean nothing to search.
+func tracePatterns(connID string, startTSList []string) (tidbPattern string, tikvPattern string) {
+	alternatives := make([]string, 0, 2)
+	if connID != "" {
+		alternatives = append(alternatives, `conn(ection)?(_?id)?["=: ]+`+connID+`\b`)
+	}
+	if len(startTSList) > 0 {
+		tikvPattern = `\b(` + strings.Join(startTSList, "|") + `)\b`
+		alternatives = append(alternatives, tikvPattern)
+	}
+	return strings.Join(alternatives, "|"), tikvPattern
+}
+
+func (s *Service) fetchTraceTargets(ctx context.Context) ([]model.RequestTargetNode, error) {
+	targets := make([]model.RequestTargetNode, 0)
+	tidbs, err := topology.FetchTiDBTopology(ctx, s.etcdClient)
+	if err != nil {
+		return nil, err
+	}
+	for _, i := range tidbs {
+		if i.Status != topology.ComponentStatusUp {
+			continue
+		}
+		targets = append(targets, model.RequestTargetNode{
+			Kind:        model.NodeKindTiDB,
+			DisplayName: instanceKey(i.IP, i.Port),
+			IP:          i.IP,
+			Port:        int(i.StatusPort),
+		})
+	}
+	tikvs, _, err := topology.FetchStoreTopology(s.pdClient)
+	if err != nil {
+		return nil, err
+	}
+	for _, i := range tikvs {
+		if i.Status != topology.ComponentStatusUp {
+			continue
+		}
+		targets = append(targets, model.RequestTargetNode{
+			Kind:        model.NodeKindTiKV,
+			DisplayName: instanceKey(i.IP, i.Port),
+			IP:          i.IP,
+			Port:        int(i.Port),
+		})
+	}
+	return targets, nil
+}
+
+// searchTraceLogs searches the logs of the targets of the kind with the pattern.
+func (s *Service) searchTraceLogs(ctx context.Context, targets []model.RequestTargetNode, kind model.NodeKind, req *SearchLogRequest) ([]*TailLine, []*TargetError) {
+	tailTargets := make([]*tailTarget, 0)
+	errs := make([]*TargetError, 0)
+	for i := range targets {
+		node := targets[i]
+		if node.Kind != kind {
+			continue
+		}
+		conn, err := s.dialTarget(&node)
+		if err != nil {
+			errs = append(errs, &TargetError{Instance: node.DisplayName, Error: err.Error()})
+			continue
+		}
+		defer conn.Close()
+		tailTargets = append(tailTargets, &tailTarget{
+			node:   node,
+			client: diagnosticspb.NewDiagnosticsClient(conn),
+		})
+	}
+	lines, searchErrs := searchTargets(ctx, tailTargets, req)
+	return lines, append(errs, searchErrs...)
+}
+
+func mergeTraceEvents(slowQueries []*TraceSlowQuery, lines []*TailLine) []*TraceEvent {
+	events := make([]*TraceEvent, 0, len(slowQueries)+len(lines))
+	for _, q := range slowQueries {
+		events = append(events, &TraceEvent{
+			Time:      int64(q.Timestamp * 1000),
+			Source:    TraceEventSourceSlowQuery,
+			Instance:  q.Instance,
+			Kind:      model.NodeKindTiDB,
+			Message:   q.Query,
+			SlowQuery: q,
+		})
+	}
+	for _, l := range lines {
+		events = append(events, &TraceEvent{
+			Time:     l.Time,
+			Source:   TraceEventSourceLog,
+			Instance: l.Instance,
+			Kind:     l.Kind,
+			Level:    l.Level,
+			Message:  l.Message,
+		})
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Time < events[j].Time
+	})
+	return events
+}
+
+// @Summary Trace a connection or a transaction across the slow queries, TiDB logs and TiKV logs
+// @Description The events mentioning the identifier are merged into a timeline ordered by time.
+// @Param request body TraceRequest true "Request body"
+// @Security JwtAuth
+// @Success 200 {object} TraceResponse
+// @Failure 400 {object} utils.APIError "Bad request"
+// @Failure 401 {object} utils.APIError "Unauthorized failure"
+// @Failure 500 {object} utils.APIError
+// @Router /logs/trace [post]
+func (s *Service) Trace(c *gin.Context) {
+	var req TraceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.MakeInvalidRequestErrorFromError(c, err)
+		return
+	}
+	if err := req.validate(); err != nil {
+		utils.MakeInvalidRequestErrorFromError(c, err)
+		return
+	}
+
+	ctx := c.Request.Context()
+	targets := req.Targets
+	if len(targets) == 0 {
+		var err error
+		if targets, err = s.fetchTraceTargets(ctx); err != nil {
+			_ = c.Error(err)
+			return
+		}
+	}
+
+	slowQueries, err := querySlowQueriesForTrace(utils.GetTiDBConnection(c), &req)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	startTSList := traceStartTSList(&req, slowQueries)
+	tidbPattern, tikvPattern := tracePatterns(req.ConnID, startTSList)
+
+	lines := make([]*TailLine, 0)
+	errs := make([]*TargetError, 0)
+	for _, search := range []struct {
+		kind    model.NodeKind
+		pattern string
+	}{
+		{model.NodeKindTiDB, tidbPattern},
+		{model.NodeKindTiKV, tikvPattern},
+	} {
+		if search.pattern == "" {
+			continue
+		}
+		kindLines, kindErrs := s.searchTraceLogs(ctx, targets, search.kind, &SearchLogRequest{
+			StartTime: req.StartTime,
+			EndTime:   req.EndTime,
+			Patterns:  []string{search.pattern},
+		})
+		lines = append(lines, kindLines...)
+		errs = append(errs, kindErrs...)
+	}
+
+	c.JSON(http.StatusOK, &TraceResponse{
+		Events:         mergeTraceEvents(slowQueries, lines),
+		TxnStartTSList: startTSList,
+		Errors:         errs,
+	})
+}
@@ -0,0 +1,67 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logsearch
+
+import (
+	"regexp"
+
+	. "github.com/pingcap/check"
+)
+
+var _ = Suite(&testTraceSuite{})
+
+type testTraceSuite struct{}
+
+func (t *testTraceSuite) Test_validate(c *C) {
+	c.Assert((&TraceRequest{ConnID: "5", StartTime: 1, EndTime: 2}).validate(), IsNil)
+	c.Assert((&TraceRequest{TxnStartTS: "422512345678901249", StartTime: 1, EndTime: 2}).validate(), IsNil)
+	c.Assert((&TraceRequest{StartTime: 1, EndTime: 2}).validate(), NotNil)
+	c.Assert((&TraceRequest{ConnID: "5", TxnStartTS: "1", StartTime: 1, EndTime: 2}).validate(), NotNil)
+	c.Assert((&TraceRequest{ConnID: "5|.*", StartTime: 1, EndTime: 2}).validate(), NotNil)
+	c.Assert((&TraceRequest{ConnID: "5", StartTime: 2, EndTime: 1}).validate(), NotNil)
+}
+
+func (t *testTraceSuite) Test_tracePatterns(c *C) {
+	startTSList := traceStartTSList(&TraceRequest{ConnID: "5"}, []*TraceSlowQuery{
+		{TxnStartTS: "422512345678901249"},
+		{TxnStartTS: "0"},
+		{TxnStartTS: "422512345678901249"},
+		{TxnStartTS: "422512345678901250"},
+	})
+	c.Assert(startTSList, DeepEquals, []string{"422512345678901249", "422512345678901250"})
+
+	tidbPattern, tikvPattern := tracePatterns("5", startTSList)
+	tidbRe := regexp.MustCompile("(?i)" + tidbPattern)
+	c.Assert(tidbRe.MatchString(`[session.go:1234] ["run statement"] [conn=5] [sql="select 1"]`), IsTrue)
+	c.Assert(tidbRe.MatchString(`[2pc.go:567] ["prewrite failed"] [conn=6] [txnStartTS=422512345678901250]`), IsTrue)
+	c.Assert(tidbRe.MatchString(`[session.go:1234] ["run statement"] [conn=55]`), IsFalse)
+	tikvRe := regexp.MustCompile("(?i)" + tikvPattern)
+	c.Assert(tikvRe.MatchString(`[txn.rs:100] ["write conflict"] [start_ts=422512345678901249]`), IsTrue)
+	c.Assert(tikvRe.MatchString(`[txn.rs:100] ["write conflict"] [start_ts=4225123456789012490]`), IsFalse)
+
+	_, tikvPattern = tracePatterns("5", nil)
+	c.Assert(tikvPattern, Equals, "")
+}
+
+func (t *testTraceSuite) Test_mergeTraceEvents(c *C) {
+	events := mergeTraceEvents(
+		[]*TraceSlowQuery{{Timestamp: 2.5, Query: "select 1"}},
+		[]*TailLine{{Time: 1000, Message: "a"}, {Time: 3000, Message: "b"}},
+	)
+	c.Assert(events, HasLen, 3)
+	c.Assert(events[0].Message, Equals, "a")
+	c.Assert(events[1].Source, Equals, TraceEventSourceSlowQuery)
+	c.Assert(events[1].Time, Equals, int64(2500))
+	c.Assert(events[2].Message, Equals, "b")
+}
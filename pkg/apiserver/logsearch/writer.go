@@ -0,0 +1,139 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logsearch
+
+import (
+	"archive/zip"
+	"bufio"
+	"compress/gzip"
+	"io"
+	"os"
+	"sync/atomic"
+
+	"github.com/pingcap/tidb-dashboard/pkg/config"
+	"github.com/pingcap/tidb-dashboard/pkg/dbstore"
+)
+
+const (
+	writeBatchSize    = 1000
+	logFileBufferSize = 1024 * 1024
+)
+
+// collectBudget limits the total bytes of lines collected by all tasks in a task group.
+type collectBudget struct {
+	remaining int64
+	truncated int32
+}
+
+func newCollectBudget(limitBytes int64) *collectBudget {
+	return &collectBudget{remaining: limitBytes}
+}
+
+// take reserves n bytes from the budget. Returns false and marks the budget as truncated if the budget is used up.
+// This function is multi-thread safe.
+func (b *collectBudget) take(n int) bool {
+	if atomic.AddInt64(&b.remaining, -int64(n)) >= 0 {
+		return true
+	}
+	atomic.StoreInt32(&b.truncated, 1)
+	return false
+}
+
+func (b *collectBudget) isTruncated() bool {
+	return atomic.LoadInt32(&b.truncated) != 0
+}
+
+func logFileExt(compression string) string {
+	if compression == config.LogSearchCompressionGzip {
+		return ".log.gz"
+	}
+	return ".zip"
+}
+
+// logFileWriter writes the lines into a compressed log file through a bounded buffer.
+type logFileWriter struct {
+	*bufio.Writer
+	f          *os.File
+	compressor io.Closer
+}
+
+// createLogFile creates the log file in the compression format. The entry name is the name of the log inside
+// the zip archive, which is unused for gzip.
+func createLogFile(filePath, entryName, compression string) (*logFileWriter, error) {
+	f, err := os.Create(filePath)
+	if err != nil {
+		return nil, err
+	}
+	var w io.Writer
+	var compressor io.Closer
+	switch compression {
+	case config.LogSearchCompressionGzip:
+		gw := gzip.NewWriter(f)
+		w, compressor = gw, gw
+	default:
+		zw := zip.NewWriter(f)
+		w, err = zw.Create(entryName)
+		if err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+		compressor = zw
+	}
+	return &logFileWriter{
+		Writer:     bufio.NewWriterSize(w, logFileBufferSize),
+		f:          f,
+		compressor: compressor,
+	}, nil
+}
+
+func (w *logFileWriter) Close() error {
+	err := w.Flush()
+	if cerr := w.compressor.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := w.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// lineWriter buffers the lines of a task, and writes them into the database in batches.
+type lineWriter struct {
+	db    *dbstore.DB
+	lines []*LineModel
+}
+
+func newLineWriter(db *dbstore.DB) *lineWriter {
+	return &lineWriter{
+		db:    db,
+		lines: make([]*LineModel, 0, writeBatchSize),
+	}
+}
+
+func (w *lineWriter) addLine(line *LineModel) error {
+	w.lines = append(w.lines, line)
+	if len(w.lines) >= writeBatchSize {
+		return w.flush()
+	}
+	return nil
+}
+
+func (w *lineWriter) flush() error {
+	if len(w.lines) == 0 {
+		return nil
+	}
+	err := w.db.CreateInBatches(w.lines, writeBatchSize).Error
+	w.lines = w.lines[:0]
+	return err
+}
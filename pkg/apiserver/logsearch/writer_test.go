@@ -0,0 +1,60 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logsearch
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path"
+
+	. "github.com/pingcap/check"
+
+	"github.com/pingcap/tidb-dashboard/pkg/config"
+)
+
+var _ = Suite(&testWriterSuite{})
+
+type testWriterSuite struct{}
+
+func (t *testWriterSuite) Test_collectBudget(c *C) {
+	b := newCollectBudget(10)
+	c.Assert(b.take(4), IsTrue)
+	c.Assert(b.take(6), IsTrue)
+	c.Assert(b.isTruncated(), IsFalse)
+	c.Assert(b.take(1), IsFalse)
+	c.Assert(b.isTruncated(), IsTrue)
+}
+
+func (t *testWriterSuite) Test_createLogFile(c *C) {
+	dir, err := ioutil.TempDir("", "logsearch")
+	c.Assert(err, IsNil)
+	defer os.RemoveAll(dir)
+
+	filePath := path.Join(dir, "test"+logFileExt(config.LogSearchCompressionGzip))
+	w, err := createLogFile(filePath, "test.log", config.LogSearchCompressionGzip)
+	c.Assert(err, IsNil)
+	_, err = w.WriteString("[2021/01/01 00:00:00.000 +08:00] [INFO] hello\n")
+	c.Assert(err, IsNil)
+	c.Assert(w.Close(), IsNil)
+
+	f, err := os.Open(filePath)
+	c.Assert(err, IsNil)
+	defer f.Close()
+	r, err := gzip.NewReader(f)
+	c.Assert(err, IsNil)
+	data, err := ioutil.ReadAll(r)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "[2021/01/01 00:00:00.000 +08:00] [INFO] hello\n")
+}
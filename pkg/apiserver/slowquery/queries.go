@@ -17,18 +17,29 @@ import (
 	"strings"
 
 	"gorm.io/gorm"
+
+	"github.com/pingcap/tidb-dashboard/pkg/utils/sqldigest"
 )
 
 const (
-	slowQueryTable = "INFORMATION_SCHEMA.CLUSTER_SLOW_QUERY"
+	slowQueryTable  = "INFORMATION_SCHEMA.CLUSTER_SLOW_QUERY"
+	statementsTable = "INFORMATION_SCHEMA.CLUSTER_STATEMENTS_SUMMARY_HISTORY"
+
+	// TextModeKeyword matches the keywords in the text against the start ts, the digest and the query.
+	TextModeKeyword = ""
+	// TextModeFingerprint normalizes the text as a SQL and matches the slow queries of the same digest.
+	TextModeFingerprint = "fingerprint"
 )
 
+var ErrUnknownTextMode = ErrNS.NewType("unknown_text_mode")
+
 type GetListRequest struct {
 	BeginTime int      `json:"begin_time" form:"begin_time"`
 	EndTime   int      `json:"end_time" form:"end_time"`
 	DB        []string `json:"db" form:"db"`
 	Limit     int      `json:"limit" form:"limit"`
 	Text      string   `json:"text" form:"text"`
+	TextMode  string   `json:"text_mode" form:"text_mode"` // empty for keyword matching, or "fingerprint"
 	OrderBy   string   `json:"orderBy" form:"orderBy"`
 	IsDesc    bool     `json:"desc" form:"desc"`
 
@@ -67,7 +78,15 @@ func (s *Service) querySlowLogList(db *gorm.DB, req *GetListRequest) ([]Model, e
 		tx = tx.Limit(req.Limit)
 	}
 
-	if req.Text != "" {
+	switch {
+	case req.Text == "":
+	case req.TextMode == TextModeFingerprint:
+		digests, err := queryFingerprintDigests(db, req.Text, req.BeginTime, req.EndTime)
+		if err != nil {
+			return nil, err
+		}
+		tx = tx.Where("Digest IN (?)", digests)
+	case req.TextMode == TextModeKeyword:
 		lowerStr := strings.ToLower(req.Text)
 		arr := strings.Fields(lowerStr)
 		for _, v := range arr {
@@ -79,6 +98,8 @@ func (s *Service) querySlowLogList(db *gorm.DB, req *GetListRequest) ([]Model, e
 				v, v, v, v,
 			)
 		}
+	default:
+		return nil, ErrUnknownTextMode.New("unknown text mode %s", req.TextMode)
 	}
 
 	if len(req.DB) > 0 {
@@ -113,6 +134,23 @@ func (s *Service) querySlowLogList(db *gorm.DB, req *GetListRequest) ([]Model, e
 	return results, nil
 }
 
+// queryFingerprintDigests returns the digests of the SQL text. Besides the digests computed locally, the ones
+// of the statements with the same normalized text in the time range are also included, since the digest of the
+// quoted form computed locally may differ from the one of TiDB.
+func queryFingerprintDigests(db *gorm.DB, sql string, beginTime, endTime int) ([]string, error) {
+	var digests []string
+	err := db.
+		Table(statementsTable).
+		Where("summary_begin_time <= FROM_UNIXTIME(?) AND summary_end_time >= FROM_UNIXTIME(?)", endTime, beginTime).
+		Where(sqldigest.UnquotedDigestTextExpr+" = ?", sqldigest.Normalize(sql)).
+		Pluck("DISTINCT digest", &digests).
+		Error
+	if err != nil {
+		return nil, err
+	}
+	return append(digests, sqldigest.CandidateDigests(sql)...), nil
+}
+
 func (s *Service) querySlowLogDetail(db *gorm.DB, req *GetDetailRequest) (*Model, error) {
 	var result Model
 	err := db.
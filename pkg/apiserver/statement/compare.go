@@ -0,0 +1,268 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statement
+
+import (
+	"sort"
+
+	"gorm.io/gorm"
+)
+
+const (
+	defaultCompareLimit                 = 100
+	defaultCompareMinExecCount          = 1
+	defaultCompareAvgLatencyRatio       = 1.5
+	defaultCompareMaxLatencyRatio       = 2
+	defaultCompareAvgProcessedKeysRatio = 2
+	defaultCompareAvgMemRatio           = 2
+)
+
+// Regression reasons
+const (
+	RegressionAvgLatency       = "avg_latency"
+	RegressionMaxLatency       = "max_latency"
+	RegressionAvgProcessedKeys = "avg_processed_keys"
+	RegressionAvgMem           = "avg_mem"
+	RegressionPlanChanged      = "plan_changed"
+)
+
+// CompareThresholds decides whether a statement is regressed. A ratio threshold is met when the metric in
+// the target time range divided by the one in the base time range is greater than or equal to it.
+type CompareThresholds struct {
+	MinExecCount          int     `json:"min_exec_count" form:"min_exec_count"`
+	AvgLatencyRatio       float64 `json:"avg_latency_ratio" form:"avg_latency_ratio"`
+	MaxLatencyRatio       float64 `json:"max_latency_ratio" form:"max_latency_ratio"`
+	AvgProcessedKeysRatio float64 `json:"avg_processed_keys_ratio" form:"avg_processed_keys_ratio"`
+	AvgMemRatio           float64 `json:"avg_mem_ratio" form:"avg_mem_ratio"`
+}
+
+func (t *CompareThresholds) adjust() {
+	if t.MinExecCount <= 0 {
+		t.MinExecCount = defaultCompareMinExecCount
+	}
+	if t.AvgLatencyRatio <= 0 {
+		t.AvgLatencyRatio = defaultCompareAvgLatencyRatio
+	}
+	if t.MaxLatencyRatio <= 0 {
+		t.MaxLatencyRatio = defaultCompareMaxLatencyRatio
+	}
+	if t.AvgProcessedKeysRatio <= 0 {
+		t.AvgProcessedKeysRatio = defaultCompareAvgProcessedKeysRatio
+	}
+	if t.AvgMemRatio <= 0 {
+		t.AvgMemRatio = defaultCompareAvgMemRatio
+	}
+}
+
+// CompareMetrics is the metrics of a statement in one time range.
+// Statement summary does not keep latency percentiles, so the max latency is used as the tail latency.
+type CompareMetrics struct {
+	ExecCount        int      `json:"exec_count"`
+	AvgLatency       int      `json:"avg_latency"`
+	MaxLatency       int      `json:"max_latency"`
+	AvgProcessedKeys int      `json:"avg_processed_keys"`
+	AvgMem           int      `json:"avg_mem"`
+	PlanDigests      []string `json:"plan_digests"`
+}
+
+type StatementDiff struct {
+	SchemaName            string         `json:"schema_name"`
+	Digest                string         `json:"digest"`
+	DigestText            string         `json:"digest_text"`
+	Base                  CompareMetrics `json:"base"`
+	Target                CompareMetrics `json:"target"`
+	ExecCountRatio        float64        `json:"exec_count_ratio"`
+	AvgLatencyRatio       float64        `json:"avg_latency_ratio"`
+	MaxLatencyRatio       float64        `json:"max_latency_ratio"`
+	AvgProcessedKeysRatio float64        `json:"avg_processed_keys_ratio"`
+	AvgMemRatio           float64        `json:"avg_mem_ratio"`
+	PlanChanged           bool           `json:"plan_changed"`
+	Reasons               []string       `json:"reasons"`
+}
+
+type stmtKey struct {
+	schemaName string
+	digest     string
+}
+
+// ratio is smoothed by adding one to both sides, so that a metric growing from zero is still comparable.
+func ratio(base, target int) float64 {
+	return float64(target+1) / float64(base+1)
+}
+
+func isSamePlanSet(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	set := make(map[string]struct{}, len(a))
+	for _, p := range a {
+		set[p] = struct{}{}
+	}
+	for _, p := range b {
+		if _, ok := set[p]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func newCompareMetrics(m *Model, plans []string) CompareMetrics {
+	return CompareMetrics{
+		ExecCount:        m.AggExecCount,
+		AvgLatency:       m.AggAvgLatency,
+		MaxLatency:       m.AggMaxLatency,
+		AvgProcessedKeys: m.AggAvgProcessedKeys,
+		AvgMem:           m.AggAvgMem,
+		PlanDigests:      plans,
+	}
+}
+
+// compareStatements returns the statements appearing in both time ranges that meet any of the thresholds,
+// ordered by the average latency ratio.
+func compareStatements(
+	base, target []Model,
+	basePlans, targetPlans map[stmtKey][]string,
+	thresholds CompareThresholds,
+	limit int,
+) []StatementDiff {
+	baseMap := make(map[stmtKey]*Model, len(base))
+	for i := range base {
+		baseMap[stmtKey{base[i].AggSchemaName, base[i].AggDigest}] = &base[i]
+	}
+
+	result := make([]StatementDiff, 0)
+	for i := range target {
+		t := &target[i]
+		key := stmtKey{t.AggSchemaName, t.AggDigest}
+		b, ok := baseMap[key]
+		if !ok {
+			continue
+		}
+		if b.AggExecCount < thresholds.MinExecCount || t.AggExecCount < thresholds.MinExecCount {
+			continue
+		}
+
+		diff := StatementDiff{
+			SchemaName:            t.AggSchemaName,
+			Digest:                t.AggDigest,
+			DigestText:            t.AggDigestText,
+			Base:                  newCompareMetrics(b, basePlans[key]),
+			Target:                newCompareMetrics(t, targetPlans[key]),
+			ExecCountRatio:        ratio(b.AggExecCount, t.AggExecCount),
+			AvgLatencyRatio:       ratio(b.AggAvgLatency, t.AggAvgLatency),
+			MaxLatencyRatio:       ratio(b.AggMaxLatency, t.AggMaxLatency),
+			AvgProcessedKeysRatio: ratio(b.AggAvgProcessedKeys, t.AggAvgProcessedKeys),
+			AvgMemRatio:           ratio(b.AggAvgMem, t.AggAvgMem),
+			PlanChanged:           !isSamePlanSet(basePlans[key], targetPlans[key]),
+			Reasons:               []string{},
+		}
+		if diff.AvgLatencyRatio >= thresholds.AvgLatencyRatio {
+			diff.Reasons = append(diff.Reasons, RegressionAvgLatency)
+		}
+		if diff.MaxLatencyRatio >= thresholds.MaxLatencyRatio {
+			diff.Reasons = append(diff.Reasons, RegressionMaxLatency)
+		}
+		if diff.AvgProcessedKeysRatio >= thresholds.AvgProcessedKeysRatio {
+			diff.Reasons = append(diff.Reasons, RegressionAvgProcessedKeys)
+		}
+		if diff.AvgMemRatio >= thresholds.AvgMemRatio {
+			diff.Reasons = append(diff.Reasons, RegressionAvgMem)
+		}
+		if diff.PlanChanged {
+			diff.Reasons = append(diff.Reasons, RegressionPlanChanged)
+		}
+		if len(diff.Reasons) == 0 {
+			continue
+		}
+		result = append(result, diff)
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].AvgLatencyRatio == result[j].AvgLatencyRatio {
+			return result[i].Target.ExecCount > result[j].Target.ExecCount
+		}
+		return result[i].AvgLatencyRatio > result[j].AvgLatencyRatio
+	})
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return result
+}
+
+// queryPlanDigests returns the distinct plan digests of each statement in the time range.
+func (s *Service) queryPlanDigests(
+	db *gorm.DB,
+	beginTime, endTime int,
+) (map[stmtKey][]string, error) {
+	src, err := s.getStmtSource(db, beginTime)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []struct {
+		SchemaName string
+		Digest     string
+		PlanDigest string
+	}
+	err = src.inTimeRange(beginTime, endTime).
+		Select("DISTINCT schema_name, digest, plan_digest").
+		Find(&rows).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[stmtKey][]string)
+	for _, row := range rows {
+		key := stmtKey{row.SchemaName, row.Digest}
+		result[key] = append(result[key], row.PlanDigest)
+	}
+	return result, nil
+}
+
+var compareFields = []string{
+	"digest_text",
+	"exec_count",
+	"avg_latency",
+	"max_latency",
+	"avg_processed_keys",
+	"avg_mem",
+}
+
+func (s *Service) compareStatements(db *gorm.DB, req *CompareRequest) ([]StatementDiff, error) {
+	base, err := s.queryStatements(db, req.BaseBeginTime, req.BaseEndTime, req.Schemas, req.StmtTypes, "", TextModeKeyword, compareFields, "", false)
+	if err != nil {
+		return nil, err
+	}
+	target, err := s.queryStatements(db, req.TargetBeginTime, req.TargetEndTime, req.Schemas, req.StmtTypes, "", TextModeKeyword, compareFields, "", false)
+	if err != nil {
+		return nil, err
+	}
+	basePlans, err := s.queryPlanDigests(db, req.BaseBeginTime, req.BaseEndTime)
+	if err != nil {
+		return nil, err
+	}
+	targetPlans, err := s.queryPlanDigests(db, req.TargetBeginTime, req.TargetEndTime)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultCompareLimit
+	}
+	thresholds := req.CompareThresholds
+	thresholds.adjust()
+	return compareStatements(base, target, basePlans, targetPlans, thresholds, limit), nil
+}
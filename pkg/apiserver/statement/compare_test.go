@@ -0,0 +1,74 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statement
+
+import (
+	. "github.com/pingcap/check"
+)
+
+var _ = Suite(&testCompareSuite{})
+
+type testCompareSuite struct{}
+
+func (t *testCompareSuite) Test_compareStatements(c *C) {
+	base := []Model{
+		{AggSchemaName: "test", AggDigest: "slower", AggExecCount: 10, AggAvgLatency: 99, AggMaxLatency: 199},
+		{AggSchemaName: "test", AggDigest: "stable", AggExecCount: 10, AggAvgLatency: 99, AggMaxLatency: 199},
+		{AggSchemaName: "test", AggDigest: "replanned", AggExecCount: 10, AggAvgLatency: 99, AggMaxLatency: 199},
+		{AggSchemaName: "test", AggDigest: "rare", AggExecCount: 1, AggAvgLatency: 99, AggMaxLatency: 199},
+		{AggSchemaName: "test", AggDigest: "gone", AggExecCount: 10, AggAvgLatency: 99, AggMaxLatency: 199},
+	}
+	target := []Model{
+		{AggSchemaName: "test", AggDigest: "slower", AggExecCount: 10, AggAvgLatency: 299, AggMaxLatency: 399},
+		{AggSchemaName: "test", AggDigest: "stable", AggExecCount: 10, AggAvgLatency: 109, AggMaxLatency: 209},
+		{AggSchemaName: "test", AggDigest: "replanned", AggExecCount: 10, AggAvgLatency: 99, AggMaxLatency: 199},
+		{AggSchemaName: "test", AggDigest: "rare", AggExecCount: 1, AggAvgLatency: 999, AggMaxLatency: 999},
+		{AggSchemaName: "test", AggDigest: "new", AggExecCount: 10, AggAvgLatency: 999, AggMaxLatency: 999},
+	}
+	basePlans := map[stmtKey][]string{
+		{"test", "slower"}:    {"p1"},
+		{"test", "stable"}:    {"p1", "p2"},
+		{"test", "replanned"}: {"p1"},
+	}
+	targetPlans := map[stmtKey][]string{
+		{"test", "slower"}:    {"p1"},
+		{"test", "stable"}:    {"p2", "p1"},
+		{"test", "replanned"}: {"p3"},
+	}
+	thresholds := CompareThresholds{MinExecCount: 5}
+	thresholds.adjust()
+
+	result := compareStatements(base, target, basePlans, targetPlans, thresholds, 0)
+	c.Assert(result, HasLen, 2)
+
+	c.Assert(result[0].Digest, Equals, "slower")
+	c.Assert(result[0].AvgLatencyRatio, Equals, 3.0)
+	c.Assert(result[0].MaxLatencyRatio, Equals, 2.0)
+	c.Assert(result[0].PlanChanged, Equals, false)
+	c.Assert(result[0].Reasons, DeepEquals, []string{RegressionAvgLatency, RegressionMaxLatency})
+
+	c.Assert(result[1].Digest, Equals, "replanned")
+	c.Assert(result[1].PlanChanged, Equals, true)
+	c.Assert(result[1].Base.PlanDigests, DeepEquals, []string{"p1"})
+	c.Assert(result[1].Target.PlanDigests, DeepEquals, []string{"p3"})
+	c.Assert(result[1].Reasons, DeepEquals, []string{RegressionPlanChanged})
+
+	c.Assert(compareStatements(base, target, basePlans, targetPlans, thresholds, 1), HasLen, 1)
+}
+
+func (t *testCompareSuite) Test_ratio(c *C) {
+	c.Assert(ratio(0, 0), Equals, 1.0)
+	c.Assert(ratio(0, 9), Equals, 10.0)
+	c.Assert(ratio(9, 0), Equals, 0.1)
+}
@@ -14,9 +14,14 @@
 package statement
 
 import (
+	"path"
 	"testing"
 
 	. "github.com/pingcap/check"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/pingcap/tidb-dashboard/pkg/dbstore"
 )
 
 func TestT(t *testing.T) {
@@ -24,6 +29,13 @@ func TestT(t *testing.T) {
 	TestingT(t)
 }
 
+// newTestDB returns a local store in the temporary directory of the test.
+func newTestDB(c *C) *dbstore.DB {
+	gormDB, err := gorm.Open(sqlite.Open(path.Join(c.MkDir(), "test.sqlite.db")))
+	c.Assert(err, IsNil)
+	return &dbstore.DB{DB: gormDB}
+}
+
 var _ = Suite(&testConfigSuite{})
 
 type testConfigSuite struct{}
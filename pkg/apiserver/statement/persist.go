@@ -0,0 +1,387 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statement
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/pingcap/tidb-dashboard/pkg/config"
+	"github.com/pingcap/tidb-dashboard/pkg/dbstore"
+)
+
+const (
+	historyTable = "statement_history"
+
+	historySyncInterval = time.Minute
+	historyGCInterval   = time.Hour
+	historyBatchSize    = 100
+)
+
+// localAggregationReplacer rewrites the TiDB specific functions used in the `agg` tags of `Model`
+// into the SQLite equivalents. Time columns are persisted as unix timestamps, so `UNIX_TIMESTAMP`
+// is not needed any more.
+var localAggregationReplacer = strings.NewReplacer(
+	"ANY_VALUE(", "MAX(",
+	"UNIX_TIMESTAMP(", "(",
+)
+
+// HistoryModel holds the key columns of a persisted statement summary row. All other columns of
+// `CLUSTER_STATEMENTS_SUMMARY_HISTORY` are added on demand, since they vary among TiDB versions.
+type HistoryModel struct {
+	SummaryBeginTime int64  `gorm:"uniqueIndex:idx_statement_history_key"`
+	SummaryEndTime   int64  `gorm:"index"`
+	Instance         string `gorm:"uniqueIndex:idx_statement_history_key"`
+	SchemaName       string `gorm:"uniqueIndex:idx_statement_history_key"`
+	Digest           string `gorm:"uniqueIndex:idx_statement_history_key"`
+	PlanDigest       string `gorm:"uniqueIndex:idx_statement_history_key"`
+}
+
+func (HistoryModel) TableName() string {
+	return historyTable
+}
+
+// historyTextKeyColumns may be NULL in TiDB, which would bypass the unique index in SQLite.
+var historyTextKeyColumns = []string{"instance", "schema_name", "digest", "plan_digest"}
+
+// historyStore snapshots the statement summary windows into the local store, so that they are still
+// available after TiDB evicts them according to `tidb_stmt_summary_history_size`.
+//
+// Snapshots are taken in background every `historySyncInterval` with the service TiDB credential if it is
+// configured, and through the TiDB connection of the statement requests that read the local store.
+type historyStore struct {
+	db *dbstore.DB
+
+	mu         sync.Mutex
+	config     config.StatementConfig
+	columns    map[string]struct{}
+	lastSyncAt time.Time
+}
+
+func newHistoryStore(db *dbstore.DB) (*historyStore, error) {
+	if err := db.AutoMigrate(&HistoryModel{}); err != nil {
+		return nil, err
+	}
+	h := &historyStore{
+		db:     db,
+		config: config.StatementConfig{PersistenceDisabled: true},
+	}
+	if err := h.loadColumns(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (h *historyStore) loadColumns() error {
+	rows, err := h.db.Table(historyTable).Limit(0).Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	h.columns = make(map[string]struct{}, len(cols))
+	for _, col := range cols {
+		h.columns[strings.ToLower(col)] = struct{}{}
+	}
+	return nil
+}
+
+func (h *historyStore) setConfig(cfg config.StatementConfig) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.config = cfg
+}
+
+func (h *historyStore) isEnabled() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return !h.config.PersistenceDisabled
+}
+
+func (h *historyStore) columnNames() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	cols := make([]string, 0, len(h.columns))
+	for col := range h.columns {
+		cols = append(cols, col)
+	}
+	sort.Strings(cols)
+	return cols
+}
+
+// ensureColumns adds the columns that exist in TiDB but not in the local table yet.
+// Must be called with `h.mu` held.
+func (h *historyStore) ensureColumns(colTypes []*sql.ColumnType) error {
+	for _, ct := range colTypes {
+		name := strings.ToLower(ct.Name())
+		if _, ok := h.columns[name]; ok {
+			continue
+		}
+		stmt := fmt.Sprintf("ALTER TABLE `%s` ADD COLUMN `%s` %s", historyTable, name, localColumnType(ct.DatabaseTypeName())) //nolint:gosec
+		if err := h.db.Exec(stmt).Error; err != nil {
+			return err
+		}
+		h.columns[name] = struct{}{}
+	}
+	return nil
+}
+
+func localColumnType(tidbType string) string {
+	t := strings.ToUpper(tidbType)
+	switch {
+	case strings.Contains(t, "DATE"), strings.Contains(t, "TIME"):
+		// Persisted as unix timestamps.
+		return "INTEGER"
+	case strings.Contains(t, "INT"), strings.Contains(t, "DECIMAL"), strings.Contains(t, "DOUBLE"), strings.Contains(t, "FLOAT"):
+		return "NUMERIC"
+	default:
+		return "TEXT"
+	}
+}
+
+func toLocalValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case time.Time:
+		return v.Unix()
+	case []byte:
+		return string(v)
+	default:
+		return v
+	}
+}
+
+// sync copies the new windows from TiDB, at most once every `historySyncInterval`.
+func (h *historyStore) sync(tidbDB *gorm.DB) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if time.Since(h.lastSyncAt) < historySyncInterval {
+		return nil
+	}
+	return h.copyLatest(tidbDB)
+}
+
+// copyLatest copies the windows that are newer than or equal to the latest persisted window from TiDB.
+// The latest persisted window may be still in progress when it was copied, so it is copied again.
+// Must be called with `h.mu` held.
+func (h *historyStore) copyLatest(tidbDB *gorm.DB) error {
+	var since sql.NullInt64
+	if err := h.db.Table(historyTable).Select("MAX(summary_begin_time)").Row().Scan(&since); err != nil {
+		return err
+	}
+
+	rows, err := tidbDB.
+		Table(statementsTable).
+		Where("summary_begin_time >= FROM_UNIXTIME(?)", since.Int64).
+		Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	colTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return err
+	}
+	if err := h.ensureColumns(colTypes); err != nil {
+		return err
+	}
+
+	records := make([]map[string]interface{}, 0)
+	windows := make(map[int64]struct{})
+	for rows.Next() {
+		values := make([]interface{}, len(colTypes))
+		ptrs := make([]interface{}, len(colTypes))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return err
+		}
+		record := make(map[string]interface{}, len(colTypes))
+		for i, ct := range colTypes {
+			record[strings.ToLower(ct.Name())] = toLocalValue(values[i])
+		}
+		for _, key := range historyTextKeyColumns {
+			if record[key] == nil {
+				record[key] = ""
+			}
+		}
+		if begin, ok := record["summary_begin_time"].(int64); ok {
+			windows[begin] = struct{}{}
+		}
+		records = append(records, record)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	windowList := make([]int64, 0, len(windows))
+	for w := range windows {
+		windowList = append(windowList, w)
+	}
+
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if len(windowList) > 0 {
+			if err := tx.Where("summary_begin_time IN (?)", windowList).Delete(&HistoryModel{}).Error; err != nil {
+				return err
+			}
+		}
+		for i := 0; i < len(records); i += historyBatchSize {
+			end := i + historyBatchSize
+			if end > len(records) {
+				end = len(records)
+			}
+			batch := records[i:end]
+			if err := tx.Table(historyTable).Clauses(clause.OnConflict{DoNothing: true}).Create(&batch).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	h.lastSyncAt = time.Now()
+	return nil
+}
+
+// gc removes the windows that are beyond the retention.
+func (h *historyStore) gc() error {
+	h.mu.Lock()
+	retention := time.Duration(h.config.PersistenceRetentionDays) * 24 * time.Hour
+	h.mu.Unlock()
+	if retention == 0 {
+		return nil
+	}
+	return h.db.
+		Where("summary_end_time < ?", time.Now().Add(-retention).Unix()).
+		Delete(&HistoryModel{}).
+		Error
+}
+
+func (h *historyStore) queryTimeRanges() (result []*TimeRange, err error) {
+	err = h.db.
+		Table(historyTable).
+		Select("DISTINCT summary_begin_time AS begin_time, summary_end_time AS end_time").
+		Order("begin_time DESC, end_time DESC").
+		Find(&result).Error
+	return
+}
+
+// mergeTimeRanges merges the time ranges from TiDB and from the local store. The ranges from
+// TiDB take precedence, since the latest window may be still in progress.
+func mergeTimeRanges(live, local []*TimeRange) []*TimeRange {
+	seen := make(map[int64]struct{}, len(live))
+	result := make([]*TimeRange, 0, len(live)+len(local))
+	for _, r := range live {
+		seen[r.BeginTime] = struct{}{}
+		result = append(result, r)
+	}
+	for _, r := range local {
+		if _, ok := seen[r.BeginTime]; ok {
+			continue
+		}
+		result = append(result, r)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].BeginTime == result[j].BeginTime {
+			return result[i].EndTime > result[j].EndTime
+		}
+		return result[i].BeginTime > result[j].BeginTime
+	})
+	return result
+}
+
+// stmtSource is the table that statement summaries are read from, which is either the TiDB system table
+// or the persisted history in the local store.
+type stmtSource struct {
+	db      *gorm.DB
+	table   string
+	columns []string
+	isLocal bool
+}
+
+func (src *stmtSource) genSelectStmt(s *Service, reqJSONColumns []string) (string, error) {
+	stmt, err := s.genSelectStmt(src.columns, reqJSONColumns)
+	if err != nil || !src.isLocal {
+		return stmt, err
+	}
+	return localAggregationReplacer.Replace(stmt), nil
+}
+
+func (src *stmtSource) inTimeRange(beginTime, endTime int) *gorm.DB {
+	query := src.db.Table(src.table)
+	if src.isLocal {
+		return query.Where("summary_begin_time >= ? AND summary_end_time <= ?", beginTime, endTime)
+	}
+	return query.Where("summary_begin_time >= FROM_UNIXTIME(?) AND summary_end_time <= FROM_UNIXTIME(?)", beginTime, endTime)
+}
+
+// unixTime returns the expression of a time column in unix seconds.
+func (src *stmtSource) unixTime(column string) string {
+	if src.isLocal {
+		return column
+	}
+	return fmt.Sprintf("FLOOR(UNIX_TIMESTAMP(%s))", column)
+}
+
+// getStmtSource returns the local store when the requested time range starts before the oldest window
+// that TiDB still keeps, otherwise returns TiDB itself. The local store is synced at most once every
+// `historySyncInterval` before it is returned, so the windows newer than the last sync may be missing.
+func (s *Service) getStmtSource(db *gorm.DB, beginTime int) (*stmtSource, error) {
+	if s.history.isEnabled() {
+		var oldest sql.NullInt64
+		err := db.
+			Table(statementsTable).
+			Select("FLOOR(UNIX_TIMESTAMP(MIN(summary_begin_time)))").
+			Row().
+			Scan(&oldest)
+		if err != nil {
+			return nil, err
+		}
+		if !oldest.Valid || int64(beginTime) < oldest.Int64 {
+			if err := s.history.sync(db); err != nil {
+				return nil, err
+			}
+			return &stmtSource{
+				db:      s.history.db.DB,
+				table:   historyTable,
+				columns: s.history.columnNames(),
+				isLocal: true,
+			}, nil
+		}
+	}
+
+	tableColumns, err := s.params.SysSchema.GetTableColumnNames(db, statementsTable)
+	if err != nil {
+		return nil, err
+	}
+	return &stmtSource{
+		db:      db,
+		table:   statementsTable,
+		columns: tableColumns,
+	}, nil
+}
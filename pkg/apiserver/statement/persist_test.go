@@ -0,0 +1,109 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statement
+
+import (
+	. "github.com/pingcap/check"
+)
+
+var _ = Suite(&testPersistSuite{})
+
+type testPersistSuite struct {
+	history *historyStore
+}
+
+func (t *testPersistSuite) SetUpTest(c *C) {
+	var err error
+	t.history, err = newHistoryStore(newTestDB(c))
+	c.Assert(err, IsNil)
+}
+
+func (t *testPersistSuite) insertRows(c *C, rows []map[string]interface{}) {
+	for col, colType := range map[string]string{
+		"digest_text": "TEXT",
+		"table_names": "TEXT",
+		"exec_count":  "NUMERIC",
+		"sum_latency": "NUMERIC",
+		"max_latency": "NUMERIC",
+		"avg_latency": "NUMERIC",
+		"first_seen":  "INTEGER",
+		"last_seen":   "INTEGER",
+	} {
+		err := t.history.db.Exec("ALTER TABLE " + historyTable + " ADD COLUMN " + col + " " + colType).Error
+		c.Assert(err, IsNil)
+	}
+	c.Assert(t.history.loadColumns(), IsNil)
+	c.Assert(t.history.db.Table(historyTable).Create(&rows).Error, IsNil)
+}
+
+func (t *testPersistSuite) Test_localAggregation(c *C) {
+	t.insertRows(c, []map[string]interface{}{
+		{"summary_begin_time": 1000, "summary_end_time": 1100, "instance": "a", "schema_name": "test", "digest": "d1", "plan_digest": "p1",
+			"digest_text": "select ?", "table_names": "test.t1", "exec_count": 1, "sum_latency": 100, "max_latency": 100, "avg_latency": 100, "first_seen": 1010, "last_seen": 1020},
+		{"summary_begin_time": 1100, "summary_end_time": 1200, "instance": "a", "schema_name": "test", "digest": "d1", "plan_digest": "p2",
+			"digest_text": "select ?", "table_names": "test.t1", "exec_count": 3, "sum_latency": 600, "max_latency": 300, "avg_latency": 200, "first_seen": 1110, "last_seen": 1150},
+		{"summary_begin_time": 1100, "summary_end_time": 1200, "instance": "a", "schema_name": "test", "digest": "d2", "plan_digest": "p3",
+			"digest_text": "update ?", "table_names": "other.t2", "exec_count": 1, "sum_latency": 50, "max_latency": 50, "avg_latency": 50, "first_seen": 1120, "last_seen": 1120},
+	})
+
+	src := &stmtSource{
+		db:      t.history.db.DB,
+		table:   historyTable,
+		columns: t.history.columnNames(),
+		isLocal: true,
+	}
+	s := &Service{history: t.history}
+	selectStmt, err := src.genSelectStmt(s, []string{"digest_text", "exec_count", "max_latency", "avg_latency", "first_seen", "last_seen", "plan_count"})
+	c.Assert(err, IsNil)
+
+	var result []Model
+	err = src.inTimeRange(1000, 1200).
+		Select(selectStmt).
+		Group("schema_name, digest").
+		Order("agg_sum_latency DESC").
+		Find(&result).Error
+	c.Assert(err, IsNil)
+	c.Assert(result, HasLen, 2)
+	c.Assert(result[0].AggDigest, Equals, "d1")
+	c.Assert(result[0].AggExecCount, Equals, 4)
+	c.Assert(result[0].AggSumLatency, Equals, 700)
+	c.Assert(result[0].AggMaxLatency, Equals, 300)
+	c.Assert(result[0].AggAvgLatency, Equals, 175)
+	c.Assert(result[0].AggFirstSeen, Equals, 1010)
+	c.Assert(result[0].AggLastSeen, Equals, 1150)
+	c.Assert(result[0].AggPlanCount, Equals, 2)
+	c.Assert(result[1].AggDigest, Equals, "d2")
+
+	timeRanges, err := t.history.queryTimeRanges()
+	c.Assert(err, IsNil)
+	c.Assert(timeRanges, DeepEquals, []*TimeRange{{BeginTime: 1100, EndTime: 1200}, {BeginTime: 1000, EndTime: 1100}})
+}
+
+func (t *testPersistSuite) Test_mergeTimeRanges(c *C) {
+	live := []*TimeRange{{BeginTime: 1200, EndTime: 1300}, {BeginTime: 1100, EndTime: 1200}}
+	local := []*TimeRange{{BeginTime: 1100, EndTime: 1150}, {BeginTime: 1000, EndTime: 1100}}
+	c.Assert(mergeTimeRanges(live, local), DeepEquals, []*TimeRange{
+		{BeginTime: 1200, EndTime: 1300},
+		{BeginTime: 1100, EndTime: 1200},
+		{BeginTime: 1000, EndTime: 1100},
+	})
+}
+
+func (t *testPersistSuite) Test_localColumnType(c *C) {
+	c.Assert(localColumnType("DATETIME"), Equals, "INTEGER")
+	c.Assert(localColumnType("BIGINT UNSIGNED"), Equals, "NUMERIC")
+	c.Assert(localColumnType("DOUBLE"), Equals, "NUMERIC")
+	c.Assert(localColumnType("VARCHAR"), Equals, "TEXT")
+	c.Assert(localColumnType("TEXT"), Equals, "TEXT")
+}
@@ -0,0 +1,173 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statement
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/pingcap/tidb-dashboard/pkg/dbstore"
+)
+
+var (
+	ErrBindingNotSupported = ErrNS.NewType("binding_not_supported")
+
+	// Statement summary appends the original length to a truncated sample, e.g. `select ...(len:12345)`.
+	truncatedSampleRegexp = regexp.MustCompile(`\(len:\d+\)$`)
+	bindableStmtRegexp    = regexp.MustCompile(`(?i)^\s*(select|update|delete|insert|replace)\b`)
+)
+
+type PlanHistoryItem struct {
+	BeginTime     int64  `json:"begin_time"`
+	EndTime       int64  `json:"end_time"`
+	AggPlanDigest string `json:"plan_digest"`
+	AggExecCount  int    `json:"exec_count"`
+	AggAvgLatency int    `json:"avg_latency"`
+	AggMaxLatency int    `json:"max_latency"`
+}
+
+// queryPlanHistory returns the plans of a statement in each of the retained windows.
+func (s *Service) queryPlanHistory(db *gorm.DB, schemaName, digest string) (result []PlanHistoryItem, err error) {
+	src, err := s.getStmtSource(db, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	selectStmt, err := src.genSelectStmt(s, []string{
+		"plan_digest",
+		"exec_count",
+		"avg_latency",
+		"max_latency"})
+	if err != nil {
+		return nil, err
+	}
+
+	err = src.db.
+		Table(src.table).
+		Select(fmt.Sprintf("%s AS begin_time, %s AS end_time, %s",
+			src.unixTime("summary_begin_time"),
+			src.unixTime("summary_end_time"),
+			selectStmt)).
+		Where("schema_name = ?", schemaName).
+		Where("digest = ?", digest).
+		Group("summary_begin_time, summary_end_time, plan_digest").
+		Order("begin_time ASC, plan_digest ASC").
+		Find(&result).
+		Error
+	return
+}
+
+// BindingAuditModel records a plan binding applied from Dashboard.
+type BindingAuditModel struct {
+	ID         uint   `json:"id" gorm:"primary_key"`
+	CreatedAt  int64  `json:"created_at" gorm:"index"`
+	User       string `json:"user"`
+	SchemaName string `json:"schema_name"`
+	Digest     string `json:"digest"`
+	PlanDigest string `json:"plan_digest"`
+	SQL        string `json:"sql" gorm:"type:text"`
+	Error      string `json:"error" gorm:"type:text"`
+}
+
+func (BindingAuditModel) TableName() string {
+	return "statement_binding_audits"
+}
+
+func autoMigrate(db *dbstore.DB) error {
+	return db.AutoMigrate(&BindingAuditModel{})
+}
+
+// buildBindingSQL builds the SQL that binds the statement to the plan described by the hints.
+func buildBindingSQL(sampleText, planHint string) (string, error) {
+	sampleText = strings.TrimRight(strings.TrimSpace(sampleText), ";")
+	if sampleText == "" {
+		return "", ErrBindingNotSupported.New("no sample query of the plan is recorded")
+	}
+	if truncatedSampleRegexp.MatchString(sampleText) {
+		return "", ErrBindingNotSupported.New("the sample query of the plan is truncated")
+	}
+	if strings.TrimSpace(planHint) == "" {
+		return "", ErrBindingNotSupported.New("no hint of the plan is recorded")
+	}
+	loc := bindableStmtRegexp.FindStringSubmatchIndex(sampleText)
+	if loc == nil {
+		return "", ErrBindingNotSupported.New("only SELECT, UPDATE, DELETE, INSERT and REPLACE statements can be bound")
+	}
+	// Insert the hints right after the leading keyword, e.g. `SELECT /*+ ... */ ...`.
+	keywordEnd := loc[3]
+	hinted := fmt.Sprintf("%s /*+ %s */%s", sampleText[:keywordEnd], planHint, sampleText[keywordEnd:])
+	return fmt.Sprintf("CREATE GLOBAL BINDING FOR %s USING %s", sampleText, hinted), nil
+}
+
+func quoteIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+func (s *Service) genPlanBinding(db *gorm.DB, req *PlanBindingRequest) (string, error) {
+	plan, err := s.queryPlanDetail(db, req.BeginTime, req.EndTime, req.SchemaName, req.Digest, []string{req.PlanDigest})
+	if err != nil {
+		return "", err
+	}
+	if plan.AggPlanDigest == "" {
+		return "", ErrBindingNotSupported.New("plan %s is not found in the time range", req.PlanDigest)
+	}
+	return buildBindingSQL(plan.AggQuerySampleText, plan.AggPlanHint)
+}
+
+// execInSchema executes the SQL with the schema as the default database. It runs on a dedicated connection so
+// that the `USE` does not leak into the pooled session, and the `USE` is skipped if the schema is empty.
+func execInSchema(db *gorm.DB, schemaName, sql string) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	ctx := db.Statement.Context
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close() //nolint:errcheck
+	if schemaName != "" {
+		if _, err := conn.ExecContext(ctx, "USE "+quoteIdentifier(schemaName)); err != nil {
+			return err
+		}
+	}
+	_, err = conn.ExecContext(ctx, sql)
+	return err
+}
+
+// applyPlanBinding executes the binding SQL in the schema of the statement, and records the action.
+func (s *Service) applyPlanBinding(db *gorm.DB, user string, req *PlanBindingRequest, bindingSQL string) error {
+	execErr := execInSchema(db, req.SchemaName, bindingSQL)
+
+	audit := &BindingAuditModel{
+		CreatedAt:  time.Now().Unix(),
+		User:       user,
+		SchemaName: req.SchemaName,
+		Digest:     req.Digest,
+		PlanDigest: req.PlanDigest,
+		SQL:        bindingSQL,
+	}
+	if execErr != nil {
+		audit.Error = execErr.Error()
+	}
+	if err := s.params.LocalStore.Create(audit).Error; err != nil {
+		return err
+	}
+	return execErr
+}
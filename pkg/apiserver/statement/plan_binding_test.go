@@ -0,0 +1,65 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statement
+
+import (
+	"github.com/joomcode/errorx"
+	. "github.com/pingcap/check"
+)
+
+var _ = Suite(&testPlanBindingSuite{})
+
+type testPlanBindingSuite struct{}
+
+func (t *testPlanBindingSuite) Test_buildBindingSQL_success(c *C) {
+	sql, err := buildBindingSQL("select * from t where a = 1;", "use_index(@`sel_1` `test`.`t` `idx_a`)")
+	c.Assert(err, IsNil)
+	c.Assert(sql, Equals, "CREATE GLOBAL BINDING FOR select * from t where a = 1 USING select /*+ use_index(@`sel_1` `test`.`t` `idx_a`) */ * from t where a = 1")
+
+	sql, err = buildBindingSQL("  UPDATE t SET b = 2 WHERE a = 1", "use_index(@`upd_1` `test`.`t` )")
+	c.Assert(err, IsNil)
+	c.Assert(sql, Equals, "CREATE GLOBAL BINDING FOR UPDATE t SET b = 2 WHERE a = 1 USING UPDATE /*+ use_index(@`upd_1` `test`.`t` ) */ t SET b = 2 WHERE a = 1")
+}
+
+func (t *testPlanBindingSuite) Test_buildBindingSQL_not_supported(c *C) {
+	for _, sample := range []struct {
+		text string
+		hint string
+	}{
+		{"", "use_index(t)"},
+		{"select * from t", ""},
+		{"select * from t where a in (1, 2, 3(len:10000)", "use_index(t)"},
+		{"show tables", "use_index(t)"},
+		{"selectx from t", "use_index(t)"},
+	} {
+		_, err := buildBindingSQL(sample.text, sample.hint)
+		c.Assert(errorx.IsOfType(err, ErrBindingNotSupported), IsTrue, Commentf("sample: %q", sample.text))
+	}
+}
+
+func (t *testPlanBindingSuite) Test_quoteIdentifier(c *C) {
+	c.Assert(quoteIdentifier("test"), Equals, "`test`")
+	c.Assert(quoteIdentifier("te`st"), Equals, "`te``st`")
+}
+
+func (t *testPlanBindingSuite) Test_execInSchema(c *C) {
+	db := newTestDB(c).DB
+
+	// No `USE` is executed for an empty schema, which SQLite does not support either.
+	c.Assert(execInSchema(db, "", "CREATE TABLE t (a INTEGER)"), IsNil)
+	c.Assert(db.Migrator().HasTable("t"), IsTrue)
+
+	c.Assert(execInSchema(db, "test", "CREATE TABLE t2 (a INTEGER)"), NotNil)
+	c.Assert(db.Migrator().HasTable("t2"), IsFalse)
+}
@@ -19,12 +19,22 @@ import (
 	"strings"
 
 	"gorm.io/gorm"
+
+	"github.com/pingcap/tidb-dashboard/pkg/utils/sqldigest"
 )
 
 const (
 	statementsTable = "INFORMATION_SCHEMA.CLUSTER_STATEMENTS_SUMMARY_HISTORY"
+
+	// TextModeKeyword matches the keywords in the text against the digest text, the digest, the schema name,
+	// the table names and the plan.
+	TextModeKeyword = ""
+	// TextModeFingerprint normalizes the text as a SQL and matches the statements of the same digest.
+	TextModeFingerprint = "fingerprint"
 )
 
+var ErrUnknownTextMode = ErrNS.NewType("unknown_text_mode")
+
 func queryTimeRanges(db *gorm.DB) (result []*TimeRange, err error) {
 	err = db.
 		Select(`
@@ -55,47 +65,98 @@ func queryStmtTypes(db *gorm.DB) (result []string, err error) {
 // schemas: ["tpcc", "test"]
 // stmtTypes: ["select", "update"]
 // fields: ["digest_text", "sum_latency"]
+// textMode: "fingerprint" to look up statements of the same digest as text, empty for keyword matching
+// orderBy: "sum_cop_task_num", empty for "sum_latency" in descending order
+// isDesc: the order direction, which also applies to the virtual field "resource_score"
 func (s *Service) queryStatements(
 	db *gorm.DB,
 	beginTime, endTime int,
 	schemas, stmtTypes []string,
-	text string,
+	text, textMode string,
 	reqFields []string,
+	orderBy string,
+	isDesc bool,
 ) (result []Model, err error) {
-	tableColumns, err := s.params.SysSchema.GetTableColumnNames(db, statementsTable)
+	src, err := s.getStmtSource(db, beginTime)
 	if err != nil {
 		return nil, err
 	}
 
-	selectStmt, err := s.genSelectStmt(tableColumns, reqFields)
+	if orderBy == "" {
+		orderBy, isDesc = "sum_latency", true
+	}
+	// Copy the fields, so that appending to them does not modify the caller's slice.
+	reqFields = append([]string{}, reqFields...)
+	isResourceScore := orderBy == resourceScoreField
+	if isResourceScore {
+		// The statements are ranked after the query, and ties are kept in the order of the latency.
+		reqFields = append(reqFields, resourceScoreFields...)
+		orderBy = "sum_latency"
+	} else if len(reqFields) == 0 || reqFields[0] != "*" {
+		reqFields = append(reqFields, orderBy)
+	}
+
+	selectStmt, err := src.genSelectStmt(s, reqFields)
+	if err != nil {
+		return nil, err
+	}
+	orderStmt, err := s.genOrderStmt(src.columns, orderBy, isDesc)
 	if err != nil {
 		return nil, err
 	}
 
-	query := db.
+	query := src.inTimeRange(beginTime, endTime).
 		Select(selectStmt).
-		Table(statementsTable).
-		Where("summary_begin_time >= FROM_UNIXTIME(?) AND summary_end_time <= FROM_UNIXTIME(?)", beginTime, endTime).
 		Group("schema_name, digest").
-		Order("agg_sum_latency DESC")
+		Order(orderStmt)
 
 	if len(schemas) > 0 {
-		regex := make([]string, 0, len(schemas))
-		for _, schema := range schemas {
-			regex = append(regex, fmt.Sprintf("\\b%s\\.", regexp.QuoteMeta(schema)))
+		if src.isLocal {
+			conds := make([]string, 0, len(schemas))
+			args := make([]interface{}, 0, len(schemas))
+			for _, schema := range schemas {
+				conds = append(conds, "INSTR(',' || REPLACE(table_names, ' ', ''), ?) > 0")
+				args = append(args, ","+schema+".")
+			}
+			query = query.Where(strings.Join(conds, " OR "), args...)
+		} else {
+			regex := make([]string, 0, len(schemas))
+			for _, schema := range schemas {
+				regex = append(regex, fmt.Sprintf("\\b%s\\.", regexp.QuoteMeta(schema)))
+			}
+			regexAll := strings.Join(regex, "|")
+			query = query.Where("table_names REGEXP ?", regexAll)
 		}
-		regexAll := strings.Join(regex, "|")
-		query = query.Where("table_names REGEXP ?", regexAll)
 	}
 
 	if len(stmtTypes) > 0 {
 		query = query.Where("stmt_type in (?)", stmtTypes)
 	}
 
-	if len(text) > 0 {
+	switch {
+	case len(text) == 0:
+	case textMode == TextModeFingerprint:
+		query = query.Where(
+			"digest IN (?) OR "+sqldigest.UnquotedDigestTextExpr+" = ?",
+			sqldigest.CandidateDigests(text),
+			sqldigest.Normalize(text),
+		)
+	case textMode == TextModeKeyword:
 		lowerText := strings.ToLower(text)
 		arr := strings.Fields(lowerText)
 		for _, v := range arr {
+			if src.isLocal {
+				// SQLite does not support REGEXP, so the keywords are matched literally.
+				query = query.Where(
+					`INSTR(LOWER(digest_text), ?) > 0
+					 OR INSTR(LOWER(digest), ?) > 0
+					 OR INSTR(LOWER(schema_name), ?) > 0
+					 OR INSTR(LOWER(table_names), ?) > 0
+					 OR INSTR(LOWER(plan), ?) > 0`,
+					v, v, v, v, v,
+				)
+				continue
+			}
 			query = query.Where(
 				`LOWER(digest_text) REGEXP ?
 				 OR LOWER(digest) REGEXP ?
@@ -105,9 +166,14 @@ func (s *Service) queryStatements(
 				v, v, v, v, v,
 			)
 		}
+	default:
+		return nil, ErrUnknownTextMode.New("unknown text mode %s", textMode)
 	}
 
 	err = query.Find(&result).Error
+	if err == nil && isResourceScore {
+		rankByResourceScore(result, isDesc)
+	}
 	return
 }
 
@@ -116,12 +182,12 @@ func (s *Service) queryPlans(
 	beginTime, endTime int,
 	schemaName, digest string,
 ) (result []Model, err error) {
-	tableColumns, err := s.params.SysSchema.GetTableColumnNames(db, statementsTable)
+	src, err := s.getStmtSource(db, beginTime)
 	if err != nil {
 		return nil, err
 	}
 
-	selectStmt, err := s.genSelectStmt(tableColumns, []string{
+	selectStmt, err := src.genSelectStmt(s, []string{
 		"plan_digest",
 		"schema_name",
 		"digest_text",
@@ -137,10 +203,8 @@ func (s *Service) queryPlans(
 		return nil, err
 	}
 
-	err = db.
+	err = src.inTimeRange(beginTime, endTime).
 		Select(selectStmt).
-		Table(statementsTable).
-		Where("summary_begin_time >= FROM_UNIXTIME(?) AND summary_end_time <= FROM_UNIXTIME(?)", beginTime, endTime).
 		Where("schema_name = ?", schemaName).
 		Where("digest = ?", digest).
 		Group("plan_digest").
@@ -155,20 +219,18 @@ func (s *Service) queryPlanDetail(
 	schemaName, digest string,
 	plans []string,
 ) (result Model, err error) {
-	tableColumns, err := s.params.SysSchema.GetTableColumnNames(db, statementsTable)
+	src, err := s.getStmtSource(db, beginTime)
 	if err != nil {
 		return
 	}
 
-	selectStmt, err := s.genSelectStmt(tableColumns, []string{"*"})
+	selectStmt, err := src.genSelectStmt(s, []string{"*"})
 	if err != nil {
 		return
 	}
 
-	query := db.
+	query := src.inTimeRange(beginTime, endTime).
 		Select(selectStmt).
-		Table(statementsTable).
-		Where("summary_begin_time >= FROM_UNIXTIME(?) AND summary_end_time <= FROM_UNIXTIME(?)", beginTime, endTime).
 		Where("schema_name = ?", schemaName).
 		Where("digest = ?", digest)
 	if len(plans) > 0 {
@@ -0,0 +1,197 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statement
+
+import (
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// resourceScoreField is a virtual order by field, which ranks statements by a composite resource score.
+	resourceScoreField = "resource_score"
+
+	RollupBySchema = "schema"
+	RollupByTable  = "table"
+)
+
+var (
+	ErrUnknownRollup = ErrNS.NewType("unknown_rollup")
+
+	resourceScoreFields = []string{
+		"exec_count",
+		"sum_latency",
+		"sum_cop_task_num",
+		"sum_backoff_times",
+		"avg_processed_keys",
+		"avg_mem",
+	}
+
+	rollupFields = []string{
+		"table_names",
+		"exec_count",
+		"sum_latency",
+		"sum_errors",
+		"sum_cop_task_num",
+		"sum_backoff_times",
+		"avg_processed_keys",
+	}
+)
+
+// resourceDimensions are the total resource consumed by a statement, which composite the resource score.
+func resourceDimensions(m *Model) []float64 {
+	return []float64{
+		float64(m.AggSumLatency),
+		float64(m.AggSumCopTaskNum),
+		float64(m.AggSumBackoffTimes),
+		float64(m.AggExecCount) * float64(m.AggAvgProcessedKeys),
+		float64(m.AggExecCount) * float64(m.AggAvgMem),
+	}
+}
+
+// rankByResourceScore scores each statement by the average of its share in every resource dimension, compared
+// with the statement consuming the most of that resource, and sorts the statements by the score in the given
+// direction. Dimensions not available in current version TiDB are ignored.
+func rankByResourceScore(stmts []Model, isDesc bool) {
+	if len(stmts) == 0 {
+		return
+	}
+	dims := make([][]float64, len(stmts))
+	maxDims := make([]float64, len(resourceDimensions(&stmts[0])))
+	for i := range stmts {
+		dims[i] = resourceDimensions(&stmts[i])
+		for d, v := range dims[i] {
+			if v > maxDims[d] {
+				maxDims[d] = v
+			}
+		}
+	}
+	for i := range stmts {
+		score, n := 0.0, 0
+		for d, v := range dims[i] {
+			if maxDims[d] == 0 {
+				continue
+			}
+			score += v / maxDims[d]
+			n++
+		}
+		if n > 0 {
+			score /= float64(n)
+		}
+		stmts[i].ResourceScore = score
+	}
+	sort.SliceStable(stmts, func(i, j int) bool {
+		if isDesc {
+			return stmts[i].ResourceScore > stmts[j].ResourceScore
+		}
+		return stmts[i].ResourceScore < stmts[j].ResourceScore
+	})
+}
+
+type RollupItem struct {
+	Name             string `json:"name"`
+	StmtCount        int    `json:"stmt_count"`
+	ExecCount        int    `json:"exec_count"`
+	SumLatency       int    `json:"sum_latency"`
+	SumErrors        int    `json:"sum_errors"`
+	SumCopTaskNum    int    `json:"sum_cop_task_num"`
+	SumBackoffTimes  int    `json:"sum_backoff_times"`
+	SumProcessedKeys int    `json:"sum_processed_keys"`
+}
+
+var rollupOrders = map[string]func(item *RollupItem) int{
+	"stmt_count":         func(item *RollupItem) int { return item.StmtCount },
+	"exec_count":         func(item *RollupItem) int { return item.ExecCount },
+	"sum_latency":        func(item *RollupItem) int { return item.SumLatency },
+	"sum_errors":         func(item *RollupItem) int { return item.SumErrors },
+	"sum_cop_task_num":   func(item *RollupItem) int { return item.SumCopTaskNum },
+	"sum_backoff_times":  func(item *RollupItem) int { return item.SumBackoffTimes },
+	"sum_processed_keys": func(item *RollupItem) int { return item.SumProcessedKeys },
+}
+
+// rollupStatements sums up the statements by the schemas or the tables they access. A statement accessing
+// multiple tables is counted in each of them.
+func rollupStatements(stmts []Model, groupBy string, orderBy string) ([]*RollupItem, error) {
+	if groupBy != RollupBySchema && groupBy != RollupByTable {
+		return nil, ErrUnknownRollup.New("unknown group by %s", groupBy)
+	}
+	if orderBy == "" {
+		orderBy = "sum_latency"
+	}
+	orderValue, ok := rollupOrders[orderBy]
+	if !ok {
+		return nil, ErrUnknownColumn.New("unknown order by %s", orderBy)
+	}
+
+	items := make(map[string]*RollupItem)
+	for i := range stmts {
+		m := &stmts[i]
+		names := make(map[string]struct{})
+		for _, table := range strings.Split(m.AggTableNames, ",") {
+			table = strings.TrimSpace(table)
+			if table == "" {
+				continue
+			}
+			if groupBy == RollupBySchema {
+				table = strings.Split(table, ".")[0]
+			}
+			names[table] = struct{}{}
+		}
+		for name := range names {
+			item, ok := items[name]
+			if !ok {
+				item = &RollupItem{Name: name}
+				items[name] = item
+			}
+			item.StmtCount++
+			item.ExecCount += m.AggExecCount
+			item.SumLatency += m.AggSumLatency
+			item.SumErrors += m.AggSumErrors
+			item.SumCopTaskNum += m.AggSumCopTaskNum
+			item.SumBackoffTimes += m.AggSumBackoffTimes
+			item.SumProcessedKeys += m.AggExecCount * m.AggAvgProcessedKeys
+		}
+	}
+
+	result := make([]*RollupItem, 0, len(items))
+	for _, item := range items {
+		result = append(result, item)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		vi, vj := orderValue(result[i]), orderValue(result[j])
+		if vi == vj {
+			return result[i].Name < result[j].Name
+		}
+		return vi > vj
+	})
+	return result, nil
+}
+
+func (s *Service) queryRollup(db *gorm.DB, req *GetRollupRequest) ([]*RollupItem, error) {
+	stmts, err := s.queryStatements(
+		db,
+		req.BeginTime, req.EndTime,
+		req.Schemas,
+		req.StmtTypes,
+		req.Text,
+		req.TextMode,
+		rollupFields,
+		"", false)
+	if err != nil {
+		return nil, err
+	}
+	return rollupStatements(stmts, req.GroupBy, req.OrderBy)
+}
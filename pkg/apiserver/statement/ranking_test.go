@@ -0,0 +1,90 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statement
+
+import (
+	"github.com/joomcode/errorx"
+	. "github.com/pingcap/check"
+)
+
+var _ = Suite(&testRankingSuite{})
+
+type testRankingSuite struct{}
+
+func (t *testRankingSuite) Test_rankByResourceScore(c *C) {
+	stmts := []Model{
+		{AggDigest: "slow", AggExecCount: 1, AggSumLatency: 100, AggSumCopTaskNum: 1},
+		{AggDigest: "heavy", AggExecCount: 10, AggSumLatency: 50, AggSumCopTaskNum: 10, AggAvgProcessedKeys: 100},
+		{AggDigest: "light", AggExecCount: 1, AggSumLatency: 10},
+	}
+	rankByResourceScore(stmts, true)
+	c.Assert(stmts[0].AggDigest, Equals, "heavy")
+	c.Assert(stmts[1].AggDigest, Equals, "slow")
+	c.Assert(stmts[2].AggDigest, Equals, "light")
+	// (0.5 + 1 + 1) / 3, dimensions with all zero values are ignored.
+	c.Assert(stmts[0].ResourceScore, Equals, 2.5/3)
+	c.Assert(stmts[2].ResourceScore, Equals, 0.1/3)
+
+	rankByResourceScore(stmts, false)
+	c.Assert(stmts[0].AggDigest, Equals, "light")
+	c.Assert(stmts[1].AggDigest, Equals, "slow")
+	c.Assert(stmts[2].AggDigest, Equals, "heavy")
+}
+
+func (t *testRankingSuite) Test_rollupStatements(c *C) {
+	stmts := []Model{
+		{AggTableNames: "db1.t1,db1.t2", AggExecCount: 2, AggSumLatency: 100, AggAvgProcessedKeys: 10},
+		{AggTableNames: "db1.t1", AggExecCount: 1, AggSumLatency: 10},
+		{AggTableNames: "db2.t1, db2.t1", AggExecCount: 5, AggSumLatency: 20},
+		{AggTableNames: "", AggExecCount: 100, AggSumLatency: 1000},
+	}
+
+	byTable, err := rollupStatements(stmts, RollupByTable, "")
+	c.Assert(err, IsNil)
+	c.Assert(byTable, DeepEquals, []*RollupItem{
+		{Name: "db1.t1", StmtCount: 2, ExecCount: 3, SumLatency: 110, SumProcessedKeys: 20},
+		{Name: "db1.t2", StmtCount: 1, ExecCount: 2, SumLatency: 100, SumProcessedKeys: 20},
+		{Name: "db2.t1", StmtCount: 1, ExecCount: 5, SumLatency: 20},
+	})
+
+	bySchema, err := rollupStatements(stmts, RollupBySchema, "exec_count")
+	c.Assert(err, IsNil)
+	c.Assert(bySchema, DeepEquals, []*RollupItem{
+		{Name: "db2", StmtCount: 1, ExecCount: 5, SumLatency: 20},
+		{Name: "db1", StmtCount: 2, ExecCount: 3, SumLatency: 110, SumProcessedKeys: 20},
+	})
+
+	_, err = rollupStatements(stmts, "instance", "")
+	c.Assert(errorx.IsOfType(err, ErrUnknownRollup), IsTrue)
+	_, err = rollupStatements(stmts, RollupByTable, "avg_mem")
+	c.Assert(errorx.IsOfType(err, ErrUnknownColumn), IsTrue)
+}
+
+func (t *testRankingSuite) Test_genOrderStmt(c *C) {
+	s := &Service{}
+	tableColumns := []string{"SCHEMA_NAME", "DIGEST", "EXEC_COUNT", "SUM_COP_TASK_NUM", "PLAN_DIGEST"}
+
+	order, err := s.genOrderStmt(tableColumns, "sum_cop_task_num", true)
+	c.Assert(err, IsNil)
+	c.Assert(order, Equals, "agg_sum_cop_task_num DESC")
+
+	order, err = s.genOrderStmt(tableColumns, "plan_count", false)
+	c.Assert(err, IsNil)
+	c.Assert(order, Equals, "agg_plan_count ASC")
+
+	_, err = s.genOrderStmt(tableColumns, "avg_mem", true)
+	c.Assert(errorx.IsOfType(err, ErrUnknownColumn), IsTrue)
+	_, err = s.genOrderStmt(tableColumns, "related_schemas", true)
+	c.Assert(errorx.IsOfType(err, ErrUnknownColumn), IsTrue)
+}
@@ -14,9 +14,11 @@
 package statement
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/joomcode/errorx"
@@ -24,10 +26,14 @@ import (
 
 	"github.com/gin-gonic/gin"
 
+	"github.com/pingcap/log"
 	"go.uber.org/fx"
+	"go.uber.org/zap"
 
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/user"
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/utils"
+	"github.com/pingcap/tidb-dashboard/pkg/config"
+	"github.com/pingcap/tidb-dashboard/pkg/dbstore"
 	"github.com/pingcap/tidb-dashboard/pkg/tidb"
 	commonUtils "github.com/pingcap/tidb-dashboard/pkg/utils"
 )
@@ -39,16 +45,89 @@ var (
 
 type ServiceParams struct {
 	fx.In
-	TiDBClient *tidb.Client
-	SysSchema  *commonUtils.SysSchema
+	Config        *config.Config
+	TiDBClient    *tidb.Client
+	SysSchema     *commonUtils.SysSchema
+	LocalStore    *dbstore.DB
+	ConfigManager *config.DynamicConfigManager
 }
 
 type Service struct {
-	params ServiceParams
+	params  ServiceParams
+	history *historyStore
+	wg      sync.WaitGroup
 }
 
-func newService(p ServiceParams) *Service {
-	return &Service{params: p}
+func newService(lc fx.Lifecycle, p ServiceParams) (*Service, error) {
+	if err := autoMigrate(p.LocalStore); err != nil {
+		return nil, err
+	}
+	history, err := newHistoryStore(p.LocalStore)
+	if err != nil {
+		return nil, err
+	}
+	s := &Service{params: p, history: history}
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				s.historyLoop(ctx)
+			}()
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			s.wg.Wait()
+			return nil
+		},
+	})
+	return s, nil
+}
+
+func (s *Service) historyLoop(ctx context.Context) {
+	cfgCh := s.params.ConfigManager.NewPushChannel()
+	ticker := time.NewTicker(historyGCInterval)
+	defer ticker.Stop()
+	syncTicker := time.NewTicker(historySyncInterval)
+	defer syncTicker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case dc, ok := <-cfgCh:
+			if !ok {
+				return
+			}
+			s.history.setConfig(dc.Statement)
+			if err := s.history.gc(); err != nil {
+				log.Warn("Failed to clean up persisted statements", zap.Error(err))
+			}
+		case <-ticker.C:
+			if err := s.history.gc(); err != nil {
+				log.Warn("Failed to clean up persisted statements", zap.Error(err))
+			}
+		case <-syncTicker.C:
+			if err := s.syncHistory(); err != nil {
+				log.Warn("Failed to persist statements", zap.Error(err))
+			}
+		}
+	}
+}
+
+// syncHistory snapshots the statements in background with the service TiDB credential. It does nothing if
+// the persistence is disabled or the credential is not configured.
+func (s *Service) syncHistory() error {
+	cfg := s.params.Config
+	if !s.history.isEnabled() || cfg.TiDBServiceUser == "" {
+		return nil
+	}
+	db, err := s.params.TiDBClient.OpenSQLConn(cfg.TiDBServiceUser, cfg.TiDBServicePassword)
+	if err != nil {
+		return err
+	}
+	defer utils.CloseTiDBConnection(db) //nolint:errcheck
+	return s.history.sync(db)
 }
 
 func registerRouter(r *gin.RouterGroup, auth *user.AuthService, s *Service) {
@@ -61,11 +140,18 @@ func registerRouter(r *gin.RouterGroup, auth *user.AuthService, s *Service) {
 		{
 			endpoint.GET("/config", s.configHandler)
 			endpoint.POST("/config", s.modifyConfigHandler)
+			endpoint.GET("/persistence/config", s.getDynamicConfig)
+			endpoint.PUT("/persistence/config", utils.MWForbidByExperimentalFlag(s.params.Config.EnableExperimental), s.setDynamicConfig)
 			endpoint.GET("/time_ranges", s.timeRangesHandler)
 			endpoint.GET("/stmt_types", s.stmtTypesHandler)
 			endpoint.GET("/list", s.listHandler)
+			endpoint.GET("/rollup", s.rollupHandler)
 			endpoint.GET("/plans", s.plansHandler)
 			endpoint.GET("/plan/detail", s.planDetailHandler)
+			endpoint.GET("/plan/history", s.planHistoryHandler)
+			endpoint.POST("/plan/binding", s.planBindingHandler)
+			endpoint.GET("/plan/binding/audits", s.planBindingAuditsHandler)
+			endpoint.GET("/compare", s.compareHandler)
 
 			endpoint.POST("/download/token", s.downloadTokenHandler)
 
@@ -139,9 +225,61 @@ func (s *Service) timeRangesHandler(c *gin.Context) {
 		_ = c.Error(err)
 		return
 	}
+	if s.history.isEnabled() {
+		if err := s.history.sync(db); err != nil {
+			_ = c.Error(err)
+			return
+		}
+		localTimeRanges, err := s.history.queryTimeRanges()
+		if err != nil {
+			_ = c.Error(err)
+			return
+		}
+		timeRanges = mergeTimeRanges(timeRanges, localTimeRanges)
+	}
 	c.JSON(http.StatusOK, timeRanges)
 }
 
+// @Summary Get statement persistence configurations
+// @Success 200 {object} config.StatementConfig
+// @Router /statements/persistence/config [get]
+// @Security JwtAuth
+// @Failure 401 {object} utils.APIError "Unauthorized failure"
+// @Failure 500 {object} utils.APIError
+func (s *Service) getDynamicConfig(c *gin.Context) {
+	dc, err := s.params.ConfigManager.Get()
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, dc.Statement)
+}
+
+// @Summary Update statement persistence configurations
+// @Param request body config.StatementConfig true "Request body"
+// @Success 200 {object} config.StatementConfig
+// @Router /statements/persistence/config [put]
+// @Security JwtAuth
+// @Failure 400 {object} utils.APIError "Bad request"
+// @Failure 401 {object} utils.APIError "Unauthorized failure"
+// @Failure 403 {object} utils.APIError "Experimental feature not enabled"
+// @Failure 500 {object} utils.APIError
+func (s *Service) setDynamicConfig(c *gin.Context) {
+	var req config.StatementConfig
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.MakeInvalidRequestErrorFromError(c, err)
+		return
+	}
+	var opt config.DynamicConfigOption = func(dc *config.DynamicConfig) {
+		dc.Statement = req
+	}
+	if err := s.params.ConfigManager.Modify(opt); err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, req)
+}
+
 // @Summary Get all statement types
 // @Success 200 {array} string
 // @Router /statements/stmt_types [get]
@@ -163,7 +301,10 @@ type GetStatementsRequest struct {
 	BeginTime int      `json:"begin_time" form:"begin_time"`
 	EndTime   int      `json:"end_time" form:"end_time"`
 	Text      string   `json:"text" form:"text"`
+	TextMode  string   `json:"text_mode" form:"text_mode"` // empty for keyword matching, or "fingerprint"
 	Fields    string   `json:"fields" form:"fields"`
+	OrderBy   string   `json:"order_by" form:"order_by"` // any aggregated field, or "resource_score", sorted in the direction of desc
+	IsDesc    bool     `json:"desc" form:"desc"`
 }
 
 // @Summary Get a list of statements
@@ -190,7 +331,10 @@ func (s *Service) listHandler(c *gin.Context) {
 		req.Schemas,
 		req.StmtTypes,
 		req.Text,
-		fields)
+		req.TextMode,
+		fields,
+		req.OrderBy,
+		req.IsDesc)
 	if err != nil {
 		utils.MakeInvalidRequestErrorFromError(c, err)
 		return
@@ -198,6 +342,33 @@ func (s *Service) listHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, overviews)
 }
 
+type GetRollupRequest struct {
+	GetStatementsRequest
+	GroupBy string `json:"group_by" form:"group_by"` // "schema" or "table"
+}
+
+// @Summary Get the statements summed up by schemas or tables
+// @Param q query GetRollupRequest true "Query"
+// @Success 200 {array} RollupItem
+// @Router /statements/rollup [get]
+// @Security JwtAuth
+// @Failure 400 {object} utils.APIError "Bad request"
+// @Failure 401 {object} utils.APIError "Unauthorized failure"
+func (s *Service) rollupHandler(c *gin.Context) {
+	var req GetRollupRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		utils.MakeInvalidRequestErrorFromError(c, err)
+		return
+	}
+	db := utils.GetTiDBConnection(c)
+	result, err := s.queryRollup(db, &req)
+	if err != nil {
+		utils.MakeInvalidRequestErrorFromError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
 type GetPlansRequest struct {
 	SchemaName string `json:"schema_name" form:"schema_name"`
 	Digest     string `json:"digest" form:"digest"`
@@ -252,6 +423,146 @@ func (s *Service) planDetailHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, result)
 }
 
+type GetPlanHistoryRequest struct {
+	SchemaName string `json:"schema_name" form:"schema_name"`
+	Digest     string `json:"digest" form:"digest"`
+}
+
+// @Summary Get the plans of a statement in each retained time range
+// @Param q query GetPlanHistoryRequest true "Query"
+// @Success 200 {array} PlanHistoryItem
+// @Router /statements/plan/history [get]
+// @Security JwtAuth
+// @Failure 401 {object} utils.APIError "Unauthorized failure"
+func (s *Service) planHistoryHandler(c *gin.Context) {
+	var req GetPlanHistoryRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		utils.MakeInvalidRequestErrorFromError(c, err)
+		return
+	}
+	db := utils.GetTiDBConnection(c)
+	result, err := s.queryPlanHistory(db, req.SchemaName, req.Digest)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+type PlanBindingRequest struct {
+	GetPlansRequest
+	PlanDigest string `json:"plan_digest" binding:"required"`
+	Apply      bool   `json:"apply"`
+}
+
+type PlanBindingResponse struct {
+	SchemaName string `json:"schema_name"`
+	SQL        string `json:"sql"`
+	Applied    bool   `json:"applied"`
+}
+
+// @Summary Generate the SQL binding a statement to one of its plans, and optionally apply it
+// @Param request body PlanBindingRequest true "Request body"
+// @Success 200 {object} PlanBindingResponse
+// @Router /statements/plan/binding [post]
+// @Security JwtAuth
+// @Failure 400 {object} utils.APIError "Bad request"
+// @Failure 401 {object} utils.APIError "Unauthorized failure"
+// @Failure 403 {object} utils.APIError "Insufficient privilege"
+func (s *Service) planBindingHandler(c *gin.Context) {
+	var req PlanBindingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		utils.MakeInvalidRequestErrorFromError(c, err)
+		return
+	}
+	sessionUser := c.MustGet(utils.SessionUserKey).(*utils.SessionUser)
+	if req.Apply && sessionUser.IsShared {
+		// Shared sessions are meant to be read only.
+		utils.MakeInsufficientPrivilegeError(c)
+		return
+	}
+
+	db := utils.GetTiDBConnection(c)
+	bindingSQL, err := s.genPlanBinding(db, &req)
+	if err != nil {
+		if errorx.IsOfType(err, ErrBindingNotSupported) {
+			utils.MakeInvalidRequestErrorFromError(c, err)
+			return
+		}
+		_ = c.Error(err)
+		return
+	}
+
+	if req.Apply {
+		log.Info("Apply plan binding",
+			zap.String("user", sessionUser.TiDBUsername),
+			zap.String("schema", req.SchemaName),
+			zap.String("digest", req.Digest),
+			zap.String("plan_digest", req.PlanDigest))
+		if err := s.applyPlanBinding(db, sessionUser.TiDBUsername, &req, bindingSQL); err != nil {
+			_ = c.Error(err)
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, PlanBindingResponse{
+		SchemaName: req.SchemaName,
+		SQL:        bindingSQL,
+		Applied:    req.Apply,
+	})
+}
+
+// @Summary Get the plan bindings applied from Dashboard
+// @Success 200 {array} BindingAuditModel
+// @Router /statements/plan/binding/audits [get]
+// @Security JwtAuth
+// @Failure 401 {object} utils.APIError "Unauthorized failure"
+func (s *Service) planBindingAuditsHandler(c *gin.Context) {
+	var audits []BindingAuditModel
+	if err := s.params.LocalStore.Order("id DESC").Find(&audits).Error; err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, audits)
+}
+
+type CompareRequest struct {
+	BaseBeginTime   int      `json:"base_begin_time" form:"base_begin_time"`
+	BaseEndTime     int      `json:"base_end_time" form:"base_end_time"`
+	TargetBeginTime int      `json:"target_begin_time" form:"target_begin_time"`
+	TargetEndTime   int      `json:"target_end_time" form:"target_end_time"`
+	Schemas         []string `json:"schemas" form:"schemas"`
+	StmtTypes       []string `json:"stmt_types" form:"stmt_types"`
+	Limit           int      `json:"limit" form:"limit"`
+	CompareThresholds
+}
+
+// @Summary Compare statements between two time ranges and get the regressed ones
+// @Param q query CompareRequest true "Query"
+// @Success 200 {array} StatementDiff
+// @Router /statements/compare [get]
+// @Security JwtAuth
+// @Failure 400 {object} utils.APIError "Bad request"
+// @Failure 401 {object} utils.APIError "Unauthorized failure"
+func (s *Service) compareHandler(c *gin.Context) {
+	var req CompareRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		utils.MakeInvalidRequestErrorFromError(c, err)
+		return
+	}
+	if req.BaseBeginTime >= req.BaseEndTime || req.TargetBeginTime >= req.TargetEndTime {
+		utils.MakeInvalidRequestErrorWithMessage(c, "begin time must be smaller than end time")
+		return
+	}
+	db := utils.GetTiDBConnection(c)
+	result, err := s.compareStatements(db, &req)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
 // @Router /statements/download/token [post]
 // @Summary Generate a download token for exported statements
 // @Produce plain
@@ -277,7 +588,10 @@ func (s *Service) downloadTokenHandler(c *gin.Context) {
 		req.Schemas,
 		req.StmtTypes,
 		req.Text,
-		fields)
+		req.TextMode,
+		fields,
+		req.OrderBy,
+		req.IsDesc)
 	if err != nil {
 		utils.MakeInvalidRequestErrorFromError(c, err)
 		return
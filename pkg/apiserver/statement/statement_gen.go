@@ -62,3 +62,26 @@ func (s *Service) genSelectStmt(tableColumns []string, reqJSONColumns []string)
 	}).([]string)
 	return strings.Join(stmt, ", "), nil
 }
+
+// genOrderStmt orders the statements by an aggregated field, which must exist in current version TiDB schema.
+func (s *Service) genOrderStmt(tableColumns []string, orderBy string, isDesc bool) (string, error) {
+	orderField := funk.Find(getFieldsAndTags(), func(f Field) bool {
+		return f.JSONName == orderBy && f.Aggregation != ""
+	})
+	if orderField == nil {
+		return "", ErrUnknownColumn.New("unknown order by %s", orderBy)
+	}
+	f := orderField.(Field)
+	representedColumns := f.Related
+	if len(representedColumns) == 0 {
+		representedColumns = []string{f.JSONName}
+	}
+	if !utils.IsSubsets(tableColumns, representedColumns) {
+		return "", ErrUnknownColumn.New("order by %s is not included in the current version TiDB schema", orderBy)
+	}
+
+	if isDesc {
+		return fmt.Sprintf("%s DESC", f.ColumnName), nil
+	}
+	return fmt.Sprintf("%s ASC", f.ColumnName), nil
+}
@@ -35,6 +35,10 @@ type Config struct {
 	ClusterTLSConfig *tls.Config // TLS config for mTLS authentication between TiDB components.
 	TiDBTLSConfig    *tls.Config // TLS config for mTLS authentication between TiDB and MySQL client.
 
+	// TiDB credential owned by Dashboard for background tasks, which are disabled if the user is empty.
+	TiDBServiceUser     string
+	TiDBServicePassword string
+
 	EnableTelemetry    bool
 	EnableExperimental bool
 }
@@ -14,22 +14,50 @@
 package config
 
 import (
+	"regexp"
+
 	"github.com/pingcap/tidb-dashboard/pkg/apiserver/model"
 )
 
 const (
 	KeyVisualDBPolicy = "db"
 	KeyVisualKVPolicy = "kv"
+	// KeyVisualRulesPolicy labels keys by the user-defined label rules.
+	KeyVisualRulesPolicy = "rules"
 
 	DefaultKeyVisualPolicy = KeyVisualDBPolicy
 
+	// KeyVisualRegionsSourceAPI gets all regions from PD in a single request every minute.
+	KeyVisualRegionsSourceAPI = "api"
+	// KeyVisualRegionsSourcePaged scans regions from PD page by page, which bounds the memory for large clusters.
+	KeyVisualRegionsSourcePaged = "paged"
+
+	DefaultKeyVisualRegionsPageLimit = 1024
+	MaxKeyVisualRegionsPageLimit     = 10240
+
+	MaxKeyVisualLayers     = 8
+	MaxKeyVisualLayerLen   = 10000
+	MaxKeyVisualLabelRules = 64
+
 	DefaultProfilingAutoCollectionDurationSecs = 30
 	MaxProfilingAutoCollectionDurationSecs     = 120
 	DefaultProfilingAutoCollectionIntervalSecs = 3600
+
+	DefaultStatementPersistenceRetentionDays = 7
+	MaxStatementPersistenceRetentionDays     = 90
+
+	DefaultLogSearchRetentionDays   = 7
+	MaxLogSearchRetentionDays       = 90
+	DefaultLogSearchRetentionSizeMB = 2048
+
+	DefaultLogSearchTaskGroupSizeLimitMB = 1024
+	LogSearchCompressionZip              = "zip"
+	LogSearchCompressionGzip             = "gzip"
 )
 
 var (
-	KeyVisualPolicies = []string{KeyVisualDBPolicy, KeyVisualKVPolicy}
+	KeyVisualPolicies       = []string{KeyVisualDBPolicy, KeyVisualKVPolicy, KeyVisualRulesPolicy}
+	KeyVisualRegionsSources = []string{KeyVisualRegionsSourceAPI, KeyVisualRegionsSourcePaged}
 
 	ErrVerificationFailed = ErrorNS.NewType("verification failed")
 )
@@ -38,6 +66,40 @@ type KeyVisualConfig struct {
 	AutoCollectionDisabled bool   `json:"auto_collection_disabled"`
 	Policy                 string `json:"policy"`
 	PolicyKVSeparator      string `json:"policy_kv_separator"`
+	// The rules used by the rules policy, the first matched rule of a key is used to label it.
+	PolicyLabelRules []KeyVisualLabelRule `json:"policy_label_rules"`
+	// The layers of the stored axes from the newest to the oldest, the default layers are used if empty.
+	Layers []KeyVisualLayerConfig `json:"layers"`
+	// Where the regions are collected from, the api source is used if empty.
+	RegionsSource string `json:"regions_source"`
+	// The number of regions in each page of the paged source, the default limit is used if 0.
+	RegionsPageLimit int `json:"regions_page_limit"`
+	// Whether the regions of the recent heatmaps are persisted for the drill-down after restarts.
+	RegionIndexPersisted bool `json:"region_index_persisted"`
+}
+
+// KeyVisualLayerConfig is a layer storing up to `len` axes. When the layer is full, its oldest `ratio` axes are
+// compacted into one axis of the next layer. The oldest axis of the last layer is dropped when it is full.
+type KeyVisualLayerConfig struct {
+	Len   int `json:"len"`
+	Ratio int `json:"ratio"`
+}
+
+// KeyVisualLabelRule labels the keys matching either the prefix or the regular expression. Each label is a template
+// expanded by the submatches of the regular expression, e.g. `tenant_$1` or `${name}`. A prefix rule is the same as
+// the regular expression `^<prefix>(?P<suffix>.*)`. The keys are matched after they are decoded, if encoded by TxnKV.
+type KeyVisualLabelRule struct {
+	Prefix string   `json:"prefix"`
+	Regex  string   `json:"regex"`
+	Labels []string `json:"labels"`
+}
+
+// Compile returns the regular expression of the rule.
+func (r *KeyVisualLabelRule) Compile() (*regexp.Regexp, error) {
+	if r.Prefix != "" {
+		return regexp.Compile("(?s)^" + regexp.QuoteMeta(r.Prefix) + "(?P<suffix>.*)")
+	}
+	return regexp.Compile(r.Regex)
 }
 
 func (c *KeyVisualConfig) validatePolicy() error {
@@ -49,21 +111,109 @@ func (c *KeyVisualConfig) validatePolicy() error {
 	return ErrVerificationFailed.New("policy must be in %v", KeyVisualPolicies)
 }
 
+func (c *KeyVisualConfig) validateLayers() error {
+	if len(c.Layers) > MaxKeyVisualLayers {
+		return ErrVerificationFailed.New("the number of layers cannot be greater than %d", MaxKeyVisualLayers)
+	}
+	for i, layer := range c.Layers {
+		if layer.Len <= 0 || layer.Len > MaxKeyVisualLayerLen {
+			return ErrVerificationFailed.New("len of layer %d must be in [1, %d]", i, MaxKeyVisualLayerLen)
+		}
+		if i == len(c.Layers)-1 {
+			if layer.Ratio != 0 {
+				return ErrVerificationFailed.New("ratio of the last layer must be 0")
+			}
+		} else if layer.Ratio < 2 || layer.Ratio > layer.Len {
+			return ErrVerificationFailed.New("ratio of layer %d must be in [2, len]", i)
+		}
+	}
+	return nil
+}
+
+func (c *KeyVisualConfig) validateRegionsSource() error {
+	if c.RegionsSource != "" {
+		valid := false
+		for _, source := range KeyVisualRegionsSources {
+			if source == c.RegionsSource {
+				valid = true
+			}
+		}
+		if !valid {
+			return ErrVerificationFailed.New("regions_source must be in %v", KeyVisualRegionsSources)
+		}
+	}
+	if c.RegionsPageLimit < 0 || c.RegionsPageLimit > MaxKeyVisualRegionsPageLimit {
+		return ErrVerificationFailed.New("regions_page_limit must be in [0, %d]", MaxKeyVisualRegionsPageLimit)
+	}
+	return nil
+}
+
+func (c *KeyVisualConfig) validateLabelRules() error {
+	if len(c.PolicyLabelRules) > MaxKeyVisualLabelRules {
+		return ErrVerificationFailed.New("the number of label rules cannot be greater than %d", MaxKeyVisualLabelRules)
+	}
+	if c.Policy == KeyVisualRulesPolicy && !c.AutoCollectionDisabled && len(c.PolicyLabelRules) == 0 {
+		return ErrVerificationFailed.New("label rules cannot be empty for the %s policy", KeyVisualRulesPolicy)
+	}
+	for i, rule := range c.PolicyLabelRules {
+		if (rule.Prefix == "") == (rule.Regex == "") {
+			return ErrVerificationFailed.New("label rule %d must have either a prefix or a regex", i)
+		}
+		if len(rule.Labels) == 0 {
+			return ErrVerificationFailed.New("labels of label rule %d cannot be empty", i)
+		}
+		if _, err := rule.Compile(); err != nil {
+			return ErrVerificationFailed.Wrap(err, "invalid regex of label rule %d", i)
+		}
+	}
+	return nil
+}
+
 type ProfilingConfig struct {
 	AutoCollectionTargets      []model.RequestTargetNode `json:"auto_collection_targets"`
 	AutoCollectionDurationSecs uint                      `json:"auto_collection_duration_secs"`
 	AutoCollectionIntervalSecs uint                      `json:"auto_collection_interval_secs"`
 }
 
+type StatementConfig struct {
+	PersistenceDisabled      bool `json:"persistence_disabled"`
+	PersistenceRetentionDays uint `json:"persistence_retention_days"`
+}
+
+type LogSearchConfig struct {
+	// Finished task groups older than the retention days are removed.
+	RetentionDays uint `json:"retention_days"`
+	// The oldest finished task groups are removed when the total size of collected logs exceeds the limit, which
+	// includes the log files, and the lines and their full-text index in the local store.
+	RetentionSizeMB uint `json:"retention_size_mb"`
+	// A task group stops collecting logs when the size of the collected lines exceeds the limit.
+	TaskGroupSizeLimitMB uint `json:"task_group_size_limit_mb"`
+	// The format of the stored log files, either "zip" or "gzip".
+	Compression string `json:"compression"`
+}
+
 type DynamicConfig struct {
 	KeyVisual KeyVisualConfig `json:"keyvisual"`
 	Profiling ProfilingConfig `json:"profiling"`
+	Statement StatementConfig `json:"statement"`
+	LogSearch LogSearchConfig `json:"log_search"`
 }
 
 func (c *DynamicConfig) Clone() *DynamicConfig {
 	newCfg := *c
 	newCfg.Profiling.AutoCollectionTargets = make([]model.RequestTargetNode, len(c.Profiling.AutoCollectionTargets))
 	copy(newCfg.Profiling.AutoCollectionTargets, c.Profiling.AutoCollectionTargets)
+	if c.KeyVisual.Layers != nil {
+		newCfg.KeyVisual.Layers = make([]KeyVisualLayerConfig, len(c.KeyVisual.Layers))
+		copy(newCfg.KeyVisual.Layers, c.KeyVisual.Layers)
+	}
+	if c.KeyVisual.PolicyLabelRules != nil {
+		newCfg.KeyVisual.PolicyLabelRules = make([]KeyVisualLabelRule, len(c.KeyVisual.PolicyLabelRules))
+		for i, rule := range c.KeyVisual.PolicyLabelRules {
+			rule.Labels = append([]string(nil), rule.Labels...)
+			newCfg.KeyVisual.PolicyLabelRules[i] = rule
+		}
+	}
 	return &newCfg
 }
 
@@ -73,6 +223,15 @@ func (c *DynamicConfig) Validate() error {
 			return err
 		}
 	}
+	if err := c.KeyVisual.validateLayers(); err != nil {
+		return err
+	}
+	if err := c.KeyVisual.validateLabelRules(); err != nil {
+		return err
+	}
+	if err := c.KeyVisual.validateRegionsSource(); err != nil {
+		return err
+	}
 
 	if len(c.Profiling.AutoCollectionTargets) > 0 {
 		if c.Profiling.AutoCollectionDurationSecs == 0 {
@@ -93,6 +252,33 @@ func (c *DynamicConfig) Validate() error {
 		}
 	}
 
+	if !c.Statement.PersistenceDisabled {
+		if c.Statement.PersistenceRetentionDays == 0 {
+			return ErrVerificationFailed.New("persistence_retention_days cannot be 0")
+		}
+		if c.Statement.PersistenceRetentionDays > MaxStatementPersistenceRetentionDays {
+			return ErrVerificationFailed.New("persistence_retention_days cannot be greater than %d", MaxStatementPersistenceRetentionDays)
+		}
+	}
+
+	if c.LogSearch.RetentionDays == 0 {
+		return ErrVerificationFailed.New("retention_days cannot be 0")
+	}
+	if c.LogSearch.RetentionDays > MaxLogSearchRetentionDays {
+		return ErrVerificationFailed.New("retention_days cannot be greater than %d", MaxLogSearchRetentionDays)
+	}
+	if c.LogSearch.RetentionSizeMB == 0 {
+		return ErrVerificationFailed.New("retention_size_mb cannot be 0")
+	}
+	if c.LogSearch.TaskGroupSizeLimitMB == 0 {
+		return ErrVerificationFailed.New("task_group_size_limit_mb cannot be 0")
+	}
+	switch c.LogSearch.Compression {
+	case LogSearchCompressionZip, LogSearchCompressionGzip:
+	default:
+		return ErrVerificationFailed.New("unsupported compression %s", c.LogSearch.Compression)
+	}
+
 	return nil
 }
 
@@ -118,4 +304,27 @@ func (c *DynamicConfig) Adjust() {
 		c.Profiling.AutoCollectionDurationSecs = 0
 		c.Profiling.AutoCollectionIntervalSecs = 0
 	}
+
+	if c.Statement.PersistenceRetentionDays == 0 {
+		c.Statement.PersistenceRetentionDays = DefaultStatementPersistenceRetentionDays
+	}
+	if c.Statement.PersistenceRetentionDays > MaxStatementPersistenceRetentionDays {
+		c.Statement.PersistenceRetentionDays = MaxStatementPersistenceRetentionDays
+	}
+
+	if c.LogSearch.RetentionDays == 0 {
+		c.LogSearch.RetentionDays = DefaultLogSearchRetentionDays
+	}
+	if c.LogSearch.RetentionDays > MaxLogSearchRetentionDays {
+		c.LogSearch.RetentionDays = MaxLogSearchRetentionDays
+	}
+	if c.LogSearch.RetentionSizeMB == 0 {
+		c.LogSearch.RetentionSizeMB = DefaultLogSearchRetentionSizeMB
+	}
+	if c.LogSearch.TaskGroupSizeLimitMB == 0 {
+		c.LogSearch.TaskGroupSizeLimitMB = DefaultLogSearchTaskGroupSizeLimitMB
+	}
+	if c.LogSearch.Compression == "" {
+		c.LogSearch.Compression = LogSearchCompressionZip
+	}
 }
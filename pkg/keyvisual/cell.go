@@ -0,0 +1,257 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keyvisual
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/pingcap/tidb-dashboard/pkg/keyvisual/storage"
+)
+
+const (
+	defaultCellRegionLimit = 50
+	maxCellRegionLimit     = 200
+	// The number of concurrent requests to get the regions from PD.
+	cellRegionWorkers = 8
+)
+
+type CellPeer struct {
+	ID        uint64 `json:"id"`
+	StoreID   uint64 `json:"store_id"`
+	IsLearner bool   `json:"is_learner"`
+}
+
+type CellRegion struct {
+	ID       uint64 `json:"id"`
+	StartKey string `json:"start_key"` // hex encoded
+	EndKey   string `json:"end_key"`   // hex encoded
+	// The region has the keys in the time range (StartTime, EndTime].
+	StartTime int64 `json:"start_time"` // unix second
+	EndTime   int64 `json:"end_time"`   // unix second
+	// The fields below are the current placement in PD, they are empty if the region does not exist anymore, e.g.
+	// it is merged, or if it fails to get the region from PD.
+	Exists          bool        `json:"exists"`
+	Error           string      `json:"error,omitempty"` // the error of getting the region from PD
+	Leader          *CellPeer   `json:"leader"`
+	Peers           []*CellPeer `json:"peers"`
+	ApproximateSize int64       `json:"approximate_size"`
+	ApproximateKeys int64       `json:"approximate_keys"`
+}
+
+// CellStore is the number of regions placed on a store, ordered by the leaders.
+type CellStore struct {
+	StoreID uint64 `json:"store_id"`
+	Leaders int    `json:"leaders"`
+	Peers   int    `json:"peers"`
+}
+
+type CellResponse struct {
+	StartTime int64         `json:"start_time"`
+	EndTime   int64         `json:"end_time"`
+	Regions   []*CellRegion `json:"regions"`
+	Stores    []*CellStore  `json:"stores"`
+	// Truncated is true if there are more regions than the limit.
+	Truncated bool `json:"truncated"`
+}
+
+// pdRegion is the placement of a region in the response of PD region API.
+type pdRegion struct {
+	ID              uint64      `json:"id"`
+	Leader          *CellPeer   `json:"leader"`
+	Peers           []*CellPeer `json:"peers"`
+	ApproximateSize int64       `json:"approximate_size"`
+	ApproximateKeys int64       `json:"approximate_keys"`
+}
+
+// regionGetter returns nil if the region does not exist.
+type regionGetter func(id uint64) (*pdRegion, error)
+
+func (s *Service) getPDRegion(id uint64) (*pdRegion, error) {
+	data, err := s.pdClient.SendGetRequest(fmt.Sprintf("/region/id/%d", id))
+	if err != nil {
+		return nil, err
+	}
+	var region *pdRegion
+	if err := json.Unmarshal(data, &region); err != nil {
+		return nil, err
+	}
+	if region == nil || region.ID == 0 {
+		return nil, nil
+	}
+	return region, nil
+}
+
+// getRegions gets the regions by a bounded number of workers. The regions failed to get are nil, and their errors
+// are returned by the ids.
+func getRegions(ids []uint64, getRegion regionGetter) (map[uint64]*pdRegion, map[uint64]error) {
+	result := make(map[uint64]*pdRegion, len(ids))
+	errs := make(map[uint64]error)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	idCh := make(chan uint64)
+	for i := 0; i < cellRegionWorkers && i < len(ids); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range idCh {
+				region, err := getRegion(id)
+				mu.Lock()
+				result[id] = region
+				if err != nil {
+					errs[id] = err
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, id := range ids {
+		idCh <- id
+	}
+	close(idCh)
+	wg.Wait()
+	return result, errs
+}
+
+// placeRegions converts the regions into the response with their current placement. It fails only if all the
+// regions fail to get from PD, otherwise the errors are returned with each region.
+func placeRegions(versions []*storage.RegionVersion, getRegion regionGetter) ([]*CellRegion, []*CellStore, error) {
+	regions := make([]*CellRegion, len(versions))
+	storeMap := make(map[uint64]*CellStore)
+	stores := make([]*CellStore, 0)
+	getStore := func(id uint64) *CellStore {
+		store, ok := storeMap[id]
+		if !ok {
+			store = &CellStore{StoreID: id}
+			storeMap[id] = store
+			stores = append(stores, store)
+		}
+		return store
+	}
+	// A region may have several versions in the time range, but it is placed only once.
+	ids := make([]uint64, 0, len(versions))
+	seen := make(map[uint64]struct{}, len(versions))
+	for _, version := range versions {
+		if _, ok := seen[version.ID]; !ok {
+			seen[version.ID] = struct{}{}
+			ids = append(ids, version.ID)
+		}
+	}
+	placements, errs := getRegions(ids, getRegion)
+	if len(ids) > 0 && len(errs) == len(ids) {
+		return nil, nil, errs[ids[0]]
+	}
+	for _, id := range ids {
+		if placement := placements[id]; placement != nil {
+			if placement.Leader != nil && placement.Leader.StoreID != 0 {
+				getStore(placement.Leader.StoreID).Leaders++
+			}
+			for _, peer := range placement.Peers {
+				getStore(peer.StoreID).Peers++
+			}
+		}
+	}
+
+	for i, version := range versions {
+		r := &CellRegion{
+			ID:        version.ID,
+			StartKey:  hex.EncodeToString([]byte(version.StartKey)),
+			EndKey:    hex.EncodeToString([]byte(version.EndKey)),
+			StartTime: version.StartTime.Unix(),
+			EndTime:   version.EndTime.Unix(),
+			Peers:     []*CellPeer{},
+		}
+		regions[i] = r
+
+		if err := errs[version.ID]; err != nil {
+			r.Error = err.Error()
+			continue
+		}
+		placement := placements[version.ID]
+		if placement == nil {
+			continue
+		}
+		r.Exists = true
+		r.Leader = placement.Leader
+		if placement.Peers != nil {
+			r.Peers = placement.Peers
+		}
+		r.ApproximateSize = placement.ApproximateSize
+		r.ApproximateKeys = placement.ApproximateKeys
+	}
+
+	sort.SliceStable(stores, func(i, j int) bool {
+		if stores[i].Leaders != stores[j].Leaders {
+			return stores[i].Leaders > stores[j].Leaders
+		}
+		return stores[i].Peers > stores[j].Peers
+	})
+	return regions, stores, nil
+}
+
+// @Summary Key Visual Cell
+// @Description Find the regions in a cell of heatmaps, with their current placement in PD
+// @Param startkey query string false "The start of the key range"
+// @Param endkey query string false "The end of the key range"
+// @Param starttime query int true "The start of the time range (Unix)"
+// @Param endtime query int true "The end of the time range (Unix)"
+// @Param limit query int false "The max number of regions, 50 by default"
+// @Success 200 {object} CellResponse
+// @Router /keyvisual/cell [get]
+// @Security JwtAuth
+// @Failure 401 {object} utils.APIError "Unauthorized failure"
+// @Failure 500 {object} utils.APIError "Failed to get all the regions from PD"
+func (s *Service) cell(c *gin.Context) {
+	if c.Query("starttime") == "" || c.Query("endtime") == "" {
+		c.JSON(http.StatusBadRequest, "bad request")
+		return
+	}
+	q, ok := parseHeatmapsQuery(c, time.Time{}, time.Time{})
+	if !ok {
+		return
+	}
+	limit := defaultCellRegionLimit
+	if limitString := c.Query("limit"); limitString != "" {
+		var err error
+		if limit, err = strconv.Atoi(limitString); err != nil || limit <= 0 {
+			c.JSON(http.StatusBadRequest, "bad request")
+			return
+		}
+		if limit > maxCellRegionLimit {
+			limit = maxCellRegionLimit
+		}
+	}
+
+	versions, truncated := s.stat.FindRegions(q.startTime, q.endTime, q.startKey, q.endKey, limit)
+	regions, stores, err := placeRegions(versions, s.getPDRegion)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, &CellResponse{
+		StartTime: q.startTime.Unix(),
+		EndTime:   q.endTime.Unix(),
+		Regions:   regions,
+		Stores:    stores,
+		Truncated: truncated,
+	})
+}
@@ -0,0 +1,128 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keyvisual
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "github.com/pingcap/check"
+
+	"github.com/pingcap/tidb-dashboard/pkg/keyvisual/storage"
+)
+
+var _ = Suite(&testCellSuite{})
+
+type testCellSuite struct{}
+
+func (t *testCellSuite) TestPlaceRegions(c *C) {
+	now := time.Unix(1600000000, 0)
+	versions := []*storage.RegionVersion{
+		{ID: 1, StartKey: "", EndKey: "b", StartTime: now, EndTime: now.Add(time.Minute)},
+		{ID: 2, StartKey: "b", EndKey: "", StartTime: now, EndTime: now.Add(time.Minute)},
+		{ID: 2, StartKey: "b", EndKey: "c", StartTime: now.Add(time.Minute), EndTime: now.Add(2 * time.Minute)},
+		{ID: 3, StartKey: "c", EndKey: "", StartTime: now.Add(time.Minute), EndTime: now.Add(2 * time.Minute)},
+	}
+	placements := map[uint64]*pdRegion{
+		2: {
+			ID:              2,
+			Leader:          &CellPeer{ID: 21, StoreID: 1},
+			Peers:           []*CellPeer{{ID: 21, StoreID: 1}, {ID: 22, StoreID: 2}},
+			ApproximateSize: 96,
+		},
+		3: {
+			ID:     3,
+			Leader: &CellPeer{ID: 31, StoreID: 1},
+			Peers:  []*CellPeer{{ID: 31, StoreID: 1}, {ID: 32, StoreID: 3}},
+		},
+	}
+	var requested int32
+	regions, stores, err := placeRegions(versions, func(id uint64) (*pdRegion, error) {
+		atomic.AddInt32(&requested, 1)
+		return placements[id], nil
+	})
+	c.Assert(err, IsNil)
+
+	c.Assert(requested, Equals, int32(3))
+	c.Assert(regions, HasLen, 4)
+	c.Assert(regions[0].Exists, IsFalse)
+	c.Assert(regions[0].Error, Equals, "")
+	c.Assert(regions[0].Peers, HasLen, 0)
+	c.Assert(regions[0].EndKey, Equals, "62")
+	c.Assert(regions[1].Exists, IsTrue)
+	c.Assert(regions[1].ApproximateSize, Equals, int64(96))
+	c.Assert(regions[2].Leader.StoreID, Equals, uint64(1))
+	c.Assert(regions[3].StartTime, Equals, now.Add(time.Minute).Unix())
+
+	c.Assert(stores, DeepEquals, []*CellStore{
+		{StoreID: 1, Leaders: 2, Peers: 2},
+		{StoreID: 2, Leaders: 0, Peers: 1},
+		{StoreID: 3, Leaders: 0, Peers: 1},
+	})
+}
+
+func (t *testCellSuite) TestPlaceRegionsError(c *C) {
+	now := time.Unix(1600000000, 0)
+	versions := []*storage.RegionVersion{
+		{ID: 1, StartKey: "", EndKey: "b", StartTime: now, EndTime: now.Add(time.Minute)},
+		{ID: 2, StartKey: "b", EndKey: "", StartTime: now, EndTime: now.Add(time.Minute)},
+	}
+	regions, _, err := placeRegions(versions, func(id uint64) (*pdRegion, error) {
+		if id == 1 {
+			return nil, errors.New("timeout")
+		}
+		return &pdRegion{ID: id}, nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(regions[0].Exists, IsFalse)
+	c.Assert(regions[0].Error, Equals, "timeout")
+	c.Assert(regions[1].Exists, IsTrue)
+	c.Assert(regions[1].Error, Equals, "")
+
+	// The request fails if no region is got from PD.
+	_, _, err = placeRegions(versions, func(id uint64) (*pdRegion, error) {
+		return nil, errors.New("timeout")
+	})
+	c.Assert(err, ErrorMatches, "timeout")
+}
+
+func (t *testCellSuite) TestGetRegions(c *C) {
+	ids := make([]uint64, maxCellRegionLimit)
+	for i := range ids {
+		ids[i] = uint64(i + 1)
+	}
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	regions, errs := getRegions(ids, func(id uint64) (*pdRegion, error) {
+		mu.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return &pdRegion{ID: id}, nil
+	})
+
+	c.Assert(regions, HasLen, len(ids))
+	c.Assert(errs, HasLen, 0)
+	c.Assert(regions[100].ID, Equals, uint64(100))
+	c.Assert(maxRunning <= cellRegionWorkers, IsTrue)
+	c.Assert(maxRunning > 1, IsTrue)
+}
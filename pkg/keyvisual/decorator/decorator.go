@@ -16,6 +16,7 @@ package decorator
 
 import (
 	"encoding/hex"
+	"time"
 
 	"github.com/pingcap/tidb-dashboard/pkg/config"
 )
@@ -33,6 +34,31 @@ type LabelStrategy interface {
 	NewLabeler() Labeler
 }
 
+// HistoricalLabelStrategy is a LabelStrategy which keeps the history of labels.
+type HistoricalLabelStrategy interface {
+	LabelStrategy
+	// NewLabelerAt generates a Labeler which labels keys with the labels valid at the time.
+	NewLabelerAt(t time.Time) Labeler
+}
+
+// LabelStrategyAt returns a LabelStrategy whose labelers label keys with the labels valid at the time. The strategy
+// is returned as it is if it does not keep the history of labels.
+func LabelStrategyAt(s LabelStrategy, t time.Time) LabelStrategy {
+	if h, ok := s.(HistoricalLabelStrategy); ok {
+		return labelStrategyAt{HistoricalLabelStrategy: h, at: t}
+	}
+	return s
+}
+
+type labelStrategyAt struct {
+	HistoricalLabelStrategy
+	at time.Time
+}
+
+func (s labelStrategyAt) NewLabeler() Labeler {
+	return s.NewLabelerAt(s.at)
+}
+
 // Labeler is an executor of LabelStrategy, and its functions should not be called concurrently.
 type Labeler interface {
 	// CrossBorder determines whether two keys not belong to the same logical range.
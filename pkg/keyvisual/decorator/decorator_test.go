@@ -14,11 +14,23 @@
 package decorator
 
 import (
+	"path"
 	"testing"
 
 	. "github.com/pingcap/check"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/pingcap/tidb-dashboard/pkg/dbstore"
 )
 
 func TestDecorator(t *testing.T) {
 	TestingT(t)
 }
+
+// newTestDB returns a local store in the temporary directory of the test.
+func newTestDB(c *C) *dbstore.DB {
+	gormDB, err := gorm.Open(sqlite.Open(path.Join(c.MkDir(), "test.sqlite.db")), &gorm.Config{})
+	c.Assert(err, IsNil)
+	return &dbstore.DB{DB: gormDB}
+}
@@ -0,0 +1,136 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package decorator
+
+import (
+	"encoding/hex"
+	"regexp"
+	"sync/atomic"
+
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+
+	"github.com/pingcap/tidb-dashboard/pkg/config"
+	"github.com/pingcap/tidb-dashboard/pkg/keyvisual/region"
+	"github.com/pingcap/tidb-dashboard/pkg/tidb/model"
+)
+
+// RulesLabelStrategy implements the LabelStrategy interface. It labels keys by the user-defined rules, which is useful
+// for the RawKV and TxnKV applications with structured keys.
+func RulesLabelStrategy(cfg *config.KeyVisualConfig) LabelStrategy {
+	s := &rulesLabelStrategy{}
+	s.Rules.Store(compileLabelRules(cfg.PolicyLabelRules))
+	return s
+}
+
+type labelRule struct {
+	regex  *regexp.Regexp
+	labels []string
+}
+
+// compileLabelRules ignores the invalid rules, which should have been rejected when the config is saved.
+func compileLabelRules(rules []config.KeyVisualLabelRule) []labelRule {
+	result := make([]labelRule, 0, len(rules))
+	for i := range rules {
+		regex, err := rules[i].Compile()
+		if err != nil {
+			log.Warn("Ignore the invalid label rule", zap.Int("index", i), zap.Error(err))
+			continue
+		}
+		result = append(result, labelRule{
+			regex:  regex,
+			labels: rules[i].Labels,
+		})
+	}
+	return result
+}
+
+type rulesLabelStrategy struct {
+	Rules atomic.Value
+}
+
+type rulesLabeler struct {
+	Rules  []labelRule
+	Buffer model.KeyInfoBuffer
+}
+
+// ReloadConfig reset rules
+func (s *rulesLabelStrategy) ReloadConfig(cfg *config.KeyVisualConfig) {
+	s.Rules.Store(compileLabelRules(cfg.PolicyLabelRules))
+	log.Debug("Reload config", zap.Int("rules", len(cfg.PolicyLabelRules)))
+}
+
+func (s *rulesLabelStrategy) NewLabeler() Labeler {
+	return &rulesLabeler{
+		Rules: s.Rules.Load().([]labelRule),
+	}
+}
+
+// decode returns the key decoded by the TxnKV encoding, or the key itself if it is not encoded.
+func (e *rulesLabeler) decode(key string) []byte {
+	keyBytes := region.Bytes(key)
+	if decoded, err := e.Buffer.DecodeKey(keyBytes); err == nil {
+		return decoded
+	}
+	return keyBytes
+}
+
+// match returns the index of the first matched rule and the labels, or -1 if no rule matches the key.
+func (e *rulesLabeler) match(key string) (int, []string) {
+	decoded := e.decode(key)
+	for i, rule := range e.Rules {
+		submatches := rule.regex.FindSubmatchIndex(decoded)
+		if submatches == nil {
+			continue
+		}
+		labels := make([]string, len(rule.labels))
+		for j, template := range rule.labels {
+			labels[j] = string(rule.regex.Expand(nil, []byte(template), decoded, submatches))
+		}
+		return i, labels
+	}
+	return -1, []string{string(decoded)}
+}
+
+// CrossBorder determines whether two keys are labeled by different rules, or have different labels except the last
+// one. The keys not matched by any rule are in the same logical range.
+func (e *rulesLabeler) CrossBorder(startKey, endKey string) bool {
+	startRule, startLabels := e.match(startKey)
+	endRule, endLabels := e.match(endKey)
+	if startRule != endRule {
+		return true
+	}
+	if startRule == -1 {
+		return false
+	}
+	for i := 0; i < len(startLabels)-1; i++ {
+		if startLabels[i] != endLabels[i] {
+			return true
+		}
+	}
+	return false
+}
+
+// Label uses the first matched rule of each key.
+func (e *rulesLabeler) Label(keys []string) []LabelKey {
+	labelKeys := make([]LabelKey, len(keys))
+	for i, key := range keys {
+		_, labels := e.match(key)
+		labelKeys[i] = LabelKey{
+			Key:    hex.EncodeToString(region.Bytes(key)),
+			Labels: labels,
+		}
+	}
+	return labelKeys
+}
@@ -0,0 +1,78 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package decorator
+
+import (
+	. "github.com/pingcap/check"
+
+	"github.com/pingcap/tidb-dashboard/pkg/config"
+)
+
+var _ = Suite(&testRulesSuite{})
+
+type testRulesSuite struct{}
+
+var testLabelRules = []config.KeyVisualLabelRule{
+	{Regex: `^tenant/(\d+)/object/(\d+)`, Labels: []string{"tenant_$1", "object"}},
+	{Prefix: "meta/", Labels: []string{"meta", "${suffix}"}},
+}
+
+// encodeTxnKey encodes a key shorter than 8 bytes as TxnKV does.
+func encodeTxnKey(key string) string {
+	group := make([]byte, 8)
+	copy(group, key)
+	return string(append(group, byte(0xFF-(8-len(key)))))
+}
+
+func labelsOf(labelKeys []LabelKey) [][]string {
+	result := make([][]string, len(labelKeys))
+	for i, labelKey := range labelKeys {
+		result[i] = labelKey.Labels
+	}
+	return result
+}
+
+func (t *testRulesSuite) TestLabel(c *C) {
+	s := RulesLabelStrategy(&config.KeyVisualConfig{PolicyLabelRules: testLabelRules})
+	labeler := s.NewLabeler()
+	keys := []string{"", "meta/a", encodeTxnKey("meta/b"), "tenant/1/object/2", "tenant/10/object/3/x", "other"}
+	c.Assert(labelsOf(labeler.Label(keys)), DeepEquals, [][]string{
+		{""},
+		{"meta", "a"},
+		{"meta", "b"},
+		{"tenant_1", "object"},
+		{"tenant_10", "object"},
+		{"other"},
+	})
+	c.Assert(labeler.Label(keys[1:2])[0].Key, Equals, "6d6574612f61")
+
+	c.Assert(labeler.CrossBorder("tenant/1/object/2", "tenant/1/object/3"), IsFalse)
+	c.Assert(labeler.CrossBorder("tenant/1/object/2", "tenant/2/object/1"), IsTrue)
+	c.Assert(labeler.CrossBorder("meta/a", "meta/b"), IsFalse)
+	c.Assert(labeler.CrossBorder("meta/a", "tenant/1/object/2"), IsTrue)
+	c.Assert(labeler.CrossBorder("other", "x"), IsFalse)
+}
+
+func (t *testRulesSuite) TestReloadConfig(c *C) {
+	s := RulesLabelStrategy(&config.KeyVisualConfig{PolicyLabelRules: testLabelRules})
+	s.ReloadConfig(&config.KeyVisualConfig{PolicyLabelRules: []config.KeyVisualLabelRule{
+		{Prefix: "tenant/", Labels: []string{"tenant"}},
+		// The invalid rule is ignored.
+		{Regex: "(", Labels: []string{"invalid"}},
+	}})
+	c.Assert(labelsOf(s.NewLabeler().Label([]string{"tenant/1/object/2", "("})), DeepEquals, [][]string{
+		{"tenant"},
+		{"("},
+	})
+}
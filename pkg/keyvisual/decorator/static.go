@@ -0,0 +1,65 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package decorator
+
+import (
+	"encoding/hex"
+
+	"github.com/pingcap/tidb-dashboard/pkg/config"
+)
+
+// StaticLabelStrategy implements the LabelStrategy interface. It labels keys with the fixed labels, e.g. the labels
+// recorded in a snapshot, and only encodes the keys without labels.
+func StaticLabelStrategy(labels map[string][]string) LabelStrategy {
+	return &staticLabelStrategy{Labels: labels}
+}
+
+type staticLabelStrategy struct {
+	Labels map[string][]string
+}
+
+type staticLabeler struct {
+	Labels map[string][]string
+}
+
+func (s *staticLabelStrategy) ReloadConfig(cfg *config.KeyVisualConfig) {}
+
+func (s *staticLabelStrategy) NewLabeler() Labeler {
+	return &staticLabeler{Labels: s.Labels}
+}
+
+// CrossBorder always returns false, since the logical ranges are unknown.
+func (e *staticLabeler) CrossBorder(startKey, endKey string) bool {
+	return false
+}
+
+// Label looks up the labels of the keys.
+func (e *staticLabeler) Label(keys []string) []LabelKey {
+	labelKeys := make([]LabelKey, len(keys))
+	for i, key := range keys {
+		str := hex.EncodeToString([]byte(key))
+		labels, ok := e.Labels[key]
+		if !ok {
+			labels = []string{str}
+			if key == "" {
+				labels = []string{}
+			}
+		}
+		labelKeys[i] = LabelKey{
+			Key:    str,
+			Labels: labels,
+		}
+	}
+	return labelKeys
+}
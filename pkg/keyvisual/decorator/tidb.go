@@ -20,25 +20,38 @@ import (
 	"sync"
 	"time"
 
+	"github.com/pingcap/log"
 	"go.etcd.io/etcd/clientv3"
 	"go.uber.org/fx"
+	"go.uber.org/zap"
 
 	"github.com/pingcap/tidb-dashboard/pkg/config"
+	"github.com/pingcap/tidb-dashboard/pkg/dbstore"
 	"github.com/pingcap/tidb-dashboard/pkg/keyvisual/region"
 	"github.com/pingcap/tidb-dashboard/pkg/tidb"
 	"github.com/pingcap/tidb-dashboard/pkg/tidb/model"
 )
 
 // TiDBLabelStrategy implements the LabelStrategy interface. It obtains Label Information from TiDB.
-func TiDBLabelStrategy(lc fx.Lifecycle, wg *sync.WaitGroup, etcdClient *clientv3.Client, tidbClient *tidb.Client) LabelStrategy {
+// The labels of each schema version are persisted, so that keys can be labeled as of the time of the data.
+func TiDBLabelStrategy(lc fx.Lifecycle, wg *sync.WaitGroup, etcdClient *clientv3.Client, tidbClient *tidb.Client, db *dbstore.DB) LabelStrategy {
 	s := &tidbLabelStrategy{
 		EtcdClient:    etcdClient,
+		db:            db,
+		history:       newTableHistory(),
+		dbNames:       make(map[int64]string),
 		tidbClient:    tidbClient,
 		SchemaVersion: -1,
 	}
 
 	lc.Append(fx.Hook{
 		OnStart: func(ctx context.Context) error {
+			schemaVersion, err := s.history.load(db)
+			if err != nil {
+				log.Warn("Failed to load key visual table labels", zap.Error(err))
+			} else {
+				s.SchemaVersion = schemaVersion
+			}
 			wg.Add(1)
 			go func() {
 				defer wg.Done()
@@ -62,15 +75,20 @@ type tidbLabelStrategy struct {
 	Config     *config.Config
 	EtcdClient *clientv3.Client
 
-	TableMap      sync.Map
+	db      *dbstore.DB
+	history *tableHistory
+	// dbNames is only accessed by the background goroutine.
+	dbNames       map[int64]string
 	tidbClient    *tidb.Client
 	SchemaVersion int64
 	TidbAddress   []string
 }
 
 type tidbLabeler struct {
-	TableMap *sync.Map
-	Buffer   model.KeyInfoBuffer
+	history *tableHistory
+	// at is the time of the labels, or zero for the latest labels.
+	at     time.Time
+	Buffer model.KeyInfoBuffer
 }
 
 func (s *tidbLabelStrategy) ReloadConfig(cfg *config.KeyVisualConfig) {}
@@ -90,7 +108,14 @@ func (s *tidbLabelStrategy) Background(ctx context.Context) {
 
 func (s *tidbLabelStrategy) NewLabeler() Labeler {
 	return &tidbLabeler{
-		TableMap: &s.TableMap,
+		history: s.history,
+	}
+}
+
+func (s *tidbLabelStrategy) NewLabelerAt(t time.Time) Labeler {
+	return &tidbLabeler{
+		history: s.history,
+		at:      t,
 	}
 }
 
@@ -142,9 +167,8 @@ func (e *tidbLabeler) label(key string) (label LabelKey) {
 		return
 	}
 
-	var detail *tableDetail
-	if v, ok := e.TableMap.Load(tableID); ok {
-		detail = v.(*tableDetail)
+	detail := e.history.get(tableID, e.at)
+	if detail != nil {
 		label.Labels = append(label.Labels, detail.DB, detail.Name)
 	} else {
 		label.Labels = append(label.Labels, fmt.Sprintf("table_%d", tableID))
@@ -175,3 +199,47 @@ var globalEnd = LabelKey{
 	Key:    "",
 	Labels: []string{},
 }
+
+// TableKey is the table and the index which a key belongs to.
+type TableKey struct {
+	DB      string
+	Table   string
+	TableID int64
+	// Index is empty for the record keys.
+	Index   string
+	IndexID int64
+}
+
+// TableKeyDecoder decodes the table and the index of keys. It is implemented by the labeler of the TiDB label
+// strategy.
+type TableKeyDecoder interface {
+	// DecodeTableKey returns false if the key is not a table key.
+	DecodeTableKey(key string) (TableKey, bool)
+}
+
+func (e *tidbLabeler) DecodeTableKey(key string) (TableKey, bool) {
+	keyInfo, _ := e.Buffer.DecodeKey(region.Bytes(key))
+	isMeta, tableID := keyInfo.MetaOrTable()
+	if isMeta || tableID == 0 {
+		return TableKey{}, false
+	}
+	tableKey := TableKey{
+		Table:   fmt.Sprintf("table_%d", tableID),
+		TableID: tableID,
+		IndexID: keyInfo.IndexInfo(),
+	}
+	detail := e.history.get(tableID, e.at)
+	if detail != nil {
+		tableKey.DB = detail.DB
+		tableKey.Table = detail.Name
+	}
+	if tableKey.IndexID != 0 {
+		tableKey.Index = fmt.Sprintf("index_%d", tableKey.IndexID)
+		if detail != nil {
+			if name, ok := detail.Indices[tableKey.IndexID]; ok {
+				tableKey.Index = name
+			}
+		}
+	}
+	return tableKey, true
+}
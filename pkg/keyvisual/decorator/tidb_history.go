@@ -0,0 +1,181 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package decorator
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pingcap/tidb-dashboard/pkg/dbstore"
+)
+
+const tableLabelModelName = "keyviz_table_label"
+
+// TableLabelModel is a version of the label of a table or a partition. It is valid from ValidFrom until the next
+// version of the same table.
+type TableLabelModel struct {
+	ID            uint  `gorm:"primary_key"`
+	TableID       int64 `gorm:"index"`
+	DB            string
+	Name          string
+	Indices       string // JSON encoded index names by index ids
+	SchemaVersion int64
+	ValidFrom     time.Time
+}
+
+func (TableLabelModel) TableName() string {
+	return tableLabelModelName
+}
+
+type tableVersion struct {
+	*tableDetail
+	SchemaVersion int64
+	ValidFrom     time.Time
+}
+
+func (v *tableVersion) toModel() (*TableLabelModel, error) {
+	indices, err := json.Marshal(v.Indices)
+	if err != nil {
+		return nil, err
+	}
+	return &TableLabelModel{
+		TableID:       v.ID,
+		DB:            v.DB,
+		Name:          v.Name,
+		Indices:       string(indices),
+		SchemaVersion: v.SchemaVersion,
+		ValidFrom:     v.ValidFrom,
+	}, nil
+}
+
+func (m *TableLabelModel) toVersion() (*tableVersion, error) {
+	indices := make(map[int64]string)
+	if m.Indices != "" {
+		if err := json.Unmarshal([]byte(m.Indices), &indices); err != nil {
+			return nil, ErrInvalidData.Wrap(err, "table label unmarshal failed")
+		}
+	}
+	return &tableVersion{
+		tableDetail: &tableDetail{
+			Name:    m.Name,
+			DB:      m.DB,
+			ID:      m.TableID,
+			Indices: indices,
+		},
+		SchemaVersion: m.SchemaVersion,
+		ValidFrom:     m.ValidFrom,
+	}, nil
+}
+
+// tableHistory keeps all versions of the tables. Since TiDB never reuses table ids, the labels of dropped or
+// truncated tables are kept, and the renamed tables have a version for each name.
+type tableHistory struct {
+	mu       sync.RWMutex
+	versions map[int64][]*tableVersion // ordered by ValidFrom
+}
+
+func newTableHistory() *tableHistory {
+	return &tableHistory{
+		versions: make(map[int64][]*tableVersion),
+	}
+}
+
+// get returns the version of the table valid at the time, or the latest version if the time is zero. The earliest
+// version is used if the time is before all versions, since it is the first known label of the table.
+func (h *tableHistory) get(id int64, t time.Time) *tableDetail {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	versions := h.versions[id]
+	if len(versions) == 0 {
+		return nil
+	}
+	if t.IsZero() {
+		return versions[len(versions)-1].tableDetail
+	}
+	i := sort.Search(len(versions), func(i int) bool {
+		return versions[i].ValidFrom.After(t)
+	})
+	if i == 0 {
+		return versions[0].tableDetail
+	}
+	return versions[i-1].tableDetail
+}
+
+// update adds a version of the table if it is changed. It returns nil if the table is not changed.
+func (h *tableHistory) update(detail *tableDetail, schemaVersion int64, validFrom time.Time) *tableVersion {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	versions := h.versions[detail.ID]
+	if n := len(versions); n > 0 {
+		latest := versions[n-1]
+		if latest.Name == detail.Name && latest.DB == detail.DB && reflect.DeepEqual(latest.Indices, detail.Indices) {
+			return nil
+		}
+		// Keep the versions ordered even if the clocks are not synchronized.
+		if validFrom.Before(latest.ValidFrom) {
+			validFrom = latest.ValidFrom
+		}
+	}
+	version := &tableVersion{
+		tableDetail:   detail,
+		SchemaVersion: schemaVersion,
+		ValidFrom:     validFrom,
+	}
+	h.versions[detail.ID] = append(versions, version)
+	return version
+}
+
+// load restores the history from the dbstore, and returns the max schema version in it.
+func (h *tableHistory) load(db *dbstore.DB) (int64, error) {
+	if err := db.AutoMigrate(&TableLabelModel{}); err != nil {
+		return -1, err
+	}
+	var models []*TableLabelModel
+	if err := db.Order("valid_from, id").Find(&models).Error; err != nil {
+		return -1, err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	schemaVersion := int64(-1)
+	for _, m := range models {
+		version, err := m.toVersion()
+		if err != nil {
+			return -1, err
+		}
+		h.versions[m.TableID] = append(h.versions[m.TableID], version)
+		if m.SchemaVersion > schemaVersion {
+			schemaVersion = m.SchemaVersion
+		}
+	}
+	return schemaVersion, nil
+}
+
+func saveTableVersions(db *dbstore.DB, versions []*tableVersion) error {
+	if len(versions) == 0 {
+		return nil
+	}
+	models := make([]*TableLabelModel, len(versions))
+	for i, version := range versions {
+		m, err := version.toModel()
+		if err != nil {
+			return err
+		}
+		models[i] = m
+	}
+	return db.Create(&models).Error
+}
@@ -0,0 +1,147 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package decorator
+
+import (
+	"time"
+
+	. "github.com/pingcap/check"
+
+	"github.com/pingcap/tidb-dashboard/pkg/tidb/model"
+)
+
+var _ = Suite(&testTableHistorySuite{})
+
+type testTableHistorySuite struct{}
+
+var baseTime = time.Unix(1600000000, 0)
+
+func tableInfo(id int64, name string, indices ...string) *model.TableInfo {
+	table := &model.TableInfo{
+		ID:   id,
+		Name: model.CIStr{O: name},
+	}
+	for i, index := range indices {
+		table.Indices = append(table.Indices, &model.IndexInfo{ID: int64(i + 1), Name: model.CIStr{O: index}})
+	}
+	return table
+}
+
+func ddlJob(schemaID int64, schemaVersion int64, minutes int, table *model.TableInfo) *model.Job {
+	return &model.Job{
+		SchemaID: schemaID,
+		BinlogInfo: &model.HistoryInfo{
+			SchemaVersion: schemaVersion,
+			TableInfo:     table,
+			FinishedTS:    uint64(baseTime.Add(time.Duration(minutes)*time.Minute).UnixNano()/int64(time.Millisecond)) << tsoPhysicalShiftBits,
+		},
+	}
+}
+
+func newTestLabelStrategy() *tidbLabelStrategy {
+	return &tidbLabelStrategy{
+		history:       newTableHistory(),
+		dbNames:       map[int64]string{1: "test"},
+		SchemaVersion: -1,
+	}
+}
+
+func (t *testTableHistorySuite) TestLabelAt(c *C) {
+	s := newTestLabelStrategy()
+	s.updateTable("test", tableInfo(10, "t", "idx"), 1, baseTime)
+	s.updateTable("test", tableInfo(10, "t2", "idx"), 2, baseTime.Add(10*time.Minute))
+	var buf model.KeyInfoBuffer
+	key := string(buf.GenerateKey(10, 0))
+
+	labels := func(labeler Labeler) []string {
+		return labeler.Label([]string{"", key, ""})[1].Labels
+	}
+	c.Assert(labels(s.NewLabeler()), DeepEquals, []string{"test", "t2"})
+	c.Assert(labels(s.NewLabelerAt(baseTime.Add(5*time.Minute))), DeepEquals, []string{"test", "t"})
+	c.Assert(labels(s.NewLabelerAt(baseTime.Add(10*time.Minute))), DeepEquals, []string{"test", "t2"})
+	// The first known label is used before the history.
+	c.Assert(labels(s.NewLabelerAt(baseTime.Add(-time.Hour))), DeepEquals, []string{"test", "t"})
+	c.Assert(labels(LabelStrategyAt(s, baseTime).NewLabeler()), DeepEquals, []string{"test", "t"})
+}
+
+func (t *testTableHistorySuite) TestApplyDDLJobs(c *C) {
+	s := newTestLabelStrategy()
+	c.Assert(s.updateTable("test", tableInfo(10, "t", "idx"), 3, baseTime), HasLen, 1)
+	// The table is not changed.
+	c.Assert(s.updateTable("test", tableInfo(10, "t", "idx"), 3, baseTime), HasLen, 0)
+
+	jobs := []*model.Job{
+		// truncate table t2
+		ddlJob(1, 9, 4, tableInfo(12, "t2")),
+		ddlJob(1, 3, 0, tableInfo(10, "t", "idx")),
+		// rename table t to t2
+		ddlJob(1, 7, 2, tableInfo(10, "t2", "idx")),
+		// not finished when the schema version is got
+		ddlJob(1, 11, 6, tableInfo(10, "t3", "idx")),
+		{SchemaID: 1},
+	}
+	versions, ok := s.applyDDLJobs(jobs, 3, 10)
+	c.Assert(ok, IsTrue)
+	c.Assert(versions, HasLen, 2)
+	c.Assert(versions[0].ID, Equals, int64(10))
+	c.Assert(versions[0].Name, Equals, "t2")
+	c.Assert(versions[0].SchemaVersion, Equals, int64(7))
+	c.Assert(versions[0].ValidFrom.Equal(baseTime.Add(2*time.Minute)), IsTrue)
+	c.Assert(versions[1].ID, Equals, int64(12))
+
+	// The labels of the table before the truncation are kept.
+	c.Assert(s.history.get(10, baseTime.Add(time.Minute)).Name, Equals, "t")
+	c.Assert(s.history.get(10, time.Time{}).Name, Equals, "t2")
+	c.Assert(s.history.get(12, time.Time{}).Name, Equals, "t2")
+
+	// All jobs are returned if there are less than the limit.
+	_, ok = s.applyDDLJobs(jobs[2:], 6, 10)
+	c.Assert(ok, IsTrue)
+	// The jobs between the schema version 3 and 100 may be missing.
+	jobs = make([]*model.Job, maxDDLHistoryJobs)
+	for i := range jobs {
+		jobs[i] = ddlJob(1, int64(i+100), 0, tableInfo(20, "t"))
+	}
+	_, ok = s.applyDDLJobs(jobs, 3, 10000)
+	c.Assert(ok, IsFalse)
+	// The cancelled jobs do not mean the jobs before are all returned.
+	jobs[len(jobs)-1] = ddlJob(1, 0, 0, nil)
+	_, ok = s.applyDDLJobs(jobs, 3, 10000)
+	c.Assert(ok, IsFalse)
+}
+
+func (t *testTableHistorySuite) TestPersist(c *C) {
+	db := newTestDB(c)
+
+	history := newTableHistory()
+	schemaVersion, err := history.load(db)
+	c.Assert(err, IsNil)
+	c.Assert(schemaVersion, Equals, int64(-1))
+
+	s := newTestLabelStrategy()
+	versions := s.updateTable("test", tableInfo(10, "t", "idx"), 1, baseTime)
+	versions = append(versions, s.updateTable("test", tableInfo(10, "t2", "idx", "idx2"), 2, baseTime.Add(time.Minute))...)
+	c.Assert(saveTableVersions(db, versions), IsNil)
+
+	schemaVersion, err = history.load(db)
+	c.Assert(err, IsNil)
+	c.Assert(schemaVersion, Equals, int64(2))
+	c.Assert(history.get(10, baseTime), DeepEquals, &tableDetail{
+		Name:    "t",
+		DB:      "test",
+		ID:      10,
+		Indices: map[int64]string{1: "idx"},
+	})
+	c.Assert(history.get(10, time.Time{}).Indices, DeepEquals, map[int64]string{1: "idx", 2: "idx2"})
+}
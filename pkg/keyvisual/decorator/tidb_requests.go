@@ -18,6 +18,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/url"
+	"sort"
 	"strconv"
 	"time"
 
@@ -31,6 +32,11 @@ import (
 const (
 	schemaVersionPath = "/tidb/ddl/global_schema_version"
 	etcdGetTimeout    = time.Second
+
+	// maxDDLHistoryJobs limits the DDL jobs requested for an incremental update. A full update is used instead if
+	// there are more schema changes.
+	maxDDLHistoryJobs    = 1024
+	tsoPhysicalShiftBits = 18
 )
 
 var (
@@ -68,15 +74,40 @@ func (s *tidbLabelStrategy) updateMap(ctx context.Context) {
 
 	log.Debug("schema version has changed", zap.Int64("old", s.SchemaVersion), zap.Int64("new", schemaVersion))
 
+	var versions []*tableVersion
+	updateSuccess := false
+	if s.SchemaVersion != -1 {
+		versions, updateSuccess = s.updateFromDDLHistory(s.SchemaVersion, schemaVersion)
+	}
+	if !updateSuccess {
+		var fullVersions []*tableVersion
+		fullVersions, updateSuccess = s.updateFromSchema(schemaVersion)
+		versions = append(versions, fullVersions...)
+	}
+
+	if err := saveTableVersions(s.db, versions); err != nil {
+		log.Warn("failed to save table labels", zap.Error(err))
+	}
+
+	// update schema version
+	if updateSuccess {
+		s.SchemaVersion = schemaVersion
+	}
+}
+
+// updateFromSchema gets all tables from TiDB, and records the changed tables.
+func (s *tidbLabelStrategy) updateFromSchema(schemaVersion int64) ([]*tableVersion, bool) {
 	// get all database info
-	var dbInfos []*model.DBInfo
-	if err := s.request("/schema", &dbInfos); err != nil {
+	dbInfos, err := s.requestDBInfos()
+	if err != nil {
 		log.Error("fail to send schema request to TiDB", zap.Error(err))
-		return
+		return nil, false
 	}
 
 	// get all table info
+	now := time.Now()
 	updateSuccess := true
+	versions := make([]*tableVersion, 0)
 	for _, db := range dbInfos {
 		if db.State == model.StateNone {
 			continue
@@ -89,35 +120,123 @@ func (s *tidbLabelStrategy) updateMap(ctx context.Context) {
 			continue
 		}
 		for _, table := range tableInfos {
-			indices := make(map[int64]string, len(table.Indices))
-			for _, index := range table.Indices {
-				indices[index.ID] = index.Name.O
-			}
-			detail := &tableDetail{
-				Name:    table.Name.O,
-				DB:      db.Name.O,
-				ID:      table.ID,
+			versions = append(versions, s.updateTable(db.Name.O, table, schemaVersion, now)...)
+		}
+	}
+	return versions, updateSuccess
+}
+
+// updateFromDDLHistory applies the schema changes in (from, to] from the DDL history of TiDB. It returns false if
+// the history is not available or not complete, then a full update is required.
+func (s *tidbLabelStrategy) updateFromDDLHistory(from, to int64) ([]*tableVersion, bool) {
+	if len(s.dbNames) == 0 {
+		if _, err := s.requestDBInfos(); err != nil {
+			log.Warn("fail to send schema request to TiDB", zap.Error(err))
+			return nil, false
+		}
+	}
+	var jobs []*model.Job
+	if err := s.request(fmt.Sprintf("/ddl/history?limit=%d", maxDDLHistoryJobs), &jobs); err != nil {
+		log.Warn("fail to get DDL history from TiDB, fall back to a full update", zap.Error(err))
+		return nil, false
+	}
+	versions, ok := s.applyDDLJobs(jobs, from, to)
+	if !ok {
+		log.Debug("DDL history is not complete, fall back to a full update", zap.Int64("from", from))
+	}
+	return versions, ok
+}
+
+// applyDDLJobs records the tables changed by the jobs in (from, to]. It returns false if the jobs may not contain
+// all changes since from.
+func (s *tidbLabelStrategy) applyDDLJobs(jobs []*model.Job, from, to int64) ([]*tableVersion, bool) {
+	complete := len(jobs) < maxDDLHistoryJobs
+	finishedJobs := make([]*model.Job, 0)
+	for _, job := range jobs {
+		// Cancelled jobs have no schema version, which says nothing about the jobs before.
+		if job.BinlogInfo == nil || job.BinlogInfo.SchemaVersion == 0 {
+			continue
+		}
+		if job.BinlogInfo.SchemaVersion <= from {
+			complete = true
+		} else if job.BinlogInfo.SchemaVersion <= to {
+			finishedJobs = append(finishedJobs, job)
+		}
+	}
+	if !complete {
+		return nil, false
+	}
+	sort.SliceStable(finishedJobs, func(i, j int) bool {
+		return finishedJobs[i].BinlogInfo.SchemaVersion < finishedJobs[j].BinlogInfo.SchemaVersion
+	})
+
+	versions := make([]*tableVersion, 0)
+	for _, job := range finishedJobs {
+		info := job.BinlogInfo
+		if info.DBInfo != nil {
+			s.dbNames[info.DBInfo.ID] = info.DBInfo.Name.O
+		}
+		if info.TableInfo == nil {
+			continue
+		}
+		dbName, ok := s.dbNames[job.SchemaID]
+		if !ok {
+			dbName = job.SchemaName
+		}
+		versions = append(versions, s.updateTable(dbName, info.TableInfo, info.SchemaVersion, tsoToTime(info.FinishedTS))...)
+	}
+	return versions, true
+}
+
+// updateTable records the table and its partitions if they are changed.
+func (s *tidbLabelStrategy) updateTable(dbName string, table *model.TableInfo, schemaVersion int64, validFrom time.Time) []*tableVersion {
+	indices := make(map[int64]string, len(table.Indices))
+	for _, index := range table.Indices {
+		indices[index.ID] = index.Name.O
+	}
+	details := []*tableDetail{{
+		Name:    table.Name.O,
+		DB:      dbName,
+		ID:      table.ID,
+		Indices: indices,
+	}}
+	if partition := table.GetPartitionInfo(); partition != nil {
+		for _, partitionDef := range partition.Definitions {
+			details = append(details, &tableDetail{
+				Name:    fmt.Sprintf("%s/%s", table.Name.O, partitionDef.Name.O),
+				DB:      dbName,
+				ID:      partitionDef.ID,
 				Indices: indices,
-			}
-			s.TableMap.Store(table.ID, detail)
-			if partition := table.GetPartitionInfo(); partition != nil {
-				for _, partitionDef := range partition.Definitions {
-					detail := &tableDetail{
-						Name:    fmt.Sprintf("%s/%s", table.Name.O, partitionDef.Name.O),
-						DB:      db.Name.O,
-						ID:      partitionDef.ID,
-						Indices: indices,
-					}
-					s.TableMap.Store(partitionDef.ID, detail)
-				}
-			}
+			})
 		}
 	}
 
-	// update schema version
-	if updateSuccess {
-		s.SchemaVersion = schemaVersion
+	versions := make([]*tableVersion, 0, len(details))
+	for _, detail := range details {
+		if version := s.history.update(detail, schemaVersion, validFrom); version != nil {
+			versions = append(versions, version)
+		}
+	}
+	return versions
+}
+
+func (s *tidbLabelStrategy) requestDBInfos() ([]*model.DBInfo, error) {
+	var dbInfos []*model.DBInfo
+	if err := s.request("/schema", &dbInfos); err != nil {
+		return nil, err
+	}
+	for _, db := range dbInfos {
+		s.dbNames[db.ID] = db.Name.O
+	}
+	return dbInfos, nil
+}
+
+// tsoToTime returns the physical time of a TSO, or now if it is not set.
+func tsoToTime(ts uint64) time.Time {
+	if ts == 0 {
+		return time.Now()
 	}
+	return time.Unix(0, int64(ts>>tsoPhysicalShiftBits)*int64(time.Millisecond))
 }
 
 func (s *tidbLabelStrategy) request(path string, v interface{}) error {
@@ -14,9 +14,36 @@
 package decorator
 
 import (
+	"time"
+
 	. "github.com/pingcap/check"
+
+	"github.com/pingcap/tidb-dashboard/pkg/tidb/model"
 )
 
 var _ = Suite(&testTiDBSuite{})
 
 type testTiDBSuite struct{}
+
+func (t *testTiDBSuite) TestDecodeTableKey(c *C) {
+	history := newTableHistory()
+	history.update(&tableDetail{
+		Name:    "t",
+		DB:      "test",
+		ID:      10,
+		Indices: map[int64]string{1: "idx"},
+	}, 1, time.Unix(1600000000, 0))
+	labeler := &tidbLabeler{history: history}
+	var buf model.KeyInfoBuffer
+
+	tableKey, ok := labeler.DecodeTableKey(string(buf.GenerateKey(10, 100)))
+	c.Assert(ok, IsTrue)
+	c.Assert(tableKey, DeepEquals, TableKey{DB: "test", Table: "t", TableID: 10})
+
+	tableKey, ok = labeler.DecodeTableKey(string(buf.GenerateKey(11, 0)))
+	c.Assert(ok, IsTrue)
+	c.Assert(tableKey, DeepEquals, TableKey{Table: "table_11", TableID: 11})
+
+	_, ok = labeler.DecodeTableKey("")
+	c.Assert(ok, IsFalse)
+}
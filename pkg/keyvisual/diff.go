@@ -0,0 +1,179 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keyvisual
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/pingcap/tidb-dashboard/pkg/keyvisual/decorator"
+	"github.com/pingcap/tidb-dashboard/pkg/keyvisual/matrix"
+	"github.com/pingcap/tidb-dashboard/pkg/keyvisual/region"
+)
+
+const (
+	maxDiffTables = 100
+	// The table of a key range is identified by the first labels of its start key, which are the db and the table
+	// with the TiDB label strategy.
+	tableLabelsLen = 2
+)
+
+// DiffMatrix compares the heatmap of a time range to the heatmap of a base time range on the same keys.
+type DiffMatrix struct {
+	KeyAxis      []decorator.LabelKey `json:"keyAxis" binding:"required"`
+	BaseTimeAxis []int64              `json:"baseTimeAxis" binding:"required"`
+	TimeAxis     []int64              `json:"timeAxis" binding:"required"`
+	BaseData     [][]uint64           `json:"baseData" binding:"required"`
+	Data         [][]uint64           `json:"data" binding:"required"`
+	// Diff is the difference of each cell of the data to the cell of the base data at the same relative time,
+	// normalized into [-1, 1] by the max value of all cells.
+	Diff   [][]float64  `json:"diff" binding:"required"`
+	Tables []*TableDiff `json:"tables" binding:"required"`
+}
+
+// TableDiff is the change of a table, ordered by the absolute change.
+type TableDiff struct {
+	Labels []string `json:"labels"`
+	// Base and Value are the mean values of each time step in the base time range and the time range.
+	Base  float64 `json:"base"`
+	Value float64 `json:"value"`
+	// Change is the difference of the Value to the Base, normalized into [-1, 1] by the larger one.
+	Change float64 `json:"change"`
+}
+
+func meanOfRange(data [][]uint64, j int) float64 {
+	var sum uint64
+	for _, values := range data {
+		sum += values[j]
+	}
+	return float64(sum) / float64(len(data))
+}
+
+func normalizedChange(base, value float64) float64 {
+	max := math.Max(base, value)
+	if max == 0 {
+		return 0
+	}
+	return (value - base) / max
+}
+
+// diffMatrix compares the data of the tag in the matrices, which must share the same keys.
+func diffMatrix(base, mx *matrix.Matrix, tag string) *DiffMatrix {
+	baseData := base.DataMap[tag]
+	data := mx.DataMap[tag]
+	keyLen := len(mx.Keys) - 1
+
+	var maxValue uint64
+	for _, d := range [][][]uint64{baseData, data} {
+		for _, values := range d {
+			for _, value := range values {
+				if value > maxValue {
+					maxValue = value
+				}
+			}
+		}
+	}
+	diff := make([][]float64, len(data))
+	for i, values := range data {
+		baseValues := baseData[i*len(baseData)/len(data)]
+		diff[i] = make([]float64, keyLen)
+		if maxValue == 0 {
+			continue
+		}
+		for j := range values {
+			diff[i][j] = (float64(values[j]) - float64(baseValues[j])) / float64(maxValue)
+		}
+	}
+
+	tableIndex := make(map[string]*TableDiff)
+	tables := make([]*TableDiff, 0)
+	for j := 0; j < keyLen; j++ {
+		labels := mx.KeyAxis[j].Labels
+		if len(labels) > tableLabelsLen {
+			labels = labels[:tableLabelsLen]
+		}
+		name := strings.Join(labels, "\x00")
+		table, ok := tableIndex[name]
+		if !ok {
+			table = &TableDiff{Labels: labels}
+			tableIndex[name] = table
+			tables = append(tables, table)
+		}
+		table.Base += meanOfRange(baseData, j)
+		table.Value += meanOfRange(data, j)
+	}
+	for _, table := range tables {
+		table.Change = normalizedChange(table.Base, table.Value)
+	}
+	sort.SliceStable(tables, func(i, j int) bool {
+		return math.Abs(tables[i].Value-tables[i].Base) > math.Abs(tables[j].Value-tables[j].Base)
+	})
+	if len(tables) > maxDiffTables {
+		tables = tables[:maxDiffTables]
+	}
+
+	return &DiffMatrix{
+		KeyAxis:      mx.KeyAxis,
+		BaseTimeAxis: base.TimeAxis,
+		TimeAxis:     mx.TimeAxis,
+		BaseData:     baseData,
+		Data:         data,
+		Diff:         diff,
+		Tables:       tables,
+	}
+}
+
+// @Summary Key Visual Diff Heatmaps
+// @Description Compare the heatmaps in a given range to the heatmaps in a base time range. Each key is labeled with the tables valid at the end of the latest time slice in which it has data in either range, or at the end of the time range if it has no data.
+// @Param startkey query string false "The start of the key range"
+// @Param endkey query string false "The end of the key range"
+// @Param basestarttime query int true "The start of the base time range (Unix)"
+// @Param baseendtime query int true "The end of the base time range (Unix)"
+// @Param starttime query int false "The start of the time range (Unix)"
+// @Param endtime query int false "The end of the time range (Unix)"
+// @Param type query string false "Main types of data" Enums(written_bytes, read_bytes, written_keys, read_keys, integration)
+// @Success 200 {object} DiffMatrix
+// @Router /keyvisual/heatmaps/diff [get]
+// @Security JwtAuth
+// @Failure 401 {object} utils.APIError "Unauthorized failure"
+func (s *Service) diffHeatmaps(c *gin.Context) {
+	endTime := time.Now()
+	startTime := endTime.Add(-360 * time.Minute)
+	q, ok := parseHeatmapsQuery(c, startTime, endTime)
+	if !ok {
+		return
+	}
+	if c.Query("basestarttime") == "" || c.Query("baseendtime") == "" {
+		c.JSON(http.StatusBadRequest, "bad request")
+		return
+	}
+	baseStartTime, baseEndTime, ok := parseTimeRangeOf(c, "basestarttime", "baseendtime", time.Time{}, time.Time{})
+	if !ok {
+		return
+	}
+
+	basePlane := s.stat.Range(baseStartTime, baseEndTime, q.startKey, q.endKey, q.baseTag)
+	plane := s.stat.Range(q.startTime, q.endTime, q.startKey, q.endKey, q.baseTag)
+	matrices := matrix.PixelPlanes(s.strategyAt(q.endTime), heatmapsMaxDisplayY, region.GetDisplayTags(q.baseTag), basePlane, plane)
+	for i := range matrices {
+		matrices[i].Range(q.startKey, q.endKey)
+	}
+	labelAtLatestData(s.strategy.LabelStrategy, &matrices[0], &matrices[1])
+	c.JSON(http.StatusOK, diffMatrix(&matrices[0], &matrices[1], q.baseTag.String()))
+}
@@ -0,0 +1,121 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keyvisual
+
+import (
+	"strconv"
+	"time"
+
+	. "github.com/pingcap/check"
+
+	"github.com/pingcap/tidb-dashboard/pkg/config"
+	"github.com/pingcap/tidb-dashboard/pkg/keyvisual/decorator"
+	"github.com/pingcap/tidb-dashboard/pkg/keyvisual/matrix"
+)
+
+var _ = Suite(&testDiffSuite{})
+
+type testDiffSuite struct{}
+
+func (t *testDiffSuite) TestDiffMatrix(c *C) {
+	keys := []string{"a", "b", "c", "d"}
+	keyAxis := []decorator.LabelKey{
+		{Key: "61", Labels: []string{"db", "t1"}},
+		{Key: "62", Labels: []string{"db", "t1", "idx"}},
+		{Key: "63", Labels: []string{"db", "t2"}},
+		{Key: "64", Labels: []string{}},
+	}
+	base := &matrix.Matrix{
+		Keys:     keys,
+		KeyAxis:  keyAxis,
+		TimeAxis: []int64{0, 60, 120},
+		DataMap:  map[string][][]uint64{"tag": {{10, 0, 40}, {30, 0, 40}}},
+	}
+	mx := &matrix.Matrix{
+		Keys:     keys,
+		KeyAxis:  keyAxis,
+		TimeAxis: []int64{600, 660, 720, 780, 840},
+		DataMap:  map[string][][]uint64{"tag": {{20, 10, 0}, {20, 10, 0}, {20, 10, 80}, {20, 10, 0}}},
+	}
+	diff := diffMatrix(base, mx, "tag")
+	c.Assert(diff.BaseTimeAxis, DeepEquals, base.TimeAxis)
+	c.Assert(diff.TimeAxis, DeepEquals, mx.TimeAxis)
+	c.Assert(diff.Diff, HasLen, 4)
+	// The first two time steps are compared to the first base time step.
+	c.Assert(diff.Diff[0], DeepEquals, []float64{10.0 / 80, 10.0 / 80, -40.0 / 80})
+	c.Assert(diff.Diff[2], DeepEquals, []float64{-10.0 / 80, 10.0 / 80, 40.0 / 80})
+
+	c.Assert(diff.Tables, HasLen, 2)
+	c.Assert(diff.Tables[0].Labels, DeepEquals, []string{"db", "t2"})
+	c.Assert(diff.Tables[0].Base, Equals, 40.0)
+	c.Assert(diff.Tables[0].Value, Equals, 20.0)
+	c.Assert(diff.Tables[0].Change, Equals, -0.5)
+	c.Assert(diff.Tables[1].Labels, DeepEquals, []string{"db", "t1"})
+	c.Assert(diff.Tables[1].Base, Equals, 20.0)
+	c.Assert(diff.Tables[1].Value, Equals, 30.0)
+	c.Assert(diff.Tables[1].Change, Equals, 10.0/30)
+}
+
+// timeLabelStrategy labels keys with the unix time of the labels, so that the time of each label can be checked.
+type timeLabelStrategy struct{}
+
+func (timeLabelStrategy) ReloadConfig(cfg *config.KeyVisualConfig) {}
+
+func (s timeLabelStrategy) NewLabeler() decorator.Labeler {
+	return s.NewLabelerAt(time.Time{})
+}
+
+func (timeLabelStrategy) NewLabelerAt(t time.Time) decorator.Labeler {
+	return timeLabeler(t.Unix())
+}
+
+type timeLabeler int64
+
+func (l timeLabeler) CrossBorder(startKey, endKey string) bool {
+	return false
+}
+
+func (l timeLabeler) Label(keys []string) []decorator.LabelKey {
+	labelKeys := make([]decorator.LabelKey, len(keys))
+	for i, key := range keys {
+		labelKeys[i] = decorator.LabelKey{Key: key, Labels: []string{strconv.FormatInt(int64(l), 10)}}
+	}
+	return labelKeys
+}
+
+func (t *testDiffSuite) TestLabelAtLatestData(c *C) {
+	keys := []string{"", "a", "b", "c", "d"}
+	keyAxis := timeLabeler(900).Label(keys)
+	base := &matrix.Matrix{
+		Keys:     keys,
+		KeyAxis:  keyAxis,
+		TimeAxis: []int64{0, 60, 120},
+		DataMap:  map[string][][]uint64{"tag": {{0, 5, 0, 0}, {1, 0, 0, 0}}},
+	}
+	mx := &matrix.Matrix{
+		Keys:     keys,
+		KeyAxis:  keyAxis,
+		TimeAxis: []int64{600, 660, 720},
+		DataMap:  map[string][][]uint64{"tag": {{0, 0, 0, 3}, {0, 0, 0, 0}}},
+	}
+	labelAtLatestData(timeLabelStrategy{}, base, mx)
+	labels := make([]string, len(keys))
+	for i, labelKey := range mx.KeyAxis {
+		labels[i] = labelKey.Labels[0]
+	}
+	// The start of the key space is kept, "b" has no data, and the last key is labeled with the last range.
+	c.Assert(labels, DeepEquals, []string{"900", "60", "900", "660", "660"})
+	c.Assert(base.KeyAxis, DeepEquals, mx.KeyAxis)
+	c.Assert(keyAxis[1].Labels, DeepEquals, []string{"900"})
+}
@@ -0,0 +1,246 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keyvisual
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/pingcap/tidb-dashboard/pkg/keyvisual/decorator"
+	"github.com/pingcap/tidb-dashboard/pkg/keyvisual/matrix"
+	"github.com/pingcap/tidb-dashboard/pkg/keyvisual/region"
+)
+
+const (
+	hotspotsMaxDisplayY = 512
+	defaultHotspotLimit = 10
+	maxHotspotLimit     = 100
+
+	// A range is hot in a time step when it is hotter than hotCellRatio times the average of all cells.
+	hotCellRatio = 2
+	// A range is isolated when it is hotter than isolatedRatio times its neighbours.
+	isolatedRatio = 10
+	// A range is bursting when its peak is higher than burstRatio times its mean.
+	burstRatio = 4
+	// A range is sustained when it is hot in at least this ratio of time steps.
+	sustainedActiveRatio = 0.5
+	// A range is written mostly when its written bytes are more than writeDominantRatio times its read bytes.
+	writeDominantRatio = 2
+)
+
+type HotspotSortBy string
+
+const (
+	HotspotSortByIntensity  HotspotSortBy = "intensity"
+	HotspotSortByBurstiness HotspotSortBy = "burstiness"
+)
+
+type HotspotClass string
+
+const (
+	// HotspotSequentialWriteTail is the written tail of a logical range, e.g. the hotspot of an auto-increment key.
+	HotspotSequentialWriteTail HotspotClass = "sequential_write_tail"
+	// HotspotSingleRow is a narrow range much hotter than its neighbours for a long time, e.g. a hot row.
+	HotspotSingleRow HotspotClass = "single_row_hotspot"
+	// HotspotBurst is a range which is hot only in short periods.
+	HotspotBurst HotspotClass = "burst"
+	// HotspotSustained is the other hot range.
+	HotspotSustained HotspotClass = "sustained"
+)
+
+type Hotspot struct {
+	StartKey decorator.LabelKey `json:"start_key"`
+	EndKey   decorator.LabelKey `json:"end_key"`
+	// Intensity is the mean value of each time step.
+	Intensity float64 `json:"intensity"`
+	// Peak is the max value of each time step.
+	Peak uint64 `json:"peak"`
+	// Burstiness is the ratio of the peak to the intensity.
+	Burstiness float64 `json:"burstiness"`
+	// ActiveRatio is the ratio of time steps in which the range is hot.
+	ActiveRatio float64 `json:"active_ratio"`
+	// Share is the ratio of the value of the range to the total value.
+	Share float64      `json:"share"`
+	Class HotspotClass `json:"class"`
+}
+
+type HotspotsResponse struct {
+	StartTime int64      `json:"start_time"`
+	EndTime   int64      `json:"end_time"`
+	Type      string     `json:"type"`
+	Total     uint64     `json:"total"`
+	Hotspots  []*Hotspot `json:"hotspots"`
+}
+
+type hotspotRange struct {
+	index   int
+	total   uint64
+	written uint64
+	read    uint64
+	Hotspot
+}
+
+// analyzeHotspots ranks the key ranges of the matrix by the base tag. The labeler is used to find the borders of
+// logical ranges.
+func analyzeHotspots(mx *matrix.Matrix, baseTag region.StatTag, labeler decorator.Labeler, sortBy HotspotSortBy, limit int) (uint64, []*Hotspot) {
+	data := mx.DataMap[baseTag.String()]
+	writtenData := mx.DataMap[region.WrittenBytes.String()]
+	readData := mx.DataMap[region.ReadBytes.String()]
+	timeLen := len(data)
+	keyLen := len(mx.Keys) - 1
+	if timeLen == 0 || keyLen <= 0 {
+		return 0, []*Hotspot{}
+	}
+
+	ranges := make([]*hotspotRange, keyLen)
+	var total uint64
+	for j := range ranges {
+		r := &hotspotRange{index: j}
+		for i := 0; i < timeLen; i++ {
+			r.total += data[i][j]
+			if data[i][j] > r.Peak {
+				r.Peak = data[i][j]
+			}
+			if writtenData != nil && readData != nil {
+				r.written += writtenData[i][j]
+				r.read += readData[i][j]
+			}
+		}
+		r.Intensity = float64(r.total) / float64(timeLen)
+		if r.Intensity > 0 {
+			r.Burstiness = float64(r.Peak) / r.Intensity
+		}
+		total += r.total
+		ranges[j] = r
+	}
+	if total == 0 {
+		return 0, []*Hotspot{}
+	}
+
+	hotCell := float64(total) / float64(timeLen*keyLen) * hotCellRatio
+	candidates := make([]*hotspotRange, 0)
+	for _, r := range ranges {
+		if float64(r.Peak) < hotCell {
+			continue
+		}
+		active := 0
+		for i := 0; i < timeLen; i++ {
+			if float64(data[i][r.index]) >= hotCell {
+				active++
+			}
+		}
+		r.ActiveRatio = float64(active) / float64(timeLen)
+		r.Share = float64(r.total) / float64(total)
+		r.StartKey = mx.KeyAxis[r.index]
+		r.EndKey = mx.KeyAxis[r.index+1]
+		r.Class = classifyHotspot(mx.Keys, ranges, r, labeler)
+		candidates = append(candidates, r)
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if sortBy == HotspotSortByBurstiness && a.Burstiness != b.Burstiness {
+			return a.Burstiness > b.Burstiness
+		}
+		return a.Intensity > b.Intensity
+	})
+	if len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+	hotspots := make([]*Hotspot, len(candidates))
+	for i, r := range candidates {
+		hotspot := r.Hotspot
+		hotspots[i] = &hotspot
+	}
+	return total, hotspots
+}
+
+func classifyHotspot(keys []string, ranges []*hotspotRange, r *hotspotRange, labeler decorator.Labeler) HotspotClass {
+	sustained := r.ActiveRatio >= sustainedActiveRatio
+	j := r.index
+
+	// The range is the tail of a logical range if its end key is in the next logical range.
+	isTail := j == len(ranges)-1 || labeler.CrossBorder(keys[j], keys[j+1])
+	if sustained && isTail && r.written > r.read*writeDominantRatio {
+		return HotspotSequentialWriteTail
+	}
+
+	isolated := true
+	for _, n := range []int{j - 1, j + 1} {
+		if n >= 0 && n < len(ranges) && ranges[n].Intensity*isolatedRatio > r.Intensity {
+			isolated = false
+		}
+	}
+	if sustained && isolated {
+		return HotspotSingleRow
+	}
+	if !sustained && r.Burstiness >= burstRatio {
+		return HotspotBurst
+	}
+	return HotspotSustained
+}
+
+// @Summary Key Visual Hotspots
+// @Description Rank the key ranges in a given time range by sustained intensity or burstiness. Each key is labeled with the tables valid at the end of the latest time slice in which it has data.
+// @Param starttime query int false "The start of the time range (Unix)"
+// @Param endtime query int false "The end of the time range (Unix)"
+// @Param type query string false "Main types of data" Enums(written_bytes, read_bytes, written_keys, read_keys, integration)
+// @Param sort query string false "Sort by" Enums(intensity, burstiness)
+// @Param limit query int false "The number of hotspots, 10 by default"
+// @Success 200 {object} HotspotsResponse
+// @Router /keyvisual/hotspots [get]
+// @Security JwtAuth
+// @Failure 401 {object} utils.APIError "Unauthorized failure"
+func (s *Service) hotspots(c *gin.Context) {
+	endTime := time.Now()
+	startTime := endTime.Add(-360 * time.Minute)
+	startTime, endTime, ok := parseTimeRange(c, startTime, endTime)
+	if !ok {
+		return
+	}
+	sortBy := HotspotSortBy(c.DefaultQuery("sort", string(HotspotSortByIntensity)))
+	if sortBy != HotspotSortByIntensity && sortBy != HotspotSortByBurstiness {
+		c.JSON(http.StatusBadRequest, "bad request")
+		return
+	}
+	limit := defaultHotspotLimit
+	if limitString := c.Query("limit"); limitString != "" {
+		var err error
+		if limit, err = strconv.Atoi(limitString); err != nil || limit <= 0 {
+			c.JSON(http.StatusBadRequest, "bad request")
+			return
+		}
+		if limit > maxHotspotLimit {
+			limit = maxHotspotLimit
+		}
+	}
+	baseTag := region.IntoTag(c.Query("type"))
+
+	plane := s.stat.Range(startTime, endTime, "", "", baseTag)
+	strategy := s.strategyAt(endTime)
+	mx := plane.Pixel(strategy, hotspotsMaxDisplayY, region.GetDisplayTags(baseTag))
+	labelAtLatestData(s.strategy.LabelStrategy, &mx)
+	total, hotspots := analyzeHotspots(&mx, baseTag, strategy.NewLabeler(), sortBy, limit)
+	c.JSON(http.StatusOK, &HotspotsResponse{
+		StartTime: startTime.Unix(),
+		EndTime:   endTime.Unix(),
+		Type:      baseTag.String(),
+		Total:     total,
+		Hotspots:  hotspots,
+	})
+}
@@ -0,0 +1,122 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keyvisual
+
+import (
+	"testing"
+
+	. "github.com/pingcap/check"
+
+	"github.com/pingcap/tidb-dashboard/pkg/keyvisual/decorator"
+	"github.com/pingcap/tidb-dashboard/pkg/keyvisual/matrix"
+	"github.com/pingcap/tidb-dashboard/pkg/keyvisual/region"
+)
+
+func TestT(t *testing.T) {
+	TestingT(t)
+}
+
+var _ = Suite(&testHotspotSuite{})
+
+type testHotspotSuite struct{}
+
+// prefixLabeler treats the keys with the same first byte as a logical range.
+type prefixLabeler struct{}
+
+func (prefixLabeler) CrossBorder(startKey, endKey string) bool {
+	return startKey[:1] != endKey[:1]
+}
+
+func (prefixLabeler) Label(keys []string) []decorator.LabelKey {
+	return decorator.NaiveLabelStrategy().NewLabeler().Label(keys)
+}
+
+// transpose converts the values of each range into the values of each time step.
+func transpose(rangeValues [][]uint64) [][]uint64 {
+	data := make([][]uint64, len(rangeValues[0]))
+	for i := range data {
+		data[i] = make([]uint64, len(rangeValues))
+		for j := range rangeValues {
+			data[i][j] = rangeValues[j][i]
+		}
+	}
+	return data
+}
+
+func buildHotspotMatrix() *matrix.Matrix {
+	keys := []string{"a0", "a1", "a2", "a3", "b0", "b1", "c0"}
+	written := [][]uint64{{0, 0, 0, 0}, {0, 0, 0, 0}, {0, 0, 0, 0}, {90, 90, 90, 90}, {0, 0, 0, 0}, {1, 1, 1, 1}}
+	read := [][]uint64{{1, 1, 1, 1}, {80, 80, 80, 80}, {1, 1, 1, 1}, {10, 10, 10, 10}, {0, 0, 0, 200}, {1, 1, 1, 1}}
+	integration := make([][]uint64, len(written))
+	for j := range integration {
+		integration[j] = make([]uint64, len(written[j]))
+		for i := range integration[j] {
+			integration[j][i] = written[j][i] + read[j][i]
+		}
+	}
+	return &matrix.Matrix{
+		Keys:    keys,
+		KeyAxis: prefixLabeler{}.Label(keys),
+		DataMap: map[string][][]uint64{
+			region.Integration.String():  transpose(integration),
+			region.WrittenBytes.String(): transpose(written),
+			region.ReadBytes.String():    transpose(read),
+		},
+	}
+}
+
+func (t *testHotspotSuite) TestAnalyzeHotspots(c *C) {
+	mx := buildHotspotMatrix()
+	total, hotspots := analyzeHotspots(mx, region.Integration, prefixLabeler{}, HotspotSortByIntensity, defaultHotspotLimit)
+	c.Assert(total, Equals, uint64(936))
+	c.Assert(hotspots, HasLen, 3)
+
+	c.Assert(hotspots[0].StartKey, DeepEquals, mx.KeyAxis[3])
+	c.Assert(hotspots[0].EndKey, DeepEquals, mx.KeyAxis[4])
+	c.Assert(hotspots[0].Intensity, Equals, 100.0)
+	c.Assert(hotspots[0].Share, Equals, 400.0/936)
+	c.Assert(hotspots[0].ActiveRatio, Equals, 1.0)
+	c.Assert(hotspots[0].Class, Equals, HotspotSequentialWriteTail)
+
+	c.Assert(hotspots[1].StartKey, DeepEquals, mx.KeyAxis[1])
+	c.Assert(hotspots[1].Class, Equals, HotspotSingleRow)
+
+	c.Assert(hotspots[2].StartKey, DeepEquals, mx.KeyAxis[4])
+	c.Assert(hotspots[2].Peak, Equals, uint64(200))
+	c.Assert(hotspots[2].Burstiness, Equals, 4.0)
+	c.Assert(hotspots[2].ActiveRatio, Equals, 0.25)
+	c.Assert(hotspots[2].Class, Equals, HotspotBurst)
+}
+
+func (t *testHotspotSuite) TestSortByBurstiness(c *C) {
+	mx := buildHotspotMatrix()
+	_, hotspots := analyzeHotspots(mx, region.Integration, prefixLabeler{}, HotspotSortByBurstiness, 2)
+	c.Assert(hotspots, HasLen, 2)
+	c.Assert(hotspots[0].Class, Equals, HotspotBurst)
+	c.Assert(hotspots[1].Class, Equals, HotspotSequentialWriteTail)
+}
+
+func (t *testHotspotSuite) TestNoData(c *C) {
+	mx := buildHotspotMatrix()
+	for _, data := range mx.DataMap {
+		for _, values := range data {
+			for i := range values {
+				values[i] = 0
+			}
+		}
+	}
+	total, hotspots := analyzeHotspots(mx, region.Integration, prefixLabeler{}, HotspotSortByIntensity, defaultHotspotLimit)
+	c.Assert(total, Equals, uint64(0))
+	c.Assert(hotspots, HasLen, 0)
+}
@@ -43,6 +43,15 @@ type RegionInfo struct {
 	ApproximateKeys int64  `json:"approximate_keys"`
 }
 
+// regionValueGetters gets the value of each tag from the region info.
+var regionValueGetters = map[regionpkg.StatTag]func(region *RegionInfo) uint64{
+	regionpkg.Integration:  func(r *RegionInfo) uint64 { return r.WrittenBytes + r.ReadBytes },
+	regionpkg.WrittenBytes: func(r *RegionInfo) uint64 { return r.WrittenBytes },
+	regionpkg.ReadBytes:    func(r *RegionInfo) uint64 { return r.ReadBytes },
+	regionpkg.WrittenKeys:  func(r *RegionInfo) uint64 { return r.WrittenKeys },
+	regionpkg.ReadKeys:     func(r *RegionInfo) uint64 { return r.ReadKeys },
+}
+
 // RegionsInfo contains some regions with the detailed region info.
 type RegionsInfo struct {
 	Count   int           `json:"count"`
@@ -63,35 +72,41 @@ func (rs *RegionsInfo) GetKeys() []string {
 	return keys
 }
 
+func (rs *RegionsInfo) GetIDs() []uint64 {
+	ids := make([]uint64, rs.Count)
+	for i, region := range rs.Regions {
+		ids[i] = region.ID
+	}
+	return ids
+}
+
 func (rs *RegionsInfo) GetValues(tag regionpkg.StatTag) []uint64 {
-	values := make([]uint64, rs.Count)
-	switch tag {
-	case regionpkg.WrittenBytes:
-		for i, region := range rs.Regions {
-			values[i] = region.WrittenBytes
-		}
-	case regionpkg.ReadBytes:
-		for i, region := range rs.Regions {
-			values[i] = region.ReadBytes
-		}
-	case regionpkg.WrittenKeys:
-		for i, region := range rs.Regions {
-			values[i] = region.WrittenKeys
-		}
-	case regionpkg.ReadKeys:
-		for i, region := range rs.Regions {
-			values[i] = region.ReadKeys
-		}
-	case regionpkg.Integration:
-		for i, region := range rs.Regions {
-			values[i] = region.WrittenBytes + region.ReadBytes
-		}
-	default:
+	getValue, ok := regionValueGetters[tag]
+	if !ok {
 		panic("unreachable")
 	}
+	values := make([]uint64, rs.Count)
+	for i, region := range rs.Regions {
+		values[i] = getValue(region)
+	}
 	return values
 }
 
+// decodeRegionKeys decodes the hex encoded keys of the region.
+func decodeRegionKeys(region *RegionInfo) error {
+	startBytes, err := hex.DecodeString(region.StartKey)
+	if err != nil {
+		return ErrInvalidData.Wrap(err, "PD regions API unmarshal failed")
+	}
+	region.StartKey = regionpkg.String(startBytes)
+	endBytes, err := hex.DecodeString(region.EndKey)
+	if err != nil {
+		return ErrInvalidData.Wrap(err, "PD regions API unmarshal failed")
+	}
+	region.EndKey = regionpkg.String(endBytes)
+	return nil
+}
+
 func read(data []byte) (*RegionsInfo, error) {
 	regions := &RegionsInfo{}
 	if err := json.Unmarshal(data, regions); err != nil {
@@ -99,16 +114,9 @@ func read(data []byte) (*RegionsInfo, error) {
 	}
 
 	for _, region := range regions.Regions {
-		startBytes, err := hex.DecodeString(region.StartKey)
-		if err != nil {
-			return nil, ErrInvalidData.Wrap(err, "PD regions API unmarshal failed")
-		}
-		region.StartKey = regionpkg.String(startBytes)
-		endBytes, err := hex.DecodeString(region.EndKey)
-		if err != nil {
-			return nil, ErrInvalidData.Wrap(err, "PD regions API unmarshal failed")
+		if err := decodeRegionKeys(region); err != nil {
+			return nil, err
 		}
-		region.EndKey = regionpkg.String(endBytes)
 	}
 
 	sort.Slice(regions.Regions, func(i, j int) bool {
@@ -0,0 +1,145 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package input
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+
+	regionpkg "github.com/pingcap/tidb-dashboard/pkg/keyvisual/region"
+	"github.com/pingcap/tidb-dashboard/pkg/pd"
+)
+
+// scanFunc returns at most limit regions from the region containing the key, which is not hex encoded.
+type scanFunc func(key string, limit int) ([]*RegionInfo, error)
+
+// NewAPIPagedGetter scans the regions from PD page by page with the regions/key API. Each page is decoded from the
+// response stream, so that neither the whole response nor the unused fields of regions are kept in memory.
+func NewAPIPagedGetter(pdClient *pd.Client, limit int) regionpkg.RegionsInfoGenerator {
+	return newPagedGetter(func(key string, limit int) ([]*RegionInfo, error) {
+		resp, err := pdClient.Get(fmt.Sprintf("/regions/key?key=%s&limit=%d", url.QueryEscape(key), limit))
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Response.Body.Close()
+		return readStream(resp.Response.Body)
+	}, limit)
+}
+
+func newPagedGetter(scan scanFunc, limit int) regionpkg.RegionsInfoGenerator {
+	return func() (regionpkg.RegionsInfo, error) {
+		regions := &RegionsInfo{
+			Regions: make([]*RegionInfo, 0),
+		}
+		key := ""
+		pages := 0
+		for {
+			page, err := scan(key, limit)
+			if err != nil {
+				return nil, err
+			}
+			pages++
+			for _, region := range page {
+				// A region merged between pages overlaps the regions of the last page, which are outdated and
+				// replaced by it to keep the keys in order.
+				n := len(regions.Regions)
+				for n > 0 && (regions.Regions[n-1].EndKey == "" || regions.Regions[n-1].EndKey > region.StartKey) {
+					n--
+				}
+				regions.Regions = append(regions.Regions[:n], region)
+			}
+			if len(page) == 0 {
+				break
+			}
+			// The regions may be split or merged between pages, so the next page starts from the region containing
+			// the end key of the last region, which keeps the keys in order.
+			last := page[len(page)-1]
+			if last.EndKey == "" || last.EndKey <= key || len(page) < limit {
+				break
+			}
+			key = last.EndKey
+		}
+		regions.Count = len(regions.Regions)
+		log.Debug("Scanned regions from PD", zap.Int("count", regions.Count), zap.Int("pages", pages))
+		if regions.Count == 0 {
+			return nil, ErrInvalidData.New("PD regions API returns no region")
+		}
+		return regions, nil
+	}
+}
+
+// readStream decodes the regions in the response of PD regions API one by one.
+func readStream(r io.Reader) ([]*RegionInfo, error) {
+	dec := json.NewDecoder(r)
+	regions := make([]*RegionInfo, 0)
+	if err := expectDelim(dec, '{'); err != nil {
+		return nil, err
+	}
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return nil, ErrInvalidData.Wrap(err, "PD regions API unmarshal failed")
+		}
+		if t != "regions" {
+			var skipped json.RawMessage
+			if err := dec.Decode(&skipped); err != nil {
+				return nil, ErrInvalidData.Wrap(err, "PD regions API unmarshal failed")
+			}
+			continue
+		}
+		t, err = dec.Token()
+		if err != nil {
+			return nil, ErrInvalidData.Wrap(err, "PD regions API unmarshal failed")
+		}
+		if t == nil {
+			continue
+		}
+		if t != json.Delim('[') {
+			return nil, ErrInvalidData.New("PD regions API unmarshal failed, expect [ but got %v", t)
+		}
+		for dec.More() {
+			region := &RegionInfo{}
+			if err := dec.Decode(region); err != nil {
+				return nil, ErrInvalidData.Wrap(err, "PD regions API unmarshal failed")
+			}
+			if err := decodeRegionKeys(region); err != nil {
+				return nil, err
+			}
+			regions = append(regions, region)
+		}
+		if err := expectDelim(dec, ']'); err != nil {
+			return nil, err
+		}
+	}
+	if err := expectDelim(dec, '}'); err != nil {
+		return nil, err
+	}
+	return regions, nil
+}
+
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	t, err := dec.Token()
+	if err != nil {
+		return ErrInvalidData.Wrap(err, "PD regions API unmarshal failed")
+	}
+	if t != delim {
+		return ErrInvalidData.New("PD regions API unmarshal failed, expect %v but got %v", delim, t)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package input
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/pingcap/check"
+
+	regionpkg "github.com/pingcap/tidb-dashboard/pkg/keyvisual/region"
+)
+
+func TestT(t *testing.T) {
+	TestingT(t)
+}
+
+var _ = Suite(&testPagedSuite{})
+
+type testPagedSuite struct{}
+
+func (t *testPagedSuite) TestReadStream(c *C) {
+	data := `{"count":2,"regions":[
+		{"id":1,"start_key":"","end_key":"6161","written_bytes":10,"leader":{"id":2,"store_id":1},"peers":[]},
+		{"id":3,"start_key":"6161","end_key":"","read_bytes":20}
+	]}`
+	regions, err := readStream(strings.NewReader(data))
+	c.Assert(err, IsNil)
+	c.Assert(regions, HasLen, 2)
+	c.Assert(regions[0].EndKey, Equals, "aa")
+	c.Assert(regions[0].WrittenBytes, Equals, uint64(10))
+	c.Assert(regions[1].StartKey, Equals, "aa")
+	c.Assert(regions[1].ReadBytes, Equals, uint64(20))
+
+	regions, err = readStream(strings.NewReader(`{"count":0,"regions":null}`))
+	c.Assert(err, IsNil)
+	c.Assert(regions, HasLen, 0)
+
+	_, err = readStream(strings.NewReader(`{"regions":[{"start_key":"xx"}]}`))
+	c.Assert(err, NotNil)
+	_, err = readStream(strings.NewReader(`[]`))
+	c.Assert(err, NotNil)
+}
+
+func (t *testPagedSuite) TestPagedGetter(c *C) {
+	allKeys := []string{"", "a", "b", "c", "d", "e", ""}
+	var scannedKeys []string
+	getter := newPagedGetter(func(key string, limit int) ([]*RegionInfo, error) {
+		scannedKeys = append(scannedKeys, key)
+		page := make([]*RegionInfo, 0)
+		for i := 0; i < len(allKeys)-1 && len(page) < limit; i++ {
+			if allKeys[i+1] != "" && allKeys[i+1] <= key {
+				continue
+			}
+			page = append(page, &RegionInfo{StartKey: allKeys[i], EndKey: allKeys[i+1], WrittenBytes: uint64(i)})
+		}
+		return page, nil
+	}, 2)
+
+	regions, err := getter()
+	c.Assert(err, IsNil)
+	c.Assert(scannedKeys, DeepEquals, []string{"", "b", "d"})
+	c.Assert(regions.Len(), Equals, 6)
+	c.Assert(regions.GetKeys(), DeepEquals, allKeys)
+	c.Assert(regions.GetValues(regionpkg.WrittenBytes), DeepEquals, []uint64{0, 1, 2, 3, 4, 5})
+}
+
+func (t *testPagedSuite) TestPagedGetterOverlapped(c *C) {
+	// The regions [b, c) and [c, d) are merged into [b, d) after the first page is scanned, and the regions [e, f)
+	// and [f, ) are merged after the second page is scanned.
+	pages := map[string][]*RegionInfo{
+		"": {
+			{ID: 1, StartKey: "", EndKey: "a"},
+			{ID: 2, StartKey: "a", EndKey: "b"},
+			{ID: 3, StartKey: "b", EndKey: "c"},
+		},
+		"c": {
+			{ID: 3, StartKey: "b", EndKey: "d"},
+			{ID: 5, StartKey: "d", EndKey: "e"},
+			{ID: 6, StartKey: "e", EndKey: "f"},
+		},
+		"f": {
+			{ID: 6, StartKey: "e", EndKey: ""},
+		},
+	}
+	getter := newPagedGetter(func(key string, limit int) ([]*RegionInfo, error) {
+		return pages[key], nil
+	}, 3)
+
+	regions, err := getter()
+	c.Assert(err, IsNil)
+	c.Assert(regions.(*RegionsInfo).GetIDs(), DeepEquals, []uint64{1, 2, 3, 5, 6})
+	c.Assert(regions.GetKeys(), DeepEquals, []string{"", "a", "b", "d", "e", ""})
+}
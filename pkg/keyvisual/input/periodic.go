@@ -24,6 +24,9 @@ import (
 	"github.com/pingcap/tidb-dashboard/pkg/keyvisual/storage"
 )
 
+// The regions are collected every minute, so a collection is slow if it takes a considerable part of the interval.
+const slowCollectionDuration = 20 * time.Second
+
 type periodicInput struct {
 	PeriodicGetter region.RegionsInfoGenerator
 }
@@ -46,12 +49,18 @@ func (input *periodicInput) Background(ctx context.Context, stat *storage.Stat)
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
+			startTime := time.Now()
 			regions, err := input.PeriodicGetter()
 			if err != nil {
 				log.Warn("can not get RegionsInfo", zap.Error(err))
 				continue
 			}
 			endTime := time.Now()
+			if duration := endTime.Sub(startTime); duration > slowCollectionDuration {
+				log.Warn("collecting RegionsInfo is slow", zap.Int("regions", regions.Len()), zap.Duration("duration", duration))
+			} else {
+				log.Debug("RegionsInfo collected", zap.Int("regions", regions.Len()), zap.Duration("duration", duration))
+			}
 			stat.Append(regions, endTime)
 		}
 	}
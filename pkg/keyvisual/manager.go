@@ -16,6 +16,7 @@ package keyvisual
 import (
 	"context"
 	"net/http"
+	"reflect"
 	"sync"
 
 	"github.com/gin-gonic/gin"
@@ -64,7 +65,13 @@ func (s *Service) managerLoop(ctx context.Context) {
 
 func (s *Service) resetKeyVisualConfig(ctx context.Context, cfg *config.DynamicConfig) {
 	if !cfg.KeyVisual.AutoCollectionDisabled {
-		if s.keyVisualCfg != nil && s.keyVisualCfg.Policy != cfg.KeyVisual.Policy {
+		// The service is restarted to apply the new policy, layers, regions source or region index persistence, and
+		// the persisted axes are reloaded.
+		if s.keyVisualCfg != nil && (s.keyVisualCfg.Policy != cfg.KeyVisual.Policy ||
+			!reflect.DeepEqual(s.keyVisualCfg.Layers, cfg.KeyVisual.Layers) ||
+			s.keyVisualCfg.RegionsSource != cfg.KeyVisual.RegionsSource ||
+			s.keyVisualCfg.RegionsPageLimit != cfg.KeyVisual.RegionsPageLimit ||
+			s.keyVisualCfg.RegionIndexPersisted != cfg.KeyVisual.RegionIndexPersisted) {
 			s.stopService()
 		}
 		s.reloadKeyVisualConfig(&cfg.KeyVisual)
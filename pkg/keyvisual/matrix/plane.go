@@ -104,6 +104,38 @@ func (plane *Plane) Pixel(strategy *Strategy, target int, displayTags []string)
 	return matrix
 }
 
+// PixelPlanes pixelates the planes into matrices sharing the same keys, so that the planes can be compared.
+func PixelPlanes(strategy *Strategy, target int, displayTags []string, planes ...Plane) []Matrix {
+	merged := Plane{
+		Times: []time.Time{planes[0].Times[0]},
+	}
+	for _, plane := range planes {
+		merged.Times = append(merged.Times, plane.Times[1:]...)
+		merged.Axes = append(merged.Axes, plane.Axes...)
+	}
+	mergedMatrix := merged.Pixel(strategy, target, displayTags)
+
+	matrices := make([]Matrix, len(planes))
+	offset := 0
+	for i, plane := range planes {
+		mx := Matrix{
+			Keys:     mergedMatrix.Keys,
+			DataMap:  make(map[string][][]uint64, len(mergedMatrix.DataMap)),
+			KeyAxis:  mergedMatrix.KeyAxis,
+			TimeAxis: make([]int64, len(plane.Times)),
+		}
+		for j, t := range plane.Times {
+			mx.TimeAxis[j] = t.Unix()
+		}
+		for tag, data := range mergedMatrix.DataMap {
+			mx.DataMap[tag] = data[offset : offset+len(plane.Axes)]
+		}
+		offset += len(plane.Axes)
+		matrices[i] = mx
+	}
+	return matrices
+}
+
 func compact(strategy SplitStrategy, chunks []chunk) (compactChunk chunk, splitter Splitter) {
 	// get compact chunk keys
 	keySet := make(map[string]struct{})
@@ -14,9 +14,48 @@
 package matrix
 
 import (
+	"time"
+
 	. "github.com/pingcap/check"
+
+	"github.com/pingcap/tidb-dashboard/pkg/keyvisual/decorator"
 )
 
 var _ = Suite(&testPlaneSuite{})
 
 type testPlaneSuite struct{}
+
+func (t *testPlaneSuite) TestPixelPlanes(c *C) {
+	var keyMap KeyMap
+	startTime := time.Unix(1600000000, 0)
+	createAxis := func(keys []string, values []uint64) Axis {
+		keyMap.SaveKeys(keys)
+		return CreateAxis(keys, [][]uint64{values})
+	}
+	planeA := CreatePlane(
+		[]time.Time{startTime, startTime.Add(time.Minute), startTime.Add(2 * time.Minute)},
+		[]Axis{
+			createAxis([]string{"", "b", ""}, []uint64{1, 2}),
+			createAxis([]string{"", "b", ""}, []uint64{3, 4}),
+		},
+	)
+	planeB := CreatePlane(
+		[]time.Time{startTime.Add(time.Hour), startTime.Add(time.Hour + time.Minute)},
+		[]Axis{
+			createAxis([]string{"", "a", "c", ""}, []uint64{5, 6, 7}),
+		},
+	)
+	strategy := &Strategy{
+		LabelStrategy: decorator.NaiveLabelStrategy(),
+		SplitStrategy: AverageSplitStrategy(),
+	}
+	matrices := PixelPlanes(strategy, 10, []string{"tag"}, planeA, planeB)
+	c.Assert(matrices, HasLen, 2)
+	c.Assert(matrices[0].Keys, DeepEquals, []string{"", "a", "b", "c", ""})
+	c.Assert(matrices[1].Keys, DeepEquals, matrices[0].Keys)
+	c.Assert(matrices[0].TimeAxis, DeepEquals, []int64{1600000000, 1600000060, 1600000120})
+	c.Assert(matrices[1].TimeAxis, DeepEquals, []int64{1600003600, 1600003660})
+	c.Assert(matrices[0].DataMap["tag"], HasLen, 2)
+	c.Assert(matrices[1].DataMap["tag"], HasLen, 1)
+	c.Assert(matrices[1].DataMap["tag"][0], DeepEquals, []uint64{5, 3, 3, 7})
+}
@@ -0,0 +1,250 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keyvisual
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/utils"
+	"github.com/pingcap/tidb-dashboard/pkg/keyvisual/decorator"
+	"github.com/pingcap/tidb-dashboard/pkg/keyvisual/matrix"
+	"github.com/pingcap/tidb-dashboard/pkg/keyvisual/storage"
+)
+
+const (
+	// The oldest offline session is dropped when there are too many, since they are kept in memory.
+	maxOfflineSessions = 8
+	maxSnapshotSize    = 256 * 1024 * 1024
+)
+
+var (
+	ErrOfflineSessionNotFound = ErrNS.NewType("offline_session_not_found")
+)
+
+type OfflineSession struct {
+	ID        string `json:"id"`
+	StartTime int64  `json:"start_time"` // unix second
+	EndTime   int64  `json:"end_time"`   // unix second
+	CreatedAt int64  `json:"created_at"` // unix second
+}
+
+type offlineSession struct {
+	OfflineSession
+	stat     *storage.OfflineStat
+	strategy *matrix.Strategy
+}
+
+// offlineSessions keeps the snapshots imported into read-only key visual sessions.
+type offlineSessions struct {
+	mu       sync.Mutex
+	sessions []*offlineSession // ordered by the creation
+}
+
+func newOfflineSessions() *offlineSessions {
+	return &offlineSessions{}
+}
+
+func newOfflineSessionID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func (o *offlineSessions) add(stat *storage.OfflineStat) (*offlineSession, error) {
+	id, err := newOfflineSessionID()
+	if err != nil {
+		return nil, err
+	}
+	startTime, endTime := stat.TimeRange()
+	session := &offlineSession{
+		OfflineSession: OfflineSession{
+			ID:        id,
+			StartTime: startTime.Unix(),
+			EndTime:   endTime.Unix(),
+			CreatedAt: time.Now().Unix(),
+		},
+		stat: stat,
+		strategy: &matrix.Strategy{
+			LabelStrategy: decorator.StaticLabelStrategy(stat.Labels),
+			SplitStrategy: matrix.AverageSplitStrategy(),
+		},
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if len(o.sessions) >= maxOfflineSessions {
+		log.Info("Drop the oldest key visual offline session", zap.String("id", o.sessions[0].ID))
+		o.sessions = o.sessions[1:]
+	}
+	o.sessions = append(o.sessions, session)
+	return session, nil
+}
+
+func (o *offlineSessions) get(id string) *offlineSession {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, session := range o.sessions {
+		if session.ID == id {
+			return session
+		}
+	}
+	return nil
+}
+
+func (o *offlineSessions) remove(id string) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for i, session := range o.sessions {
+		if session.ID == id {
+			o.sessions = append(o.sessions[:i:i], o.sessions[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (o *offlineSessions) list() []OfflineSession {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	result := make([]OfflineSession, 0, len(o.sessions))
+	for _, session := range o.sessions {
+		result = append(result, session.OfflineSession)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].CreatedAt > result[j].CreatedAt
+	})
+	return result
+}
+
+// @Summary Export Key Visual Snapshot
+// @Description Export the heatmap data in a given time range as a compressed archive, which can be imported as an offline session
+// @Param starttime query int false "The start of the time range (Unix)"
+// @Param endtime query int false "The end of the time range (Unix)"
+// @Produce application/octet-stream
+// @Success 200 {string} string
+// @Router /keyvisual/snapshot [get]
+// @Security JwtAuth
+// @Failure 400 {object} utils.APIError
+// @Failure 401 {object} utils.APIError "Unauthorized failure"
+func (s *Service) exportSnapshot(c *gin.Context) {
+	endTime := time.Now()
+	startTime := endTime.Add(-360 * time.Minute)
+	startTime, endTime, ok := parseTimeRange(c, startTime, endTime)
+	if !ok {
+		return
+	}
+
+	snapshot := s.stat.Export(startTime, endTime, decorator.LabelStrategyAt(s.labelStrategy, endTime).NewLabeler())
+	if len(snapshot.Axes) == 0 {
+		utils.MakeInvalidRequestErrorFromError(c, fmt.Errorf("no data in the time range"))
+		return
+	}
+
+	filename := fmt.Sprintf("keyviz-%d-%d.snapshot", snapshot.Times[0].Unix(), snapshot.Times[len(snapshot.Times)-1].Unix())
+	c.Writer.Header().Set("Content-Type", "application/octet-stream")
+	c.Writer.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Status(http.StatusOK)
+	if err := storage.WriteSnapshot(c.Writer, snapshot); err != nil {
+		log.Warn("Failed to write key visual snapshot", zap.Error(err))
+	}
+}
+
+// @Summary Import Key Visual Snapshot
+// @Description Load a snapshot exported by /keyvisual/snapshot into a read-only offline session
+// @Accept application/octet-stream
+// @Param request body string true "The snapshot archive"
+// @Success 200 {object} OfflineSession
+// @Router /keyvisual/offline [post]
+// @Security JwtAuth
+// @Failure 400 {object} utils.APIError
+// @Failure 401 {object} utils.APIError "Unauthorized failure"
+// @Failure 500 {object} utils.APIError
+func (s *Service) importSnapshot(c *gin.Context) {
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, maxSnapshotSize)
+	snapshot, err := storage.ReadSnapshot(body)
+	if err != nil {
+		utils.MakeInvalidRequestErrorFromError(c, err)
+		return
+	}
+	session, err := s.offline.add(storage.NewOfflineStat(snapshot))
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	c.JSON(http.StatusOK, session.OfflineSession)
+}
+
+// @Summary List Key Visual Offline Sessions
+// @Success 200 {array} OfflineSession
+// @Router /keyvisual/offline [get]
+// @Security JwtAuth
+// @Failure 401 {object} utils.APIError "Unauthorized failure"
+func (s *Service) getOfflineSessions(c *gin.Context) {
+	c.JSON(http.StatusOK, s.offline.list())
+}
+
+// @Summary Key Visual Offline Heatmaps
+// @Description Heatmaps of an offline session, the whole time range of the session is used by default
+// @Param id path string true "offline session id"
+// @Param startkey query string false "The start of the key range"
+// @Param endkey query string false "The end of the key range"
+// @Param starttime query int false "The start of the time range (Unix)"
+// @Param endtime query int false "The end of the time range (Unix)"
+// @Param type query string false "Main types of data" Enums(written_bytes, read_bytes, written_keys, read_keys, integration)
+// @Success 200 {object} matrix.Matrix
+// @Router /keyvisual/offline/{id}/heatmaps [get]
+// @Security JwtAuth
+// @Failure 401 {object} utils.APIError "Unauthorized failure"
+// @Failure 404 {object} utils.APIError
+func (s *Service) offlineHeatmaps(c *gin.Context) {
+	session := s.offline.get(c.Param("id"))
+	if session == nil {
+		_ = c.AbortWithError(http.StatusNotFound, ErrOfflineSessionNotFound.New("offline session %s not found", c.Param("id")))
+		return
+	}
+	startTime, endTime := session.stat.TimeRange()
+	q, ok := parseHeatmapsQuery(c, startTime, endTime)
+	if !ok {
+		return
+	}
+	plane := session.stat.Range(q.startTime, q.endTime, q.startKey, q.endKey, q.baseTag)
+	c.JSON(http.StatusOK, q.pixel(plane, session.strategy))
+}
+
+// @Summary Delete Key Visual Offline Session
+// @Param id path string true "offline session id"
+// @Success 200 {object} utils.APIEmptyResponse
+// @Router /keyvisual/offline/{id} [delete]
+// @Security JwtAuth
+// @Failure 401 {object} utils.APIError "Unauthorized failure"
+// @Failure 404 {object} utils.APIError
+func (s *Service) deleteOfflineSession(c *gin.Context) {
+	if !s.offline.remove(c.Param("id")) {
+		_ = c.AbortWithError(http.StatusNotFound, ErrOfflineSessionNotFound.New("offline session %s not found", c.Param("id")))
+		return
+	}
+	c.JSON(http.StatusOK, utils.APIEmptyResponse{})
+}
@@ -19,6 +19,12 @@ type RegionsInfo interface {
 	GetValues(tag StatTag) []uint64
 }
 
+// RegionIDsGetter is implemented by the RegionsInfo which knows the id of each region.
+type RegionIDsGetter interface {
+	// GetIDs returns the region ids in the same order as the keys.
+	GetIDs() []uint64
+}
+
 type RegionsInfoGenerator func() (RegionsInfo, error)
 
 type DataProvider struct {
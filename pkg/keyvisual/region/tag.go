@@ -29,44 +29,39 @@ const (
 	ReadKeys
 )
 
+// New tags must be appended to the end, since the persisted axes are in the order of StorageTags. A tag is only
+// added when PD reports it for each region in the regions API, which has the flow of bytes and keys but no query
+// counts, no leader and follower split, and no CPU or lock contention.
+var tagNames = []string{
+	Integration:  "integration",
+	WrittenBytes: "written_bytes",
+	ReadBytes:    "read_bytes",
+	WrittenKeys:  "written_keys",
+	ReadKeys:     "read_keys",
+}
+
 // IntoTag converts a string into a StatTag.
 func IntoTag(typ string) StatTag {
-	switch typ {
-	case "":
-		return Integration
-	case "integration":
+	if typ == "" {
 		return Integration
-	case "written_bytes":
-		return WrittenBytes
-	case "read_bytes":
-		return ReadBytes
-	case "written_keys":
-		return WrittenKeys
-	case "read_keys":
-		return ReadKeys
-	default:
-		return WrittenBytes
 	}
+	for tag, name := range tagNames {
+		if name == typ {
+			return StatTag(tag)
+		}
+	}
+	return WrittenBytes
 }
 
 func (tag StatTag) String() string {
-	switch tag {
-	case Integration:
-		return "integration"
-	case WrittenBytes:
-		return "written_bytes"
-	case ReadBytes:
-		return "read_bytes"
-	case WrittenKeys:
-		return "written_keys"
-	case ReadKeys:
-		return "read_keys"
-	default:
+	if tag < 0 || int(tag) >= len(tagNames) {
 		panic("unreachable")
 	}
+	return tagNames[tag]
 }
 
-// StorageTags is the order of tags during storage.
+// StorageTags is the order of tags during storage. The first two must be WrittenBytes and ReadBytes, which make up
+// the Integration.
 var StorageTags = []StatTag{WrittenBytes, ReadBytes, WrittenKeys, ReadKeys}
 
 // ResponseTags is the order of tags when responding.
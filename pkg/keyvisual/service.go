@@ -84,6 +84,8 @@ type Service struct {
 	stat          *storage.Stat
 	strategy      *matrix.Strategy
 	labelStrategy decorator.LabelStrategy
+
+	offline *offlineSessions
 }
 
 // FIXME: Simplify these things
@@ -106,6 +108,7 @@ func NewService(
 		pdClient:       pdClient,
 		db:             db,
 		tidbClient:     tidbClient,
+		offline:        newOfflineSessions(),
 	}
 
 	lc.Append(s.managerHook())
@@ -120,8 +123,19 @@ func RegisterRouter(r *gin.RouterGroup, auth *user.AuthService, s *Service) {
 	endpoint.GET("/config", s.getDynamicConfig)
 	endpoint.PUT("/config", s.setDynamicConfig)
 
+	// Offline sessions do not depend on the running service.
+	endpoint.GET("/offline", s.getOfflineSessions)
+	endpoint.POST("/offline", s.importSnapshot)
+	endpoint.GET("/offline/:id/heatmaps", s.offlineHeatmaps)
+	endpoint.DELETE("/offline/:id", s.deleteOfflineSession)
+
 	endpoint.Use(s.status.MWHandleStopped(stoppedHandler))
 	endpoint.GET("/heatmaps", s.heatmaps)
+	endpoint.GET("/heatmaps/diff", s.diffHeatmaps)
+	endpoint.GET("/hotspots", s.hotspots)
+	endpoint.GET("/cell", s.cell)
+	endpoint.GET("/tables", s.tableSeries)
+	endpoint.GET("/snapshot", s.exportSnapshot)
 }
 
 func (s *Service) IsRunning() bool {
@@ -140,6 +154,7 @@ func (s *Service) Start(ctx context.Context) error {
 		fx.Provide(
 			newWaitGroup,
 			newStrategy,
+			s.newStatConfig,
 			newStat,
 			s.provideLocals,
 			s.newProvider,
@@ -166,26 +181,52 @@ func (s *Service) newLabelStrategy(
 	wg *sync.WaitGroup,
 	etcdClient *clientv3.Client,
 	tidbClient *tidb.Client,
+	db *dbstore.DB,
 ) decorator.LabelStrategy {
 	switch s.keyVisualCfg.Policy {
 	case config.KeyVisualDBPolicy:
 		log.Debug("New LabelStrategy", zap.String("policy", s.keyVisualCfg.Policy))
-		return decorator.TiDBLabelStrategy(lc, wg, etcdClient, tidbClient)
+		return decorator.TiDBLabelStrategy(lc, wg, etcdClient, tidbClient, db)
 	case config.KeyVisualKVPolicy:
 		log.Debug("New LabelStrategy", zap.String("policy", s.keyVisualCfg.Policy),
 			zap.String("separator", s.keyVisualCfg.PolicyKVSeparator))
 		return decorator.SeparatorLabelStrategy(s.keyVisualCfg)
+	case config.KeyVisualRulesPolicy:
+		log.Debug("New LabelStrategy", zap.String("policy", s.keyVisualCfg.Policy),
+			zap.Int("rules", len(s.keyVisualCfg.PolicyLabelRules)))
+		return decorator.RulesLabelStrategy(s.keyVisualCfg)
 	default:
 		panic("unreachable")
 	}
 }
 
+func (s *Service) newStatConfig() storage.StatConfig {
+	cfg := defaultStatConfig
+	if len(s.keyVisualCfg.Layers) != 0 {
+		cfg.LayersConfig = make([]storage.LayerConfig, len(s.keyVisualCfg.Layers))
+		for i, layer := range s.keyVisualCfg.Layers {
+			cfg.LayersConfig[i] = storage.LayerConfig{Len: layer.Len, Ratio: layer.Ratio}
+		}
+	}
+	cfg.PersistRegionIndex = s.keyVisualCfg.RegionIndexPersisted
+	return cfg
+}
+
 func (s *Service) newProvider(pdClient *pd.Client) *region.DataProvider {
 	if s.customProvider != nil {
 		return s.customProvider
 	}
+	getter := input.NewAPIPeriodicGetter(pdClient)
+	if s.keyVisualCfg.RegionsSource == config.KeyVisualRegionsSourcePaged {
+		limit := s.keyVisualCfg.RegionsPageLimit
+		if limit == 0 {
+			limit = config.DefaultKeyVisualRegionsPageLimit
+		}
+		log.Debug("New paged regions getter", zap.Int("limit", limit))
+		getter = input.NewAPIPagedGetter(pdClient, limit)
+	}
 	return &region.DataProvider{
-		PeriodicGetter: input.NewAPIPeriodicGetter(pdClient),
+		PeriodicGetter: getter,
 	}
 }
 
@@ -228,7 +269,7 @@ func (s *Service) Stop(ctx context.Context) error {
 }
 
 // @Summary Key Visual Heatmaps
-// @Description Heatmaps in a given range to visualize TiKV usage
+// @Description Heatmaps in a given range to visualize TiKV usage. Each key is labeled with the tables valid at the end of the latest time slice in which it has data, or at the end of the time range if it has no data.
 // @Param startkey query string false "The start of the key range"
 // @Param endkey query string false "The end of the key range"
 // @Param starttime query int false "The start of the time range (Unix)"
@@ -239,20 +280,42 @@ func (s *Service) Stop(ctx context.Context) error {
 // @Security JwtAuth
 // @Failure 401 {object} utils.APIError "Unauthorized failure"
 func (s *Service) heatmaps(c *gin.Context) {
-	startKey := c.Query("startkey")
-	endKey := c.Query("endkey")
-	startTimeString := c.Query("starttime")
-	endTimeString := c.Query("endtime")
-	typ := c.Query("type")
-
 	endTime := time.Now()
 	startTime := endTime.Add(-360 * time.Minute)
+	q, ok := parseHeatmapsQuery(c, startTime, endTime)
+	if !ok {
+		return
+	}
+	plane := s.stat.Range(q.startTime, q.endTime, q.startKey, q.endKey, q.baseTag)
+	resp := q.pixel(plane, s.strategyAt(q.endTime))
+	labelAtLatestData(s.strategy.LabelStrategy, &resp)
+	c.JSON(http.StatusOK, resp)
+}
+
+type heatmapsQuery struct {
+	startTime time.Time
+	endTime   time.Time
+	startKey  string
+	endKey    string
+	typ       string
+	baseTag   region.StatTag
+}
+
+// parseTimeRange parses the time range in the query, and responds bad request if it is invalid.
+func parseTimeRange(c *gin.Context, startTime, endTime time.Time) (time.Time, time.Time, bool) {
+	return parseTimeRangeOf(c, "starttime", "endtime", startTime, endTime)
+}
+
+// parseTimeRangeOf parses the time range in the query parameters with the given names.
+func parseTimeRangeOf(c *gin.Context, startParam, endParam string, startTime, endTime time.Time) (time.Time, time.Time, bool) {
+	startTimeString := c.Query(startParam)
+	endTimeString := c.Query(endParam)
 	if startTimeString != "" {
 		tsSec, err := strconv.ParseInt(startTimeString, 10, 64)
 		if err != nil {
 			log.Error("parse ts failed", zap.Error(err))
 			c.JSON(http.StatusBadRequest, "bad request")
-			return
+			return startTime, endTime, false
 		}
 		startTime = time.Unix(tsSec, 0)
 	}
@@ -261,13 +324,31 @@ func (s *Service) heatmaps(c *gin.Context) {
 		if err != nil {
 			log.Error("parse ts failed", zap.Error(err))
 			c.JSON(http.StatusBadRequest, "bad request")
-			return
+			return startTime, endTime, false
 		}
 		endTime = time.Unix(tsSec, 0)
 	}
-	if !(startTime.Before(endTime) && (endKey == "" || startKey < endKey)) {
+	if !startTime.Before(endTime) {
 		c.JSON(http.StatusBadRequest, "bad request")
-		return
+		return startTime, endTime, false
+	}
+	return startTime, endTime, true
+}
+
+// parseHeatmapsQuery parses the query of heatmaps, and responds bad request if it is invalid.
+// The time range is the given one if not specified.
+func parseHeatmapsQuery(c *gin.Context, startTime, endTime time.Time) (*heatmapsQuery, bool) {
+	startKey := c.Query("startkey")
+	endKey := c.Query("endkey")
+	typ := c.Query("type")
+
+	startTime, endTime, ok := parseTimeRange(c, startTime, endTime)
+	if !ok {
+		return nil, false
+	}
+	if !(endKey == "" || startKey < endKey) {
+		c.JSON(http.StatusBadRequest, "bad request")
+		return nil, false
 	}
 
 	log.Debug("Request matrix",
@@ -282,24 +363,34 @@ func (s *Service) heatmaps(c *gin.Context) {
 		startKey = string(startKeyBytes)
 	} else {
 		c.JSON(http.StatusBadRequest, "bad request")
-		return
+		return nil, false
 	}
 	if endKeyBytes, err := hex.DecodeString(endKey); err == nil {
 		endKey = string(endKeyBytes)
 	} else {
 		c.JSON(http.StatusBadRequest, "bad request")
-		return
+		return nil, false
 	}
-	baseTag := region.IntoTag(typ)
-	plane := s.stat.Range(startTime, endTime, startKey, endKey, baseTag)
-	resp := plane.Pixel(s.strategy, heatmapsMaxDisplayY, region.GetDisplayTags(baseTag))
-	resp.Range(startKey, endKey)
+	return &heatmapsQuery{
+		startTime: startTime,
+		endTime:   endTime,
+		startKey:  startKey,
+		endKey:    endKey,
+		typ:       typ,
+		baseTag:   region.IntoTag(typ),
+	}, true
+}
+
+// pixel converts the plane to the heatmaps in response.
+func (q *heatmapsQuery) pixel(plane matrix.Plane, strategy *matrix.Strategy) matrix.Matrix {
+	resp := plane.Pixel(strategy, heatmapsMaxDisplayY, region.GetDisplayTags(q.baseTag))
+	resp.Range(q.startKey, q.endKey)
 	// TODO: An expedient to reduce data transmission, which needs to be deleted later.
 	resp.DataMap = map[string][][]uint64{
-		typ: resp.DataMap[typ],
+		q.typ: resp.DataMap[q.typ],
 	}
 	// ----------
-	c.JSON(http.StatusOK, resp)
+	return resp
 }
 
 func (s *Service) provideLocals() (*config.Config, *clientv3.Client, *pd.Client, *dbstore.DB, *tidb.Client) {
@@ -317,6 +408,68 @@ func newWaitGroup(lc fx.Lifecycle) *sync.WaitGroup {
 	return wg
 }
 
+// strategyAt returns the strategy which labels keys with the labels valid at the time, so that the data of dropped
+// or renamed tables is labeled as it was. The axes of a matrix share the keys, so the keys with data are labeled
+// again by labelAtLatestData.
+func (s *Service) strategyAt(t time.Time) *matrix.Strategy {
+	return &matrix.Strategy{
+		LabelStrategy: decorator.LabelStrategyAt(s.strategy.LabelStrategy, t),
+		SplitStrategy: s.strategy.SplitStrategy,
+	}
+}
+
+// labelAtLatestData labels each key of the matrices, which share the same keys, with the labels valid at the end of
+// the latest axis in which the key has data, i.e. the range starting at the key, or ending at it for the last key.
+// The keys without data keep their labels, and so do the start and the end of the key space.
+func labelAtLatestData(strategy decorator.LabelStrategy, matrices ...*matrix.Matrix) {
+	keys := matrices[0].Keys
+	latest := make([]int64, len(keys))
+	mark := func(k int, t int64) {
+		if t > latest[k] {
+			latest[k] = t
+		}
+	}
+	for _, mx := range matrices {
+		for _, data := range mx.DataMap {
+			for i, values := range data {
+				for j, value := range values {
+					if value == 0 {
+						continue
+					}
+					mark(j, mx.TimeAxis[i+1])
+					if j == len(values)-1 {
+						mark(j+1, mx.TimeAxis[i+1])
+					}
+				}
+			}
+		}
+	}
+
+	keysAt := make(map[int64][]int)
+	for k, t := range latest {
+		if t != 0 && keys[k] != "" {
+			keysAt[t] = append(keysAt[t], k)
+		}
+	}
+	if len(keysAt) == 0 {
+		return
+	}
+	keyAxis := append([]decorator.LabelKey(nil), matrices[0].KeyAxis...)
+	for t, indices := range keysAt {
+		atKeys := make([]string, len(indices))
+		for i, k := range indices {
+			atKeys[i] = keys[k]
+		}
+		labelKeys := decorator.LabelStrategyAt(strategy, time.Unix(t, 0)).NewLabeler().Label(atKeys)
+		for i, k := range indices {
+			keyAxis[k] = labelKeys[i]
+		}
+	}
+	for _, mx := range matrices {
+		mx.KeyAxis = keyAxis
+	}
+}
+
 func newStrategy(lc fx.Lifecycle, wg *sync.WaitGroup, labelStrategy decorator.LabelStrategy) *matrix.Strategy {
 	return &matrix.Strategy{
 		LabelStrategy: labelStrategy,
@@ -336,8 +489,9 @@ func newStat(
 	db *dbstore.DB,
 	in input.StatInput,
 	strategy *matrix.Strategy,
+	cfg storage.StatConfig,
 ) *storage.Stat {
-	stat := storage.NewStat(lc, wg, db, defaultStatConfig, strategy, in.GetStartTime())
+	stat := storage.NewStat(lc, wg, db, cfg, strategy, in.GetStartTime())
 
 	lc.Append(fx.Hook{
 		OnStart: func(ctx context.Context) error {
@@ -18,6 +18,8 @@ import (
 	"encoding/gob"
 	"time"
 
+	"gorm.io/gorm"
+
 	"github.com/pingcap/tidb-dashboard/pkg/dbstore"
 	"github.com/pingcap/tidb-dashboard/pkg/keyvisual/matrix"
 )
@@ -52,8 +54,11 @@ func (a *AxisModel) UnmarshalAxis() (matrix.Axis, error) {
 	var buf = bytes.NewBuffer(a.Axis)
 	dec := gob.NewDecoder(buf)
 	var axis matrix.Axis
-	err := dec.Decode(&axis)
-	return axis, err
+	if err := dec.Decode(&axis); err != nil {
+		return axis, err
+	}
+	fitStorageAxis(&axis)
+	return axis, nil
 }
 
 func (a *AxisModel) Insert(db *dbstore.DB) error {
@@ -77,7 +82,7 @@ func CreateTableAxisModelIfNotExists(db *dbstore.DB) (bool, error) {
 }
 
 func ClearTableAxisModel(db *dbstore.DB) error {
-	return db.Delete(&AxisModel{}).Error
+	return db.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&AxisModel{}).Error
 }
 
 func FindAxisModelsOrderByTime(db *dbstore.DB, layerNum uint8) ([]*AxisModel, error) {
@@ -24,12 +24,20 @@ import (
 
 	"github.com/pingcap/tidb-dashboard/pkg/dbstore"
 	"github.com/pingcap/tidb-dashboard/pkg/keyvisual/matrix"
+	"github.com/pingcap/tidb-dashboard/pkg/keyvisual/region"
 )
 
 func TestDbstore(t *testing.T) {
 	TestingT(t)
 }
 
+// newTestDB returns a local store in the temporary directory of the test.
+func newTestDB(c *C) *dbstore.DB {
+	gormDB, err := gorm.Open(sqlite.Open(path.Join(c.MkDir(), "test.sqlite.db")), &gorm.Config{})
+	c.Assert(err, IsNil)
+	return &dbstore.DB{DB: gormDB}
+}
+
 var _ = Suite(&testDbstoreSuite{})
 
 type testDbstoreSuite struct {
@@ -95,7 +103,10 @@ func (t *testDbstoreSuite) TestAxisModelFunc(c *C) {
 	endTime := time.Now()
 	axis := matrix.Axis{
 		Keys:       []string{"a", "b"},
-		ValuesList: [][]uint64{{1}, {1}, {1}, {1}},
+		ValuesList: make([][]uint64, len(region.StorageTags)),
+	}
+	for i := range axis.ValuesList {
+		axis.ValuesList[i] = []uint64{1}
 	}
 	axisModel, err := NewAxisModel(layerNum, endTime, axis)
 	if err != nil {
@@ -129,6 +140,41 @@ func (t *testDbstoreSuite) TestAxisModelFunc(c *C) {
 	c.Assert(err, IsNil)
 }
 
+func (t *testDbstoreSuite) TestUnmarshalLegacyAxis(c *C) {
+	// Axes persisted with fewer tags are padded with zero values.
+	axis := matrix.Axis{
+		Keys:       []string{"a", "b", "c"},
+		ValuesList: [][]uint64{{1, 2}, {3, 4}},
+	}
+	axisModel, err := NewAxisModel(0, time.Now(), axis)
+	c.Assert(err, IsNil)
+	obtainedAxis, err := axisModel.UnmarshalAxis()
+	c.Assert(err, IsNil)
+	c.Assert(obtainedAxis.ValuesList, HasLen, len(region.StorageTags))
+	c.Assert(obtainedAxis.ValuesList[:2], DeepEquals, axis.ValuesList)
+	for _, values := range obtainedAxis.ValuesList[2:] {
+		c.Assert(values, DeepEquals, []uint64{0, 0})
+	}
+
+	// Axes persisted with the removed tags drop their values.
+	axis.ValuesList = make([][]uint64, len(region.StorageTags)+6)
+	for i := range axis.ValuesList {
+		axis.ValuesList[i] = []uint64{uint64(i), uint64(i)}
+	}
+	axisModel, err = NewAxisModel(0, time.Now(), axis)
+	c.Assert(err, IsNil)
+	obtainedAxis, err = axisModel.UnmarshalAxis()
+	c.Assert(err, IsNil)
+	c.Assert(obtainedAxis.ValuesList, DeepEquals, axis.ValuesList[:len(region.StorageTags)])
+
+	// The start axes are empty.
+	axisModel, err = NewAxisModel(0, time.Now(), matrix.Axis{})
+	c.Assert(err, IsNil)
+	obtainedAxis, err = axisModel.UnmarshalAxis()
+	c.Assert(err, IsNil)
+	c.Assert(obtainedAxis.ValuesList, HasLen, 0)
+}
+
 func (t *testDbstoreSuite) TestAxisModelsFindAndDelete(c *C) {
 	_, err := CreateTableAxisModelIfNotExists(t.db)
 	if err != nil {
@@ -61,6 +61,20 @@ func IntoStorageAxis(responseAxis matrix.Axis, labeler decorator.Labeler) matrix
 	return matrix.CreateAxis(axis.Keys, storageValuesList)
 }
 
+// fitStorageAxis fits the persisted axis to the StorageTags. Zero values are appended for the tags added after the
+// axis is persisted, and the values of the removed tags at the end are dropped.
+func fitStorageAxis(axis *matrix.Axis) {
+	if len(axis.Keys) == 0 {
+		return
+	}
+	if len(axis.ValuesList) > len(region.StorageTags) {
+		axis.ValuesList = axis.ValuesList[:len(region.StorageTags)]
+	}
+	for len(axis.ValuesList) < len(region.StorageTags) {
+		axis.ValuesList = append(axis.ValuesList, make([]uint64, len(axis.Keys)-1))
+	}
+}
+
 // IntoResponseAxis converts StorageAxis to ResponseAxis.
 func IntoResponseAxis(storageAxis matrix.Axis, baseTag region.StatTag) matrix.Axis {
 	// add integration values
@@ -0,0 +1,234 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pingcap/log"
+	"go.uber.org/zap"
+
+	"github.com/pingcap/tidb-dashboard/pkg/dbstore"
+	"github.com/pingcap/tidb-dashboard/pkg/keyvisual/region"
+)
+
+const (
+	tableRegionIndexModelName = "keyviz_region_index"
+
+	// The regions are kept for the recent heatmaps only, since the regions of the older heatmaps are compacted.
+	regionIndexRetention    = 24 * time.Hour
+	regionIndexGCInterval   = time.Hour
+	regionIndexInsertBatch  = 1000
+	defaultRegionIndexLimit = 100
+)
+
+// RegionVersion is a region with the same keys in the time range (StartTime, EndTime].
+type RegionVersion struct {
+	ID        uint64
+	StartKey  string
+	EndKey    string
+	StartTime time.Time
+	EndTime   time.Time
+}
+
+type RegionIndexModel struct {
+	RegionID  uint64
+	StartKey  []byte
+	EndKey    []byte
+	StartTime time.Time
+	EndTime   time.Time `gorm:"index"`
+}
+
+func (RegionIndexModel) TableName() string {
+	return tableRegionIndexModelName
+}
+
+// regionIndex records the regions of each appended axis. A version of a region is only created when its keys are
+// changed, so the memory is in proportion to the number of regions and the changes of them.
+type regionIndex struct {
+	mu sync.RWMutex
+	// opened are the versions of the regions in the last append.
+	opened map[uint64]*RegionVersion
+	// closed are ordered by the end time.
+	closed   []*RegionVersion
+	lastTime time.Time
+	lastGC   time.Time
+
+	// db is nil if the index is not persisted.
+	db *dbstore.DB
+}
+
+func newRegionIndex(db *dbstore.DB) *regionIndex {
+	return &regionIndex{
+		opened: make(map[uint64]*RegionVersion),
+		db:     db,
+	}
+}
+
+// Append records all the regions existing in (lastTime, endTime], including the ones without any reads or writes.
+// The keys are in the form of RegionsInfo.GetKeys.
+func (x *regionIndex) Append(ids []uint64, keys []string, endTime time.Time) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	startTime := x.lastTime
+	if startTime.IsZero() {
+		startTime = endTime
+	}
+	opened := make(map[uint64]*RegionVersion, len(ids))
+	for i, id := range ids {
+		version, ok := x.opened[id]
+		if ok && version.StartKey == keys[i] && version.EndKey == keys[i+1] {
+			version.EndTime = endTime
+			delete(x.opened, id)
+		} else {
+			version = &RegionVersion{
+				ID:        id,
+				StartKey:  keys[i],
+				EndKey:    keys[i+1],
+				StartTime: startTime,
+				EndTime:   endTime,
+			}
+		}
+		opened[id] = version
+	}
+
+	// The remaining regions are merged or changed.
+	closed := make([]*RegionVersion, 0, len(x.opened))
+	for _, version := range x.opened {
+		closed = append(closed, version)
+	}
+	x.closed = append(x.closed, closed...)
+	x.opened = opened
+	x.lastTime = endTime
+	if err := x.insert(closed); err != nil {
+		log.Warn("Failed to insert the key visual region index", zap.Error(err))
+	}
+
+	if endTime.Sub(x.lastGC) >= regionIndexGCInterval {
+		x.gc(endTime.Add(-regionIndexRetention))
+		x.lastGC = endTime
+	}
+}
+
+func (x *regionIndex) gc(expireTime time.Time) {
+	i := sort.Search(len(x.closed), func(i int) bool {
+		return x.closed[i].EndTime.After(expireTime)
+	})
+	x.closed = append([]*RegionVersion(nil), x.closed[i:]...)
+	if x.db != nil {
+		if err := x.db.Where("end_time <= ?", expireTime).Delete(&RegionIndexModel{}).Error; err != nil {
+			log.Warn("Failed to clean the key visual region index", zap.Error(err))
+		}
+	}
+}
+
+func (x *regionIndex) insert(versions []*RegionVersion) error {
+	if x.db == nil || len(versions) == 0 {
+		return nil
+	}
+	models := make([]*RegionIndexModel, len(versions))
+	for i, version := range versions {
+		models[i] = &RegionIndexModel{
+			RegionID:  version.ID,
+			StartKey:  region.Bytes(version.StartKey),
+			EndKey:    region.Bytes(version.EndKey),
+			StartTime: version.StartTime,
+			EndTime:   version.EndTime,
+		}
+	}
+	return x.db.CreateInBatches(&models, regionIndexInsertBatch).Error
+}
+
+// Restore loads the persisted index. The opened versions are not persisted until Flush.
+func (x *regionIndex) Restore() error {
+	if x.db == nil {
+		return nil
+	}
+	if err := x.db.AutoMigrate(&RegionIndexModel{}); err != nil {
+		return err
+	}
+	var models []*RegionIndexModel
+	expireTime := time.Now().Add(-regionIndexRetention)
+	if err := x.db.Where("end_time > ?", expireTime).Order("end_time").Find(&models).Error; err != nil {
+		return err
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	for _, m := range models {
+		x.closed = append(x.closed, &RegionVersion{
+			ID:        m.RegionID,
+			StartKey:  string(m.StartKey),
+			EndKey:    string(m.EndKey),
+			StartTime: m.StartTime,
+			EndTime:   m.EndTime,
+		})
+	}
+	return nil
+}
+
+// Flush persists the opened versions, it is called when the Stat stops.
+func (x *regionIndex) Flush() error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	opened := make([]*RegionVersion, 0, len(x.opened))
+	for _, version := range x.opened {
+		opened = append(opened, version)
+	}
+	return x.insert(opened)
+}
+
+// Find returns the regions existing in the time range and in the key range, ordered by the start key. The result is
+// truncated to the limit, and the second result is true if it is truncated.
+func (x *regionIndex) Find(startTime, endTime time.Time, startKey, endKey string, limit int) ([]*RegionVersion, bool) {
+	x.mu.RLock()
+	match := func(version *RegionVersion) bool {
+		return version.EndTime.After(startTime) && version.StartTime.Before(endTime) &&
+			(endKey == "" || version.StartKey < endKey) && (version.EndKey == "" || version.EndKey > startKey)
+	}
+	result := make([]*RegionVersion, 0)
+	i := sort.Search(len(x.closed), func(i int) bool {
+		return x.closed[i].EndTime.After(startTime)
+	})
+	for _, version := range x.closed[i:] {
+		if match(version) {
+			v := *version
+			result = append(result, &v)
+		}
+	}
+	for _, version := range x.opened {
+		if match(version) {
+			v := *version
+			result = append(result, &v)
+		}
+	}
+	x.mu.RUnlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].StartKey != result[j].StartKey {
+			return result[i].StartKey < result[j].StartKey
+		}
+		return result[i].StartTime.Before(result[j].StartTime)
+	})
+	if limit <= 0 {
+		limit = defaultRegionIndexLimit
+	}
+	if len(result) > limit {
+		return result[:limit], true
+	}
+	return result, false
+}
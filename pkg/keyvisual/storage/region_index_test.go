@@ -0,0 +1,86 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"time"
+
+	. "github.com/pingcap/check"
+
+	"github.com/pingcap/tidb-dashboard/pkg/dbstore"
+)
+
+var _ = Suite(&testRegionIndexSuite{})
+
+type testRegionIndexSuite struct{}
+
+func minutesLater(m int) time.Time {
+	return time.Now().Truncate(time.Minute).Add(time.Duration(m) * time.Minute)
+}
+
+func regionIDs(versions []*RegionVersion) []uint64 {
+	ids := make([]uint64, len(versions))
+	for i, version := range versions {
+		ids[i] = version.ID
+	}
+	return ids
+}
+
+func buildRegionIndex(db *dbstore.DB) *regionIndex {
+	x := newRegionIndex(db)
+	x.Append([]uint64{1, 2}, []string{"", "b", ""}, minutesLater(1))
+	x.Append([]uint64{1, 2}, []string{"", "b", ""}, minutesLater(2))
+	// region 2 is split into 2 and 3
+	x.Append([]uint64{1, 2, 3}, []string{"", "b", "c", ""}, minutesLater(3))
+	// region 1 is merged into region 2
+	x.Append([]uint64{2, 3}, []string{"", "c", ""}, minutesLater(4))
+	return x
+}
+
+func (t *testRegionIndexSuite) TestFind(c *C) {
+	x := buildRegionIndex(nil)
+
+	versions, truncated := x.Find(minutesLater(0), minutesLater(4), "", "", 0)
+	c.Assert(truncated, IsFalse)
+	c.Assert(regionIDs(versions), DeepEquals, []uint64{1, 2, 2, 2, 3})
+
+	versions, _ = x.Find(minutesLater(1), minutesLater(2), "b", "", 0)
+	c.Assert(regionIDs(versions), DeepEquals, []uint64{2})
+	c.Assert(versions[0].StartKey, Equals, "b")
+	c.Assert(versions[0].EndKey, Equals, "")
+	c.Assert(versions[0].StartTime.Equal(minutesLater(1)), IsTrue)
+	c.Assert(versions[0].EndTime.Equal(minutesLater(2)), IsTrue)
+
+	versions, _ = x.Find(minutesLater(2), minutesLater(4), "bb", "c", 0)
+	c.Assert(regionIDs(versions), DeepEquals, []uint64{2, 2})
+	c.Assert(versions[0].StartKey, Equals, "")
+	c.Assert(versions[1].StartKey, Equals, "b")
+
+	versions, truncated = x.Find(minutesLater(0), minutesLater(4), "", "", 2)
+	c.Assert(truncated, IsTrue)
+	c.Assert(versions, HasLen, 2)
+}
+
+func (t *testRegionIndexSuite) TestPersist(c *C) {
+	db := newTestDB(c)
+	c.Assert(newRegionIndex(db).Restore(), IsNil)
+
+	x := buildRegionIndex(db)
+	c.Assert(x.Flush(), IsNil)
+
+	restored := newRegionIndex(db)
+	c.Assert(restored.Restore(), IsNil)
+	versions, _ := restored.Find(minutesLater(0), minutesLater(4), "", "", 0)
+	c.Assert(regionIDs(versions), DeepEquals, []uint64{1, 2, 2, 2, 3})
+}
@@ -0,0 +1,247 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"compress/gzip"
+	"encoding/gob"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/joomcode/errorx"
+
+	"github.com/pingcap/tidb-dashboard/pkg/keyvisual/decorator"
+	"github.com/pingcap/tidb-dashboard/pkg/keyvisual/matrix"
+	"github.com/pingcap/tidb-dashboard/pkg/keyvisual/region"
+)
+
+// SnapshotVersion is the version of the snapshot format. Snapshots of newer versions can not be loaded.
+const SnapshotVersion = 1
+
+// snapshotLimits bound the snapshots to read, since a small archive can be decompressed into a huge one.
+type snapshotLimits struct {
+	decodedSize int64
+	axes        int
+	axisKeys    int
+}
+
+// The default layers keep less than 1000 axes, and each axis has about 3000 keys.
+var defaultSnapshotLimits = snapshotLimits{
+	decodedSize: 1 << 30,
+	axes:        10000,
+	axisKeys:    100000,
+}
+
+var (
+	ErrNS              = errorx.NewNamespace("error.keyvisual")
+	ErrNSStorage       = ErrNS.NewSubNamespace("storage")
+	ErrInvalidSnapshot = ErrNSStorage.NewType("invalid_snapshot")
+)
+
+// Snapshot is the heatmap data in a time range, which can be taken out of the cluster and loaded elsewhere.
+type Snapshot struct {
+	Version int
+	// Tags are the names of the statistics in the ValuesList of each axis.
+	Tags  []string
+	Times []time.Time
+	Axes  []matrix.Axis
+	// Labels are the labels of all keys in the axes at the time of exporting.
+	Labels map[string][]string
+}
+
+// Export takes a snapshot of the storage axes in the time range.
+func (s *Stat) Export(startTime, endTime time.Time, labeler decorator.Labeler) *Snapshot {
+	times, axes := s.rangeRoot(startTime, endTime)
+	tags := make([]string, len(region.StorageTags))
+	for i, tag := range region.StorageTags {
+		tags[i] = tag.String()
+	}
+	snapshot := &Snapshot{
+		Version: SnapshotVersion,
+		Tags:    tags,
+		Labels:  make(map[string][]string),
+	}
+	if len(times) <= 1 {
+		return snapshot
+	}
+	snapshot.Times = times
+	snapshot.Axes = axes
+
+	keySet := make(map[string]struct{})
+	for _, axis := range axes {
+		for _, key := range axis.Keys {
+			if key != "" {
+				keySet[key] = struct{}{}
+			}
+		}
+	}
+	keys := matrix.MakeKeys(keySet)
+	if len(keys) > 0 {
+		for i, labelKey := range labeler.Label(keys) {
+			snapshot.Labels[keys[i]] = labelKey.Labels
+		}
+	}
+	return snapshot
+}
+
+// WriteSnapshot writes the snapshot as a gzip compressed archive.
+func WriteSnapshot(w io.Writer, snapshot *Snapshot) error {
+	gw := gzip.NewWriter(w)
+	if err := gob.NewEncoder(gw).Encode(snapshot); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+// ReadSnapshot reads the archive written by WriteSnapshot.
+func ReadSnapshot(r io.Reader) (*Snapshot, error) {
+	return readSnapshot(r, defaultSnapshotLimits)
+}
+
+func readSnapshot(r io.Reader, limits snapshotLimits) (*Snapshot, error) {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, ErrInvalidSnapshot.Wrap(err, "snapshot is not a gzip archive")
+	}
+	defer gr.Close()
+	var snapshot Snapshot
+	if err := gob.NewDecoder(&decodedSizeLimiter{r: gr, n: limits.decodedSize}).Decode(&snapshot); err != nil {
+		if errorx.IsOfType(err, ErrInvalidSnapshot) {
+			return nil, err
+		}
+		return nil, ErrInvalidSnapshot.Wrap(err, "snapshot decode failed")
+	}
+	if snapshot.Version <= 0 || snapshot.Version > SnapshotVersion {
+		return nil, ErrInvalidSnapshot.New("unsupported snapshot version %d", snapshot.Version)
+	}
+	if len(snapshot.Axes) == 0 {
+		return nil, ErrInvalidSnapshot.New("snapshot has no data")
+	}
+	if len(snapshot.Axes) > limits.axes {
+		return nil, ErrInvalidSnapshot.New("snapshot has %d axes, more than %d", len(snapshot.Axes), limits.axes)
+	}
+	if len(snapshot.Times) != len(snapshot.Axes)+1 {
+		return nil, ErrInvalidSnapshot.New("snapshot has %d times but %d axes", len(snapshot.Times), len(snapshot.Axes))
+	}
+	for _, axis := range snapshot.Axes {
+		if len(axis.Keys) <= 1 || len(axis.ValuesList) != len(snapshot.Tags) {
+			return nil, ErrInvalidSnapshot.New("snapshot axis is malformed")
+		}
+		if len(axis.Keys) > limits.axisKeys {
+			return nil, ErrInvalidSnapshot.New("snapshot axis has %d keys, more than %d", len(axis.Keys), limits.axisKeys)
+		}
+		for _, values := range axis.ValuesList {
+			if len(values)+1 != len(axis.Keys) {
+				return nil, ErrInvalidSnapshot.New("snapshot axis is malformed")
+			}
+		}
+	}
+	return &snapshot, nil
+}
+
+// decodedSizeLimiter fails the reading after n bytes, so that the decompressed snapshot is bounded.
+type decodedSizeLimiter struct {
+	r io.Reader
+	n int64
+}
+
+func (l *decodedSizeLimiter) Read(p []byte) (int, error) {
+	if l.n <= 0 {
+		return 0, ErrInvalidSnapshot.New("decompressed snapshot is too large")
+	}
+	if int64(len(p)) > l.n {
+		p = p[:l.n]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	return n, err
+}
+
+// OfflineStat is a read-only Stat loaded from a snapshot.
+type OfflineStat struct {
+	keyMap matrix.KeyMap
+	times  []time.Time
+	axes   []matrix.Axis
+	Labels map[string][]string
+}
+
+// NewOfflineStat loads the snapshot. The statistics are matched to the storage tags by name, and the ones missing
+// in the snapshot are zero.
+func NewOfflineStat(snapshot *Snapshot) *OfflineStat {
+	tagIndex := make(map[string]int, len(snapshot.Tags))
+	for i, tag := range snapshot.Tags {
+		tagIndex[tag] = i
+	}
+	s := &OfflineStat{
+		times:  snapshot.Times,
+		axes:   make([]matrix.Axis, len(snapshot.Axes)),
+		Labels: snapshot.Labels,
+	}
+	for i, axis := range snapshot.Axes {
+		s.keyMap.SaveKeys(axis.Keys)
+		valuesList := make([][]uint64, len(region.StorageTags))
+		for j, tag := range region.StorageTags {
+			if idx, ok := tagIndex[tag.String()]; ok {
+				valuesList[j] = axis.ValuesList[idx]
+			} else {
+				valuesList[j] = make([]uint64, len(axis.Keys)-1)
+			}
+		}
+		s.axes[i] = matrix.CreateAxis(axis.Keys, valuesList)
+	}
+	return s
+}
+
+// TimeRange returns the time range of the data, which is zero if there is no data.
+func (s *OfflineStat) TimeRange() (time.Time, time.Time) {
+	if len(s.times) == 0 {
+		return time.Time{}, time.Time{}
+	}
+	return s.times[0], s.times[len(s.times)-1]
+}
+
+// Range returns a sub Plane with specified range.
+func (s *OfflineStat) Range(startTime, endTime time.Time, startKey, endKey string, baseTag region.StatTag) matrix.Plane {
+	s.keyMap.SaveKey(&startKey)
+	s.keyMap.SaveKey(&endKey)
+
+	if len(s.axes) == 0 {
+		return matrix.CreateEmptyPlane(startTime, endTime, startKey, endKey, len(region.ResponseTags))
+	}
+	// The axis i covers the time range (times[i], times[i+1]].
+	start := sort.Search(len(s.axes), func(i int) bool {
+		return s.times[i+1].After(startTime)
+	})
+	end := sort.Search(len(s.axes), func(i int) bool {
+		return !s.times[i].Before(endTime)
+	})
+	if start >= end {
+		return matrix.CreateEmptyPlane(startTime, endTime, startKey, endKey, len(region.ResponseTags))
+	}
+	times := s.times[start : end+1]
+	axes := make([]matrix.Axis, end-start)
+	copy(axes, s.axes[start:end])
+	return rangePlane(times, axes, startKey, endKey, baseTag)
+}
+
+// rangePlane converts the storage axes to a Plane of the response axes in the key range. The axes are modified.
+func rangePlane(times []time.Time, axes []matrix.Axis, startKey, endKey string, baseTag region.StatTag) matrix.Plane {
+	for i, axis := range axes {
+		axis = axis.Range(startKey, endKey)
+		axis = IntoResponseAxis(axis, baseTag)
+		axes[i] = axis
+	}
+	return matrix.CreatePlane(times, axes)
+}
@@ -0,0 +1,133 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/joomcode/errorx"
+	. "github.com/pingcap/check"
+
+	"github.com/pingcap/tidb-dashboard/pkg/keyvisual/matrix"
+	"github.com/pingcap/tidb-dashboard/pkg/keyvisual/region"
+)
+
+var _ = Suite(&testSnapshotSuite{})
+
+type testSnapshotSuite struct{}
+
+func buildSnapshot() *Snapshot {
+	startTime := time.Unix(1600000000, 0)
+	return &Snapshot{
+		Version: SnapshotVersion,
+		// WrittenKeys and ReadKeys are missing, and the order differs from the storage tags.
+		Tags: []string{region.ReadBytes.String(), region.WrittenBytes.String()},
+		Times: []time.Time{
+			startTime,
+			startTime.Add(time.Minute),
+			startTime.Add(2 * time.Minute),
+		},
+		Axes: []matrix.Axis{
+			{Keys: []string{"", "b", ""}, ValuesList: [][]uint64{{1, 2}, {10, 20}}},
+			{Keys: []string{"", "a", "c", ""}, ValuesList: [][]uint64{{3, 4, 5}, {30, 40, 50}}},
+		},
+		Labels: map[string][]string{
+			"a": {"table_a"},
+			"b": {"table_b"},
+			"c": {"table_c"},
+		},
+	}
+}
+
+func (t *testSnapshotSuite) TestRoundTrip(c *C) {
+	snapshot := buildSnapshot()
+	var buf bytes.Buffer
+	c.Assert(WriteSnapshot(&buf, snapshot), IsNil)
+	loaded, err := ReadSnapshot(&buf)
+	c.Assert(err, IsNil)
+	c.Assert(loaded.Tags, DeepEquals, snapshot.Tags)
+	c.Assert(loaded.Axes, DeepEquals, snapshot.Axes)
+	c.Assert(loaded.Labels, DeepEquals, snapshot.Labels)
+	c.Assert(loaded.Times, HasLen, 3)
+	c.Assert(loaded.Times[2].Equal(snapshot.Times[2]), IsTrue)
+}
+
+func (t *testSnapshotSuite) TestReadInvalid(c *C) {
+	_, err := ReadSnapshot(bytes.NewBufferString("not a snapshot"))
+	c.Assert(errorx.IsOfType(err, ErrInvalidSnapshot), IsTrue)
+
+	for _, modify := range []func(s *Snapshot){
+		func(s *Snapshot) { s.Version = SnapshotVersion + 1 },
+		func(s *Snapshot) { s.Times = s.Times[:2] },
+		func(s *Snapshot) { s.Axes[0].ValuesList = s.Axes[0].ValuesList[:1] },
+		func(s *Snapshot) { s.Axes[1].ValuesList[0] = []uint64{1} },
+		func(s *Snapshot) { s.Times, s.Axes = s.Times[:1], nil },
+	} {
+		snapshot := buildSnapshot()
+		modify(snapshot)
+		var buf bytes.Buffer
+		c.Assert(WriteSnapshot(&buf, snapshot), IsNil)
+		_, err := ReadSnapshot(&buf)
+		c.Assert(errorx.IsOfType(err, ErrInvalidSnapshot), IsTrue)
+	}
+}
+
+func (t *testSnapshotSuite) TestReadLimits(c *C) {
+	var buf bytes.Buffer
+	c.Assert(WriteSnapshot(&buf, buildSnapshot()), IsNil)
+	archive := buf.Bytes()
+
+	_, err := readSnapshot(bytes.NewReader(archive), snapshotLimits{decodedSize: 1 << 20, axes: 2, axisKeys: 4})
+	c.Assert(err, IsNil)
+	for _, limits := range []snapshotLimits{
+		{decodedSize: 100, axes: 2, axisKeys: 4},
+		{decodedSize: 1 << 20, axes: 1, axisKeys: 4},
+		{decodedSize: 1 << 20, axes: 2, axisKeys: 3},
+	} {
+		_, err := readSnapshot(bytes.NewReader(archive), limits)
+		c.Assert(errorx.IsOfType(err, ErrInvalidSnapshot), IsTrue, Commentf("limits: %+v", limits))
+	}
+}
+
+func (t *testSnapshotSuite) TestOfflineStat(c *C) {
+	snapshot := buildSnapshot()
+	stat := NewOfflineStat(snapshot)
+	startTime, endTime := stat.TimeRange()
+	c.Assert(startTime.Equal(snapshot.Times[0]), IsTrue)
+	c.Assert(endTime.Equal(snapshot.Times[2]), IsTrue)
+
+	plane := stat.Range(startTime, endTime, "", "", region.WrittenBytes)
+	c.Assert(plane.Axes, HasLen, 2)
+	c.Assert(plane.Axes[1].Keys, DeepEquals, []string{"", "a", "c", ""})
+	// Response tags are ordered as Integration, WrittenBytes, ReadBytes, ..., with the base tag swapped to the first.
+	c.Assert(plane.Axes[1].ValuesList, HasLen, len(region.ResponseTags))
+	c.Assert(plane.Axes[1].ValuesList[:3], DeepEquals, [][]uint64{
+		{30, 40, 50},
+		{33, 44, 55},
+		{3, 4, 5},
+	})
+	for _, values := range plane.Axes[1].ValuesList[3:] {
+		c.Assert(values, DeepEquals, []uint64{0, 0, 0})
+	}
+
+	// Only the second axis covers the time range.
+	plane = stat.Range(startTime.Add(90*time.Second), endTime, "", "", region.Integration)
+	c.Assert(plane.Axes, HasLen, 1)
+	c.Assert(plane.Axes[0].ValuesList[0], DeepEquals, []uint64{33, 44, 55})
+
+	plane = stat.Range(endTime, endTime.Add(time.Minute), "", "", region.Integration)
+	c.Assert(plane.Axes, HasLen, 1)
+	c.Assert(plane.Axes[0].ValuesList[0], DeepEquals, []uint64{0})
+}
@@ -20,7 +20,9 @@ import (
 	"sync"
 	"time"
 
+	"github.com/pingcap/log"
 	"go.uber.org/fx"
+	"go.uber.org/zap"
 
 	"github.com/pingcap/tidb-dashboard/pkg/dbstore"
 	"github.com/pingcap/tidb-dashboard/pkg/keyvisual/decorator"
@@ -180,6 +182,8 @@ func (s *layerStat) Range(startTime, endTime time.Time) (times []time.Time, axes
 // StatConfig is the configuration of Stat.
 type StatConfig struct {
 	LayersConfig []LayerConfig
+	// PersistRegionIndex persists the regions of the appended axes, so that they can be found after restarts.
+	PersistRegionIndex bool
 }
 
 // Stat is composed of multiple layerStats.
@@ -187,8 +191,9 @@ type Stat struct {
 	mutex  sync.RWMutex
 	layers []*layerStat
 
-	keyMap   matrix.KeyMap
-	strategy *matrix.Strategy
+	keyMap      matrix.KeyMap
+	strategy    *matrix.Strategy
+	regionIndex *regionIndex
 
 	db *dbstore.DB
 }
@@ -202,24 +207,16 @@ func NewStat(
 	strategy *matrix.Strategy,
 	startTime time.Time,
 ) *Stat {
-	layers := make([]*layerStat, len(cfg.LayersConfig))
-	for i, c := range cfg.LayersConfig {
-		layers[i] = newLayerStat(uint8(i), c, strategy, startTime, db)
-		if i > 0 {
-			layers[i-1].Next = layers[i]
-		}
-	}
-	s := &Stat{
-		layers:   layers,
-		strategy: strategy,
-		db:       db,
-	}
+	s := newStat(db, cfg, strategy, startTime)
 
 	lc.Append(fx.Hook{
 		OnStart: func(ctx context.Context) error {
 			if err := s.Restore(); err != nil {
 				return err
 			}
+			if err := s.regionIndex.Restore(); err != nil {
+				log.Warn("Failed to restore the key visual region index", zap.Error(err))
+			}
 			wg.Add(1)
 			go func() {
 				defer wg.Done()
@@ -227,11 +224,37 @@ func NewStat(
 			}()
 			return nil
 		},
+		OnStop: func(context.Context) error {
+			if err := s.regionIndex.Flush(); err != nil {
+				log.Warn("Failed to persist the key visual region index", zap.Error(err))
+			}
+			return nil
+		},
 	})
 
 	return s
 }
 
+func newStat(db *dbstore.DB, cfg StatConfig, strategy *matrix.Strategy, startTime time.Time) *Stat {
+	layers := make([]*layerStat, len(cfg.LayersConfig))
+	for i, c := range cfg.LayersConfig {
+		layers[i] = newLayerStat(uint8(i), c, strategy, startTime, db)
+		if i > 0 {
+			layers[i-1].Next = layers[i]
+		}
+	}
+	var indexDB *dbstore.DB
+	if cfg.PersistRegionIndex {
+		indexDB = db
+	}
+	return &Stat{
+		layers:      layers,
+		strategy:    strategy,
+		regionIndex: newRegionIndex(indexDB),
+		db:          db,
+	}
+}
+
 func (s *Stat) rebuildKeyMap() {
 	s.keyMap.Lock()
 	defer s.keyMap.Unlock()
@@ -274,11 +297,23 @@ func (s *Stat) Append(regions region.RegionsInfo, endTime time.Time) {
 	defer s.keyMap.RUnlock()
 	s.keyMap.SaveKeys(axis.Keys)
 
+	if getter, ok := regions.(region.RegionIDsGetter); ok {
+		keys := regions.GetKeys()
+		s.keyMap.SaveKeys(keys)
+		s.regionIndex.Append(getter.GetIDs(), keys, endTime)
+	}
+
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 	s.layers[0].Append(axis, endTime, labeler)
 }
 
+// FindRegions returns the regions existing in the time range and in the key range, ordered by the start key.
+// It returns true if there are more regions than the limit.
+func (s *Stat) FindRegions(startTime, endTime time.Time, startKey, endKey string, limit int) ([]*RegionVersion, bool) {
+	return s.regionIndex.Find(startTime, endTime, startKey, endKey, limit)
+}
+
 func (s *Stat) rangeRoot(startTime, endTime time.Time) ([]time.Time, []matrix.Axis) {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
@@ -298,10 +333,5 @@ func (s *Stat) Range(startTime, endTime time.Time, startKey, endKey string, base
 		return matrix.CreateEmptyPlane(startTime, endTime, startKey, endKey, len(region.ResponseTags))
 	}
 
-	for i, axis := range axes {
-		axis = axis.Range(startKey, endKey)
-		axis = IntoResponseAxis(axis, baseTag)
-		axes[i] = axis
-	}
-	return matrix.CreatePlane(times, axes)
+	return rangePlane(times, axes, startKey, endKey, baseTag)
 }
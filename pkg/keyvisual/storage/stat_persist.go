@@ -18,7 +18,9 @@ import (
 
 	"github.com/pingcap/log"
 	"go.uber.org/zap"
+	"gorm.io/gorm"
 
+	"github.com/pingcap/tidb-dashboard/pkg/dbstore"
 	"github.com/pingcap/tidb-dashboard/pkg/keyvisual/matrix"
 )
 
@@ -72,6 +74,7 @@ func (s *Stat) Restore() error {
 	}
 
 	// load data from db
+	var layersAxisModels [][]*AxisModel
 	for layerNum := uint8(0); ; layerNum++ {
 		axisModels, err := FindAxisModelsOrderByTime(s.db, layerNum)
 		if err != nil {
@@ -80,21 +83,28 @@ func (s *Stat) Restore() error {
 		if len(axisModels) == 0 {
 			break
 		}
-		if layerNum >= uint8(len(s.layers)) {
-			log.Warn("Layer num is too large. Ignore and delete the redundant axisModels", zap.Uint8("layer num", layerNum), zap.Int("layers len", len(s.layers)))
-			_ = DeleteAxisModelsByLayerNum(s.db, layerNum)
-			continue
+		layersAxisModels = append(layersAxisModels, axisModels)
+	}
+	if len(layersAxisModels) > 0 && len(layersAxisModels[0]) <= 1 {
+		// no valid data was stored，clear
+		log.Debug("Clear table AxisModel")
+		if err := ClearTableAxisModel(s.db); err != nil {
+			return err
 		}
+		return createStartAxisModels()
+	}
+	if !s.fitLayers(layersAxisModels) {
+		log.Info("The layers of persisted axes differ from the config, relayout them")
+		layersAxisModels, err = s.relayoutAxisModels(layersAxisModels)
+		if err != nil {
+			return err
+		}
+	}
 
+	for i, axisModels := range layersAxisModels {
+		layerNum := uint8(i)
 		if len(axisModels) > 1 {
 			s.layers[layerNum].Empty = false
-		} else if layerNum == 0 {
-			// no valid data was stored，clear
-			log.Debug("Clear table AxisModel")
-			if err := ClearTableAxisModel(s.db); err != nil {
-				return err
-			}
-			return createStartAxisModels()
 		}
 		log.Debug("Load axisModels", zap.Uint8("layer num", layerNum), zap.Int("len", len(axisModels)-1))
 
@@ -102,13 +112,6 @@ func (s *Stat) Restore() error {
 		s.layers[layerNum].StartTime = axisModels[0].Time
 		s.layers[layerNum].Head = 0
 		n := len(axisModels) - 1
-		if n > s.layers[layerNum].Len {
-			log.Warn("The number of axisModel is longer than layer's len", zap.Int("number", n), zap.Int("layer len", s.layers[layerNum].Len), zap.Uint8("layer num", layerNum))
-			for _, p := range axisModels[s.layers[layerNum].Len+1:] {
-				_ = p.Delete(s.db)
-			}
-			n = s.layers[layerNum].Len
-		}
 		s.layers[layerNum].EndTime = axisModels[n].Time
 		s.layers[layerNum].Tail = (s.layers[layerNum].Head + n) % s.layers[layerNum].Len
 		for i, axisModel := range axisModels[1 : n+1] {
@@ -123,3 +126,73 @@ func (s *Stat) Restore() error {
 	}
 	return nil
 }
+
+// fitLayers checks whether the persisted axes of each layer can be loaded into the layers.
+func (s *Stat) fitLayers(layersAxisModels [][]*AxisModel) bool {
+	if len(layersAxisModels) > len(s.layers) {
+		return false
+	}
+	for i, axisModels := range layersAxisModels {
+		if len(axisModels)-1 > s.layers[i].Len {
+			return false
+		}
+	}
+	return true
+}
+
+// relayoutAxisModels moves the persisted axes into the layers, e.g. after the layer config is changed. The newest
+// axes are kept in the first layer, and the older ones are moved to the next layers, until all layers are full.
+// Only the axes which are too old to be kept in any layer are removed.
+func (s *Stat) relayoutAxisModels(layersAxisModels [][]*AxisModel) ([][]*AxisModel, error) {
+	// The axes of all layers from the newest to the oldest. The start time of the last layer is the oldest time.
+	var axisModels []*AxisModel
+	for _, models := range layersAxisModels {
+		for i := len(models) - 1; i > 0; i-- {
+			axisModels = append(axisModels, models[i])
+		}
+	}
+	lastModels := layersAxisModels[len(layersAxisModels)-1]
+	oldestTime := lastModels[0].Time
+
+	result := make([][]*AxisModel, len(s.layers))
+	for layerNum, layer := range s.layers {
+		n := layer.Len
+		if n > len(axisModels) {
+			n = len(axisModels)
+		}
+		startTime := oldestTime
+		if n < len(axisModels) {
+			startTime = axisModels[n].Time
+		}
+		startAxisModel, err := NewAxisModel(uint8(layerNum), startTime, matrix.Axis{})
+		if err != nil {
+			return nil, err
+		}
+		models := []*AxisModel{startAxisModel}
+		for i := n - 1; i >= 0; i-- {
+			axisModels[i].LayerNum = uint8(layerNum)
+			models = append(models, axisModels[i])
+		}
+		result[layerNum] = models
+		axisModels = axisModels[n:]
+	}
+	if len(axisModels) > 0 {
+		log.Warn("Remove the persisted axes older than the layers", zap.Int("number", len(axisModels)))
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		db := &dbstore.DB{DB: tx}
+		if err := ClearTableAxisModel(db); err != nil {
+			return err
+		}
+		for _, models := range result {
+			for _, axisModel := range models {
+				if err := axisModel.Insert(db); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	return result, err
+}
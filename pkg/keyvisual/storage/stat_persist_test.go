@@ -0,0 +1,123 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"time"
+
+	. "github.com/pingcap/check"
+
+	"github.com/pingcap/tidb-dashboard/pkg/dbstore"
+	"github.com/pingcap/tidb-dashboard/pkg/keyvisual/decorator"
+	"github.com/pingcap/tidb-dashboard/pkg/keyvisual/matrix"
+	"github.com/pingcap/tidb-dashboard/pkg/keyvisual/region"
+)
+
+var _ = Suite(&testStatPersistSuite{})
+
+type testStatPersistSuite struct {
+	db *dbstore.DB
+}
+
+func (t *testStatPersistSuite) SetUpTest(c *C) {
+	t.db = newTestDB(c)
+	_, err := CreateTableAxisModelIfNotExists(t.db)
+	c.Assert(err, IsNil)
+}
+
+func testStorageAxis(value uint64) matrix.Axis {
+	valuesList := make([][]uint64, len(region.StorageTags))
+	for i := range valuesList {
+		valuesList[i] = []uint64{value}
+	}
+	return matrix.CreateAxis([]string{"", ""}, valuesList)
+}
+
+func (t *testStatPersistSuite) insert(c *C, layerNum uint8, minutes ...int) {
+	baseTime := time.Unix(1600000000, 0)
+	for i, m := range minutes {
+		axis := testStorageAxis(uint64(m))
+		if i == 0 {
+			// the start axis
+			axis = matrix.Axis{}
+		}
+		axisModel, err := NewAxisModel(layerNum, baseTime.Add(time.Duration(m)*time.Minute), axis)
+		c.Assert(err, IsNil)
+		c.Assert(axisModel.Insert(t.db), IsNil)
+	}
+}
+
+func (t *testStatPersistSuite) newStat(layersConfig ...LayerConfig) *Stat {
+	strategy := &matrix.Strategy{
+		LabelStrategy: decorator.NaiveLabelStrategy(),
+		SplitStrategy: matrix.AverageSplitStrategy(),
+	}
+	return newStat(t.db, StatConfig{LayersConfig: layersConfig}, strategy, time.Now())
+}
+
+func layerMinutes(layer *layerStat) (start int, ends []int) {
+	baseTime := time.Unix(1600000000, 0)
+	start = int(layer.StartTime.Sub(baseTime) / time.Minute)
+	size := 0
+	if !layer.Empty {
+		size = layer.Tail - layer.Head
+		if size <= 0 {
+			size += layer.Len
+		}
+	}
+	for i := 0; i < size; i++ {
+		ends = append(ends, int(layer.RingTimes[(layer.Head+i)%layer.Len].Sub(baseTime)/time.Minute))
+	}
+	return
+}
+
+func (t *testStatPersistSuite) TestRestore(c *C) {
+	t.insert(c, 0, 4, 5, 6, 7)
+	t.insert(c, 1, 0, 2, 4)
+
+	s := t.newStat(LayerConfig{Len: 3, Ratio: 2}, LayerConfig{Len: 3, Ratio: 0})
+	c.Assert(s.Restore(), IsNil)
+	start, ends := layerMinutes(s.layers[0])
+	c.Assert(start, Equals, 4)
+	c.Assert(ends, DeepEquals, []int{5, 6, 7})
+	start, ends = layerMinutes(s.layers[1])
+	c.Assert(start, Equals, 0)
+	c.Assert(ends, DeepEquals, []int{2, 4})
+}
+
+func (t *testStatPersistSuite) TestRelayout(c *C) {
+	t.insert(c, 0, 4, 5, 6, 7)
+	t.insert(c, 1, 0, 2, 4)
+	t.insert(c, 2, -10, -5, 0)
+
+	s := t.newStat(LayerConfig{Len: 2, Ratio: 2}, LayerConfig{Len: 3, Ratio: 0})
+	c.Assert(s.Restore(), IsNil)
+	start, ends := layerMinutes(s.layers[0])
+	c.Assert(start, Equals, 5)
+	c.Assert(ends, DeepEquals, []int{6, 7})
+	start, ends = layerMinutes(s.layers[1])
+	c.Assert(start, Equals, 0)
+	c.Assert(ends, DeepEquals, []int{2, 4, 5})
+
+	// The axes are persisted in the new layout, and are loaded as is.
+	var count int64
+	c.Assert(t.db.Model(&AxisModel{}).Count(&count).Error, IsNil)
+	c.Assert(count, Equals, int64(7))
+	s = t.newStat(LayerConfig{Len: 2, Ratio: 2}, LayerConfig{Len: 3, Ratio: 0})
+	c.Assert(s.Restore(), IsNil)
+	_, ends = layerMinutes(s.layers[1])
+	c.Assert(ends, DeepEquals, []int{2, 4, 5})
+	axis := s.layers[1].RingAxes[2]
+	c.Assert(axis.ValuesList[0], DeepEquals, []uint64{5})
+}
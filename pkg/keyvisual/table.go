@@ -0,0 +1,187 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keyvisual
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/pingcap/tidb-dashboard/pkg/apiserver/utils"
+	"github.com/pingcap/tidb-dashboard/pkg/keyvisual/decorator"
+	"github.com/pingcap/tidb-dashboard/pkg/keyvisual/matrix"
+	"github.com/pingcap/tidb-dashboard/pkg/keyvisual/region"
+)
+
+type TableLevel string
+
+const (
+	TableLevelTable TableLevel = "table"
+	TableLevelIndex TableLevel = "index"
+)
+
+type TableSeries struct {
+	DB      string `json:"db"`
+	Table   string `json:"table"`
+	TableID int64  `json:"table_id"`
+	// Index is empty for the records, or for the whole table at the table level.
+	Index   string `json:"index"`
+	IndexID int64  `json:"index_id"`
+	Total   uint64 `json:"total"`
+	// Values[i] is the value in the time range (TimeAxis[i], TimeAxis[i+1]].
+	Values []uint64 `json:"values"`
+}
+
+type TableSeriesResponse struct {
+	Type     string         `json:"type"`
+	TimeAxis []int64        `json:"time_axis"`
+	Series   []*TableSeries `json:"series"`
+}
+
+type tableSeriesKey struct {
+	tableID int64
+	indexID int64
+}
+
+// aggregateTables sums the values of the base column by the table or the index which the start key of each range
+// belongs to. The ranges not in any table are ignored, and so are the tables not in the db if it is specified.
+// The keys of each axis are decoded at the end time of the axis, and a series is named as it was in its last axis.
+func aggregateTables(plane *matrix.Plane, decoderAt func(t time.Time) decorator.TableKeyDecoder, level TableLevel, db string) []*TableSeries {
+	seriesMap := make(map[tableSeriesKey]*TableSeries)
+	result := make([]*TableSeries, 0)
+
+	for i, axis := range plane.Axes {
+		decoder := decoderAt(plane.Times[i+1])
+		values := axis.ValuesList[0]
+		for j, value := range values {
+			tableKey, ok := decoder.DecodeTableKey(axis.Keys[j])
+			if !ok || (db != "" && tableKey.DB != db) {
+				continue
+			}
+			if level == TableLevelTable {
+				tableKey.Index = ""
+				tableKey.IndexID = 0
+			}
+			k := tableSeriesKey{tableID: tableKey.TableID, indexID: tableKey.IndexID}
+			series, ok := seriesMap[k]
+			if !ok {
+				series = &TableSeries{
+					TableID: tableKey.TableID,
+					IndexID: tableKey.IndexID,
+					Values:  make([]uint64, len(plane.Axes)),
+				}
+				seriesMap[k] = series
+				result = append(result, series)
+			}
+			series.DB, series.Table, series.Index = tableKey.DB, tableKey.Table, tableKey.Index
+			series.Values[i] += value
+			series.Total += value
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Total > result[j].Total
+	})
+	return result
+}
+
+func writeTableSeriesCSV(c *gin.Context, resp *TableSeriesResponse) {
+	c.Writer.Header().Set("Content-Type", "text/csv")
+	c.Writer.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="keyviz-tables-%s.csv"`, resp.Type))
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	header := []string{"db", "table", "table_id", "index", "index_id", "total"}
+	// Each value column is named by the end of its time range.
+	for _, t := range resp.TimeAxis[1:] {
+		header = append(header, strconv.FormatInt(t, 10))
+	}
+	_ = w.Write(header)
+	for _, series := range resp.Series {
+		record := []string{
+			series.DB,
+			series.Table,
+			strconv.FormatInt(series.TableID, 10),
+			series.Index,
+			strconv.FormatInt(series.IndexID, 10),
+			strconv.FormatUint(series.Total, 10),
+		}
+		for _, value := range series.Values {
+			record = append(record, strconv.FormatUint(value, 10))
+		}
+		_ = w.Write(record)
+	}
+	w.Flush()
+}
+
+// @Summary Key Visual Table Series
+// @Description Aggregate the data in a given time range by tables or indexes, which requires the db policy
+// @Param starttime query int false "The start of the time range (Unix)"
+// @Param endtime query int false "The end of the time range (Unix)"
+// @Param type query string false "Main types of data" Enums(written_bytes, read_bytes, written_keys, read_keys, integration)
+// @Param db query string false "Only aggregate the tables in the database"
+// @Param level query string false "Aggregate by tables or indexes, index by default" Enums(table, index)
+// @Param format query string false "Response format, json by default" Enums(json, csv)
+// @Success 200 {object} TableSeriesResponse
+// @Router /keyvisual/tables [get]
+// @Security JwtAuth
+// @Failure 400 {object} utils.APIError
+// @Failure 401 {object} utils.APIError "Unauthorized failure"
+func (s *Service) tableSeries(c *gin.Context) {
+	endTime := time.Now()
+	startTime := endTime.Add(-360 * time.Minute)
+	startTime, endTime, ok := parseTimeRange(c, startTime, endTime)
+	if !ok {
+		return
+	}
+	level := TableLevel(c.DefaultQuery("level", string(TableLevelIndex)))
+	if level != TableLevelTable && level != TableLevelIndex {
+		c.JSON(http.StatusBadRequest, "bad request")
+		return
+	}
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "csv" {
+		c.JSON(http.StatusBadRequest, "bad request")
+		return
+	}
+	if _, ok := s.labelStrategy.NewLabeler().(decorator.TableKeyDecoder); !ok {
+		utils.MakeInvalidRequestErrorFromError(c, fmt.Errorf("table aggregation requires the db policy"))
+		return
+	}
+	decoderAt := func(t time.Time) decorator.TableKeyDecoder {
+		return decorator.LabelStrategyAt(s.labelStrategy, t).NewLabeler().(decorator.TableKeyDecoder)
+	}
+	baseTag := region.IntoTag(c.Query("type"))
+
+	plane := s.stat.Range(startTime, endTime, "", "", baseTag)
+	resp := &TableSeriesResponse{
+		Type:     baseTag.String(),
+		TimeAxis: make([]int64, len(plane.Times)),
+		Series:   aggregateTables(&plane, decoderAt, level, c.Query("db")),
+	}
+	for i, t := range plane.Times {
+		resp.TimeAxis[i] = t.Unix()
+	}
+
+	if format == "csv" {
+		writeTableSeriesCSV(c, resp)
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
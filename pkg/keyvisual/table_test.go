@@ -0,0 +1,97 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keyvisual
+
+import (
+	"time"
+
+	. "github.com/pingcap/check"
+
+	"github.com/pingcap/tidb-dashboard/pkg/keyvisual/decorator"
+	"github.com/pingcap/tidb-dashboard/pkg/keyvisual/matrix"
+)
+
+var _ = Suite(&testTableSuite{})
+
+type testTableSuite struct{}
+
+// mapDecoder decodes the keys by a fixed map.
+type mapDecoder map[string]decorator.TableKey
+
+func (d mapDecoder) DecodeTableKey(key string) (decorator.TableKey, bool) {
+	tableKey, ok := d[key]
+	return tableKey, ok
+}
+
+func buildTablePlane() *matrix.Plane {
+	startTime := time.Unix(1600000000, 0)
+	plane := matrix.CreatePlane(
+		[]time.Time{startTime, startTime.Add(time.Minute), startTime.Add(2 * time.Minute)},
+		[]matrix.Axis{
+			matrix.CreateAxis([]string{"", "t1", "t1_i1", "t2", ""}, [][]uint64{{1, 10, 20, 30}}),
+			matrix.CreateAxis([]string{"", "t1", "t2", ""}, [][]uint64{{1, 5, 40}}),
+		},
+	)
+	return &plane
+}
+
+var tableDecoder = mapDecoder{
+	"t1":    {DB: "db1", Table: "t1", TableID: 1},
+	"t1_i1": {DB: "db1", Table: "t1", TableID: 1, Index: "i1", IndexID: 1},
+	"t2":    {DB: "db2", Table: "t2", TableID: 2},
+}
+
+func tableDecoderAt(time.Time) decorator.TableKeyDecoder {
+	return tableDecoder
+}
+
+func (t *testTableSuite) TestAggregateByIndex(c *C) {
+	series := aggregateTables(buildTablePlane(), tableDecoderAt, TableLevelIndex, "")
+	c.Assert(series, DeepEquals, []*TableSeries{
+		{DB: "db2", Table: "t2", TableID: 2, Total: 70, Values: []uint64{30, 40}},
+		{DB: "db1", Table: "t1", TableID: 1, Index: "i1", IndexID: 1, Total: 20, Values: []uint64{20, 0}},
+		{DB: "db1", Table: "t1", TableID: 1, Total: 15, Values: []uint64{10, 5}},
+	})
+}
+
+func (t *testTableSuite) TestAggregateByTable(c *C) {
+	series := aggregateTables(buildTablePlane(), tableDecoderAt, TableLevelTable, "db1")
+	c.Assert(series, DeepEquals, []*TableSeries{
+		{DB: "db1", Table: "t1", TableID: 1, Total: 35, Values: []uint64{30, 5}},
+	})
+}
+
+func (t *testTableSuite) TestAggregateAtAxisTime(c *C) {
+	plane := buildTablePlane()
+	// t1 is renamed to t3 and moved to db2 before the end of the second axis.
+	renamedAt := plane.Times[2]
+	decoderAt := func(at time.Time) decorator.TableKeyDecoder {
+		if at.Before(renamedAt) {
+			return tableDecoder
+		}
+		return mapDecoder{
+			"t1": {DB: "db2", Table: "t3", TableID: 1},
+			"t2": {DB: "db2", Table: "t2", TableID: 2},
+		}
+	}
+	series := aggregateTables(plane, decoderAt, TableLevelTable, "db1")
+	c.Assert(series, DeepEquals, []*TableSeries{
+		{DB: "db1", Table: "t1", TableID: 1, Total: 30, Values: []uint64{30, 0}},
+	})
+	series = aggregateTables(plane, decoderAt, TableLevelTable, "")
+	c.Assert(series, DeepEquals, []*TableSeries{
+		{DB: "db2", Table: "t2", TableID: 2, Total: 70, Values: []uint64{30, 40}},
+		{DB: "db2", Table: "t3", TableID: 1, Total: 35, Values: []uint64{30, 5}},
+	})
+}
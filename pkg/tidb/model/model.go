@@ -83,3 +83,20 @@ func (t *TableInfo) GetPartitionInfo() *PartitionInfo {
 	}
 	return nil
 }
+
+// HistoryInfo is used for binlog, it is the result of a finished DDL job.
+type HistoryInfo struct {
+	SchemaVersion int64
+	DBInfo        *DBInfo    `json:"db_info"`
+	TableInfo     *TableInfo `json:"table_info"`
+	FinishedTS    uint64
+}
+
+// Job is for a DDL operation.
+type Job struct {
+	ID         int64        `json:"id"`
+	SchemaID   int64        `json:"schema_id"`
+	TableID    int64        `json:"table_id"`
+	SchemaName string       `json:"schema_name"`
+	BinlogInfo *HistoryInfo `json:"binlog"`
+}
@@ -0,0 +1,71 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqldigest
+
+// keywords are the words that TiDB 5.x does not quote in the normalized text. It covers the reserved keywords,
+// the commonly used unreserved keywords and the builtin functions recognized by the TiDB parser.
+var keywords = map[string]struct{}{}
+
+func init() {
+	for _, w := range []string{
+		// Reserved keywords
+		"add", "all", "alter", "analyze", "and", "as", "asc", "between", "bigint", "binary", "blob", "both", "by",
+		"call", "cascade", "case", "change", "char", "character", "check", "collate", "column", "constraint",
+		"convert", "create", "cross", "current_date", "current_role", "current_time", "current_timestamp",
+		"current_user", "database", "databases", "day_hour", "day_microsecond", "day_minute", "day_second",
+		"decimal", "default", "delayed", "delete", "desc", "describe", "distinct", "distinctrow", "div", "double",
+		"drop", "dual", "else", "enclosed", "escaped", "except", "exists", "explain", "false", "float", "for",
+		"force", "foreign", "from", "fulltext", "generated", "grant", "group", "having", "high_priority",
+		"hour_microsecond", "hour_minute", "hour_second", "if", "ignore", "in", "index", "infile", "inner",
+		"insert", "int", "integer", "intersect", "interval", "into", "is", "join", "key", "keys", "kill",
+		"leading", "left", "like", "limit", "linear", "lines", "load", "localtime", "localtimestamp", "lock",
+		"long", "longblob", "longtext", "low_priority", "match", "maxvalue", "mediumblob", "mediumint",
+		"mediumtext", "minute_microsecond", "minute_second", "mod", "natural", "not", "no_write_to_binlog",
+		"null", "numeric", "on", "optimize", "option", "optionally", "or", "order", "outer", "over", "partition",
+		"precision", "primary", "procedure", "range", "read", "real", "recursive", "references", "regexp",
+		"release", "rename", "repeat", "replace", "require", "restrict", "revoke", "right", "rlike", "row",
+		"rows", "second_microsecond", "select", "set", "show", "smallint", "spatial", "sql", "sql_big_result",
+		"sql_calc_found_rows", "sql_small_result", "ssl", "starting", "stored", "straight_join", "table",
+		"terminated", "then", "tinyblob", "tinyint", "tinytext", "to", "trailing", "trigger", "true", "union",
+		"unique", "unlock", "unsigned", "update", "usage", "use", "using", "utc_date", "utc_time",
+		"utc_timestamp", "values", "varbinary", "varchar", "varcharacter", "varying", "virtual", "when", "where",
+		"while", "window", "with", "write", "xor", "year_month", "zerofill",
+		// Unreserved keywords
+		"action", "after", "always", "any", "ascii", "auto_increment", "avg_row_length", "begin", "bit", "bool",
+		"boolean", "btree", "byte", "cache", "charset", "columns", "comment", "commit", "committed", "compact",
+		"compressed", "compression", "connection", "consistent", "data", "date", "datetime", "day", "deallocate",
+		"definer", "disable", "do", "duplicate", "dynamic", "enable", "end", "engine", "engines", "enum",
+		"escape", "events", "execute", "expansion", "extended", "fields", "first", "fixed", "flush", "following",
+		"format", "full", "function", "global", "grants", "hash", "hour", "identified", "isolation", "json",
+		"last", "less", "level", "local", "master", "microsecond", "minute", "mode", "modify", "month", "names",
+		"national", "next", "no", "none", "nulls", "offset", "only", "password", "plugins", "preceding",
+		"prepare", "privileges", "processlist", "quarter", "query", "quick", "redundant", "repeatable",
+		"restore", "reverse", "rollback", "savepoint", "second", "serializable", "session", "share", "shared",
+		"signed", "snapshot", "start", "status", "subpartition", "subpartitions", "super", "tables",
+		"temporary", "text", "than", "time", "timestamp", "trace", "transaction", "truncate", "unbounded",
+		"uncommitted", "unknown", "user", "value", "variables", "view", "warnings", "week", "without", "year",
+		// Builtin functions
+		"abs", "adddate", "addtime", "approx_count_distinct", "avg", "bit_and", "bit_or", "bit_xor", "cast",
+		"ceil", "ceiling", "coalesce", "concat", "concat_ws", "count", "curdate", "curtime", "date_add",
+		"date_format", "date_sub", "dayofmonth", "dayofweek", "dayofyear", "extract", "floor", "from_unixtime",
+		"greatest", "group_concat", "hex", "ifnull", "isnull", "json_extract", "json_object", "json_unquote",
+		"last_insert_id", "lcase", "least", "length", "lower", "lpad", "ltrim", "max", "md5", "min", "now",
+		"nullif", "position", "pow", "power", "rand", "round", "rpad", "rtrim", "sleep", "std", "stddev",
+		"str_to_date", "subdate", "substr", "substring", "substring_index", "sum", "sysdate", "timestampadd",
+		"timestampdiff", "to_days", "trim", "truncate", "ucase", "unix_timestamp", "upper", "uuid",
+		"var_pop", "var_samp", "variance",
+	} {
+		keywords[w] = struct{}{}
+	}
+}
@@ -0,0 +1,472 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sqldigest normalizes SQL texts and computes their digests in the same way as the TiDB parser, so that
+// a raw query can be looked up in the statement summary and the slow log by its digest.
+//
+// TiDB 5.x quotes identifiers in the normalized text while TiDB 4.x does not, and telling identifiers from
+// unreserved keywords requires the full keyword list of the TiDB parser. So the digest of the quoted form is a
+// best-effort one, and callers should also match the normalized text with the quotes removed, which is exact.
+package sqldigest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokKeyword tokenKind = iota
+	tokIdentifier
+	tokQuotedIdentifier
+	tokVariable
+	tokIntLit
+	tokNumLit
+	tokStringLit
+	tokParamMarker
+	tokOperator
+	tokHint
+	// Generated when reducing literals
+	tokGenericSymbol
+	tokGenericSymbolList
+)
+
+type token struct {
+	kind tokenKind
+	lit  string
+}
+
+type lexer struct {
+	sql string
+	pos int
+}
+
+func isIdentChar(r rune) bool {
+	return r == '_' || r == '$' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// multiCharOperators is ordered by length, so that the longest operator is matched first.
+var multiCharOperators = []string{"<=>", "->>", "<=", ">=", "<>", "!=", "||", "&&", "<<", ">>", ":=", "->"}
+
+func (l *lexer) skipSpacesAndComments() {
+	for l.pos < len(l.sql) {
+		rest := l.sql[l.pos:]
+		r, size := utf8.DecodeRuneInString(rest)
+		switch {
+		case unicode.IsSpace(r):
+			l.pos += size
+		case r == '#', isDoubleDashComment(rest):
+			end := strings.IndexByte(rest, '\n')
+			if end < 0 {
+				l.pos = len(l.sql)
+			} else {
+				l.pos += end + 1
+			}
+		case strings.HasPrefix(rest, "/*!"):
+			// MySQL executable comment, e.g. `/*!40101 SET ... */`, the content is treated as SQL.
+			l.pos += 3
+			for l.pos < len(l.sql) && l.sql[l.pos] >= '0' && l.sql[l.pos] <= '9' {
+				l.pos++
+			}
+			if end := strings.Index(l.sql[l.pos:], "*/"); end >= 0 {
+				l.sql = l.sql[:l.pos+end] + "  " + l.sql[l.pos+end+2:]
+			}
+		case strings.HasPrefix(rest, "/*") && !strings.HasPrefix(rest, "/*+"):
+			end := strings.Index(rest[2:], "*/")
+			if end < 0 {
+				l.pos = len(l.sql)
+			} else {
+				l.pos += end + 4
+			}
+		default:
+			return
+		}
+	}
+}
+
+// isDoubleDashComment tells whether it is a `-- ` comment, which requires a space or control character after `--`.
+func isDoubleDashComment(s string) bool {
+	if !strings.HasPrefix(s, "--") {
+		return false
+	}
+	return len(s) == 2 || s[2] <= ' '
+}
+
+func (l *lexer) scanQuoted(quote byte) string {
+	var sb strings.Builder
+	l.pos++
+	for l.pos < len(l.sql) {
+		c := l.sql[l.pos]
+		switch {
+		case c == '\\' && quote != '`' && l.pos+1 < len(l.sql):
+			sb.WriteByte(l.sql[l.pos+1])
+			l.pos += 2
+		case c == quote && l.pos+1 < len(l.sql) && l.sql[l.pos+1] == quote:
+			sb.WriteByte(quote)
+			l.pos += 2
+		case c == quote:
+			l.pos++
+			return sb.String()
+		default:
+			sb.WriteByte(c)
+			l.pos++
+		}
+	}
+	return sb.String()
+}
+
+func (l *lexer) scanNumber() token {
+	start := l.pos
+	rest := l.sql[l.pos:]
+	if len(rest) > 2 && rest[0] == '0' && (rest[1] == 'x' || rest[1] == 'X' || rest[1] == 'b' || rest[1] == 'B') {
+		l.pos += 2
+		for l.pos < len(l.sql) && isHexDigit(l.sql[l.pos]) {
+			l.pos++
+		}
+		return token{tokNumLit, l.sql[start:l.pos]}
+	}
+	kind := tokIntLit
+	for l.pos < len(l.sql) && isDigit(l.sql[l.pos]) {
+		l.pos++
+	}
+	if l.pos < len(l.sql) && l.sql[l.pos] == '.' {
+		kind = tokNumLit
+		l.pos++
+		for l.pos < len(l.sql) && isDigit(l.sql[l.pos]) {
+			l.pos++
+		}
+	}
+	if l.pos < len(l.sql) && (l.sql[l.pos] == 'e' || l.sql[l.pos] == 'E') {
+		p := l.pos + 1
+		if p < len(l.sql) && (l.sql[p] == '+' || l.sql[p] == '-') {
+			p++
+		}
+		if p < len(l.sql) && isDigit(l.sql[p]) {
+			kind = tokNumLit
+			l.pos = p
+			for l.pos < len(l.sql) && isDigit(l.sql[l.pos]) {
+				l.pos++
+			}
+		}
+	}
+	return token{kind, l.sql[start:l.pos]}
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isHexDigit(c byte) bool {
+	return isDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+// next returns the next token, or false when the end is reached.
+func (l *lexer) next() (token, bool) {
+	l.skipSpacesAndComments()
+	if l.pos >= len(l.sql) {
+		return token{}, false
+	}
+	rest := l.sql[l.pos:]
+	c := rest[0]
+	switch {
+	case strings.HasPrefix(rest, "/*+"):
+		end := strings.Index(rest, "*/")
+		if end < 0 {
+			end = len(rest)
+		} else {
+			end += 2
+		}
+		l.pos += end
+		return token{tokHint, rest[:end]}, true
+	case c == '\'' || c == '"':
+		return token{tokStringLit, l.scanQuoted(c)}, true
+	case c == '`':
+		return token{tokQuotedIdentifier, strings.ToLower(l.scanQuoted(c))}, true
+	case (c == 'x' || c == 'X' || c == 'b' || c == 'B') && len(rest) > 1 && rest[1] == '\'':
+		// Hex or bit literals, e.g. X'0A' and b'01'
+		l.pos++
+		l.scanQuoted('\'')
+		return token{tokNumLit, rest[:1]}, true
+	case isDigit(c), c == '.' && len(rest) > 1 && isDigit(rest[1]):
+		tok := l.scanNumber()
+		// Identifiers may start with digits, e.g. `1a`.
+		if l.pos < len(l.sql) {
+			if r, _ := utf8.DecodeRuneInString(l.sql[l.pos:]); isIdentChar(r) {
+				start := l.pos - len(tok.lit)
+				for l.pos < len(l.sql) {
+					r, size := utf8.DecodeRuneInString(l.sql[l.pos:])
+					if !isIdentChar(r) {
+						break
+					}
+					l.pos += size
+				}
+				return token{tokIdentifier, strings.ToLower(l.sql[start:l.pos])}, true
+			}
+		}
+		return tok, true
+	case c == '@':
+		start := l.pos
+		l.pos++
+		if l.pos < len(l.sql) && l.sql[l.pos] == '@' {
+			l.pos++
+		}
+		if l.pos < len(l.sql) && (l.sql[l.pos] == '`' || l.sql[l.pos] == '\'' || l.sql[l.pos] == '"') {
+			prefix := l.sql[start:l.pos]
+			return token{tokVariable, prefix + strings.ToLower(l.scanQuoted(l.sql[l.pos]))}, true
+		}
+		for l.pos < len(l.sql) {
+			r, size := utf8.DecodeRuneInString(l.sql[l.pos:])
+			if !isIdentChar(r) && r != '.' {
+				break
+			}
+			l.pos += size
+		}
+		return token{tokVariable, strings.ToLower(l.sql[start:l.pos])}, true
+	case c == '?':
+		l.pos++
+		return token{tokParamMarker, "?"}, true
+	}
+
+	if r, size := utf8.DecodeRuneInString(rest); isIdentChar(r) {
+		start := l.pos
+		l.pos += size
+		for l.pos < len(l.sql) {
+			r, size := utf8.DecodeRuneInString(l.sql[l.pos:])
+			if !isIdentChar(r) {
+				break
+			}
+			l.pos += size
+		}
+		lit := strings.ToLower(l.sql[start:l.pos])
+		if _, ok := keywords[lit]; ok {
+			return token{tokKeyword, lit}, true
+		}
+		return token{tokIdentifier, lit}, true
+	}
+
+	for _, op := range multiCharOperators {
+		if strings.HasPrefix(rest, op) {
+			l.pos += len(op)
+			return token{tokOperator, op}, true
+		}
+	}
+	_, size := utf8.DecodeRuneInString(rest)
+	l.pos += size
+	return token{tokOperator, rest[:size]}, true
+}
+
+type digester struct {
+	lexer  *lexer
+	tokens []token
+}
+
+func (d *digester) back(n int) []token {
+	if len(d.tokens) < n {
+		return nil
+	}
+	return d.tokens[len(d.tokens)-n:]
+}
+
+func (d *digester) popBack(n int) {
+	if len(d.tokens) < n {
+		n = len(d.tokens)
+	}
+	d.tokens = d.tokens[:len(d.tokens)-n]
+}
+
+func isNumLit(kind tokenKind) bool {
+	return kind == tokIntLit || kind == tokNumLit
+}
+
+func isLit(t token) bool {
+	switch {
+	case isNumLit(t.kind), t.kind == tokStringLit, t.kind == tokParamMarker:
+		return true
+	case t.kind == tokOperator && t.lit == "*":
+		return true
+	case t.kind == tokKeyword && t.lit == "null":
+		return true
+	}
+	return false
+}
+
+func isComma(t token) bool {
+	return t.kind == tokOperator && t.lit == ","
+}
+
+// isPrefixByUnary tells whether the number is preceded by an unary sign, e.g. `-1` in `a = -1`.
+func (d *digester) isPrefixByUnary(kind tokenKind) bool {
+	if !isNumLit(kind) {
+		return false
+	}
+	last := d.back(1)
+	if last == nil || (last[0].lit != "-" && last[0].lit != "+") {
+		return false
+	}
+	last2 := d.back(2)
+	if last2 == nil {
+		return true
+	}
+	switch last2[0].lit {
+	case "(", ",", "+", "-", ">=", "is", "<=", "=", "<", ">", "select":
+		return true
+	}
+	return false
+}
+
+// isOrderOrGroupBy tells whether the number is a position in `ORDER BY` or `GROUP BY`, e.g. `ORDER BY 1, 2`.
+func (d *digester) isOrderOrGroupBy() bool {
+	var last []token
+	n := 2
+	for ; ; n += 2 {
+		last = d.back(n)
+		if len(last) < 2 {
+			return false
+		}
+		if !isComma(last[1]) {
+			break
+		}
+	}
+	if last[1].lit == "(" {
+		last = d.back(n + 1)
+		if len(last) < 2 {
+			return false
+		}
+	}
+	return (last[0].lit == "order" || last[0].lit == "group") && last[1].lit == "by"
+}
+
+func (d *digester) reduceLit(t *token) {
+	if !isLit(*t) {
+		return
+	}
+	// count(*) => count(?)
+	if t.lit == "*" {
+		if last := d.back(1); last != nil && last[0].lit == "(" {
+			*t = token{tokGenericSymbol, "?"}
+		}
+		return
+	}
+	// -1 => 1
+	if d.isPrefixByUnary(t.kind) {
+		d.popBack(1)
+	}
+	// ?, ?, ? => ...
+	if last2 := d.back(2); last2 != nil && isComma(last2[1]) &&
+		(last2[0].kind == tokGenericSymbol || last2[0].kind == tokGenericSymbolList) {
+		d.popBack(2)
+		*t = token{tokGenericSymbolList, "..."}
+		return
+	}
+	if t.kind == tokIntLit && d.isOrderOrGroupBy() {
+		return
+	}
+	*t = token{tokGenericSymbol, "?"}
+}
+
+// reduceIndexHint drops the index hints, e.g. `USE INDEX (idx_a)`.
+func (d *digester) reduceIndexHint(t *token) bool {
+	if t.lit != "index" && t.lit != "key" {
+		return false
+	}
+	last := d.back(1)
+	if last == nil {
+		return false
+	}
+	switch last[0].lit {
+	case "force", "use", "ignore":
+	default:
+		return false
+	}
+	for {
+		next, ok := d.lexer.next()
+		if !ok {
+			break
+		}
+		if next.kind == tokOperator && next.lit == ")" {
+			break
+		}
+	}
+	d.popBack(1)
+	return true
+}
+
+func normalize(sql string, quoteIdentifiers bool) string {
+	d := &digester{lexer: &lexer{sql: sql}}
+	for {
+		t, ok := d.lexer.next()
+		if !ok {
+			break
+		}
+		if t.kind == tokHint || d.reduceIndexHint(&t) {
+			continue
+		}
+		if t.kind == tokKeyword && t.lit == "straight_join" {
+			t.lit = "join"
+		}
+		d.reduceLit(&t)
+		d.tokens = append(d.tokens, t)
+	}
+	// Trailing semicolon is ignored.
+	if last := d.back(1); last != nil && last[0].kind == tokOperator && last[0].lit == ";" {
+		d.popBack(1)
+	}
+
+	var sb strings.Builder
+	for i, t := range d.tokens {
+		if i > 0 {
+			sb.WriteByte(' ')
+		}
+		if quoteIdentifiers && (t.kind == tokIdentifier || t.kind == tokQuotedIdentifier) {
+			sb.WriteByte('`')
+			sb.WriteString(t.lit)
+			sb.WriteByte('`')
+			continue
+		}
+		sb.WriteString(t.lit)
+	}
+	return sb.String()
+}
+
+// Normalize returns the normalized SQL text without quoting identifiers, which is the same as the `DIGEST_TEXT`
+// of TiDB 4.x, or the one of TiDB 5.x with all backquotes removed.
+func Normalize(sql string) string {
+	return normalize(sql, false)
+}
+
+// NormalizeQuoted returns the normalized SQL text with identifiers quoted as TiDB 5.x does.
+func NormalizeQuoted(sql string) string {
+	return normalize(sql, true)
+}
+
+// Digest returns the digest of a normalized SQL text.
+func Digest(normalized string) string {
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// CandidateDigests returns the possible digests of the SQL text in different TiDB versions.
+func CandidateDigests(sql string) []string {
+	return []string{
+		Digest(Normalize(sql)),
+		Digest(NormalizeQuoted(sql)),
+	}
+}
+
+// UnquotedDigestTextExpr is the SQL expression that removes the quotes in the `DIGEST_TEXT`, which can be
+// compared with the result of `Normalize`.
+const UnquotedDigestTextExpr = "REPLACE(digest_text, '`', '')"
@@ -0,0 +1,77 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqldigest
+
+import (
+	"testing"
+
+	. "github.com/pingcap/check"
+)
+
+func TestT(t *testing.T) {
+	CustomVerboseFlag = true
+	TestingT(t)
+}
+
+var _ = Suite(&testSQLDigestSuite{})
+
+type testSQLDigestSuite struct{}
+
+func (t *testSQLDigestSuite) Test_Normalize(c *C) {
+	cases := []struct {
+		sql        string
+		normalized string
+	}{
+		{"SELECT * FROM t WHERE a IN (1, 2, 3) AND b = 'x'", "select * from t where a in ( ... ) and b = ?"},
+		{"select count(*) from t", "select count ( ? ) from t"},
+		{"select a, b from t group by 1 order by 2 desc limit 10", "select a , b from t group by 1 order by 2 desc limit ?"},
+		{"select * from t where a = -1 and b > +2.5", "select * from t where a = ? and b > ?"},
+		{"select /*+ HASH_JOIN(t1) */ * from t1 straight_join t2 on t1.id = t2.id;", "select * from t1 join t2 on t1 . id = t2 . id"},
+		{"select * from t use index (idx_a) where a = ? -- comment", "select * from t where a = ?"},
+		{"insert into `T` values (1, 'a'), (2, 'b')", "insert into t values ( ... ) , ( ... )"},
+		{"/* app: api */ UPDATE t SET a = a + 1 WHERE id = 0x1F", "update t set a = a + ? where id = ?"},
+	}
+	for _, cs := range cases {
+		c.Assert(Normalize(cs.sql), Equals, cs.normalized, Commentf("sql: %s", cs.sql))
+	}
+}
+
+func (t *testSQLDigestSuite) Test_NormalizeQuoted(c *C) {
+	c.Assert(NormalizeQuoted("SELECT * FROM t WHERE `a` = 1"), Equals, "select * from `t` where `a` = ?")
+	c.Assert(NormalizeQuoted("select max(a) from db1.t1"), Equals, "select max ( `a` ) from `db1` . `t1`")
+}
+
+func (t *testSQLDigestSuite) Test_CandidateDigests(c *C) {
+	digests := CandidateDigests("select * from t where a = 1")
+	c.Assert(digests, HasLen, 2)
+	c.Assert(digests[0], Equals, Digest("select * from t where a = ?"))
+	c.Assert(digests[1], Equals, Digest("select * from `t` where `a` = ?"))
+	c.Assert(CandidateDigests("SELECT * FROM t WHERE a = 2"), DeepEquals, digests)
+}
+
+func (t *testSQLDigestSuite) Test_Digest(c *C) {
+	cases := []struct {
+		sql    string
+		digest string
+	}{
+		{"SELECT * FROM t WHERE a = 1", "233ddc91cd773861f6518467ce0a6c5b56843df45543b76e98054c0cbbd63e6d"},
+		{"select  *  from t where a = 'x' /* comment */", "233ddc91cd773861f6518467ce0a6c5b56843df45543b76e98054c0cbbd63e6d"},
+		{"select count(*) from t", "68176744089dff9ec5de83b073c9579e2b5921014a540cbddabf0a49289b4452"},
+		{"insert into t values (1, 'a'), (2, 'b')", "d97ba36fbd51e696058cb09db9344aa57c9428caf7a344dec6633c2846057d1f"},
+	}
+	for _, cs := range cases {
+		c.Assert(Digest(Normalize(cs.sql)), Equals, cs.digest, Commentf("sql: %s", cs.sql))
+	}
+	c.Assert(Digest(NormalizeQuoted("SELECT * FROM t WHERE a = 1")), Equals, "077a87a576e42360c95530ccdac7a1771c4efba17619e26be50a4cfd967204a0")
+}